@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE books ADD FULLTEXT INDEX books_fulltext (title, author, genre);
+
+-- +goose Down
+ALTER TABLE books DROP INDEX books_fulltext;
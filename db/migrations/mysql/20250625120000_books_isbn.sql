@@ -0,0 +1,9 @@
+-- +goose Up
+-- Normalized ISBN-13, NULL when unknown. Books in the trash keep theirs, so
+-- restoring them can't clash with a newer copy.
+ALTER TABLE books ADD COLUMN isbn VARCHAR(13) NULL DEFAULT NULL;
+CREATE UNIQUE INDEX idx_books_isbn ON books (isbn);
+
+-- +goose Down
+DROP INDEX idx_books_isbn ON books;
+ALTER TABLE books DROP COLUMN isbn;
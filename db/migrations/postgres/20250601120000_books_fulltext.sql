@@ -0,0 +1,7 @@
+-- +goose Up
+-- The indexed expression must match postgresSearchVector in internal/database/search.go
+CREATE INDEX IF NOT EXISTS books_search_idx ON books
+    USING GIN (to_tsvector('simple', COALESCE(title, '') || ' ' || COALESCE(author, '') || ' ' || COALESCE(genre, '')));
+
+-- +goose Down
+DROP INDEX IF EXISTS books_search_idx;
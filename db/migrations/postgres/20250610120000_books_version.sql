@@ -0,0 +1,6 @@
+-- +goose Up
+-- Incremented on every write, used for optimistic concurrency (ETag/If-Match)
+ALTER TABLE books ADD COLUMN version INT NOT NULL DEFAULT 1;
+
+-- +goose Down
+ALTER TABLE books DROP COLUMN version;
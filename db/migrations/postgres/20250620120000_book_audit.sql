@@ -0,0 +1,18 @@
+-- +goose Up
+-- One row per change to a book, written in the same transaction as the change.
+-- book_id has no foreign key so the history outlives purged books.
+CREATE TABLE book_audit (
+    id BIGSERIAL PRIMARY KEY,
+    book_id VARCHAR(36) NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    request_id VARCHAR(128) NOT NULL DEFAULT '',
+    changes TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_book_audit_book_id ON book_audit (book_id, id);
+CREATE INDEX idx_book_audit_actor ON book_audit (actor, created_at);
+CREATE INDEX idx_book_audit_created_at ON book_audit (created_at);
+
+-- +goose Down
+DROP TABLE book_audit;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- Credentials of integrations. Only a salted SHA-256 hash of each secret is
+-- stored, prefix is the public part of the key used to find it.
+CREATE TABLE api_keys (
+    id VARCHAR(36) PRIMARY KEY NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    prefix VARCHAR(32) NOT NULL UNIQUE,
+    salt VARCHAR(64) NOT NULL,
+    hash VARCHAR(64) NOT NULL,
+    scopes VARCHAR(255) NOT NULL,
+    created_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    rotated_at TIMESTAMP NULL DEFAULT NULL,
+    last_used_at TIMESTAMP NULL DEFAULT NULL,
+    revoked_at TIMESTAMP NULL DEFAULT NULL
+);
+
+-- +goose Down
+DROP TABLE api_keys;
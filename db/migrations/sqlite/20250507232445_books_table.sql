@@ -0,0 +1,26 @@
+-- +goose Up
+-- SQLite has no UUID() default, ids are always generated by the application
+CREATE TABLE IF NOT EXISTS books (
+    id VARCHAR(36) PRIMARY KEY NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    author VARCHAR(255),
+    genre VARCHAR(20),
+    published_year INT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Emulates MySQL's ON UPDATE CURRENT_TIMESTAMP
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS books_updated_at
+AFTER UPDATE ON books
+FOR EACH ROW
+WHEN NEW.updated_at = OLD.updated_at
+BEGIN
+    UPDATE books SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TRIGGER IF EXISTS books_updated_at;
+DROP TABLE IF EXISTS books;
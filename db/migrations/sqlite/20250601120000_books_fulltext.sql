@@ -0,0 +1,37 @@
+-- +goose Up
+-- FTS5 index over the searchable columns, kept in sync with books by triggers
+CREATE VIRTUAL TABLE IF NOT EXISTS books_fts USING fts5(id UNINDEXED, title, author, genre);
+
+INSERT INTO books_fts (id, title, author, genre)
+SELECT id, title, author, genre FROM books;
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS books_fts_insert
+AFTER INSERT ON books
+BEGIN
+    INSERT INTO books_fts (id, title, author, genre) VALUES (NEW.id, NEW.title, NEW.author, NEW.genre);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS books_fts_update
+AFTER UPDATE OF title, author, genre ON books
+BEGIN
+    DELETE FROM books_fts WHERE id = OLD.id;
+    INSERT INTO books_fts (id, title, author, genre) VALUES (NEW.id, NEW.title, NEW.author, NEW.genre);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS books_fts_delete
+AFTER DELETE ON books
+BEGIN
+    DELETE FROM books_fts WHERE id = OLD.id;
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TRIGGER IF EXISTS books_fts_delete;
+DROP TRIGGER IF EXISTS books_fts_update;
+DROP TRIGGER IF EXISTS books_fts_insert;
+DROP TABLE IF EXISTS books_fts;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- Deleted books stay in the table until the purge job removes them
+ALTER TABLE books ADD COLUMN deleted_at TIMESTAMP NULL DEFAULT NULL;
+CREATE INDEX idx_books_deleted_at ON books (deleted_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_books_deleted_at;
+ALTER TABLE books DROP COLUMN deleted_at;
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// APIKeyPrefix starts every API key, telling them apart from JWTs
+const APIKeyPrefix = "lib_"
+
+// APIKeyCredentials are what the server stores of an API key: the public
+// prefix finding it, and a salted hash of its secret
+type APIKeyCredentials struct {
+	Prefix string
+	Salt   string
+	Hash   string
+}
+
+// GenerateAPIKey returns a new API key, lib_<prefix>_<secret>, and the
+// credentials to store for it. The key itself must not be stored.
+func GenerateAPIKey() (string, APIKeyCredentials, error) {
+	var prefix, salt [8]byte
+	var secret [32]byte
+	for _, b := range [][]byte{prefix[:], salt[:], secret[:]} {
+		if _, err := rand.Read(b); err != nil {
+			return "", APIKeyCredentials{}, err
+		}
+	}
+	creds := APIKeyCredentials{
+		// hex, so the prefix never holds the "_" ending it
+		Prefix: hex.EncodeToString(prefix[:]),
+		Salt:   hex.EncodeToString(salt[:]),
+	}
+	secretText := base64.RawURLEncoding.EncodeToString(secret[:])
+	creds.Hash = hashAPIKeySecret(creds.Salt, secretText)
+	return APIKeyPrefix + creds.Prefix + "_" + secretText, creds, nil
+}
+
+// ParseAPIKey splits an API key into its prefix and secret
+func ParseAPIKey(key string) (prefix, secret string, ok bool) {
+	rest, ok := strings.CutPrefix(key, APIKeyPrefix)
+	if !ok {
+		return "", "", false
+	}
+	prefix, secret, ok = strings.Cut(rest, "_")
+	return prefix, secret, ok && prefix != "" && secret != ""
+}
+
+// CheckAPIKeySecret reports whether secret is the one the salt and hash were
+// computed from, in constant time
+func CheckAPIKeySecret(salt, hash, secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(hashAPIKeySecret(salt, secret)), []byte(hash)) == 1
+}
+
+// hashAPIKeySecret hashes the secret of a key with its salt. The secrets
+// are 256 random bits, a fast hash is as safe for them as a slow one.
+func hashAPIKeySecret(salt, secret string) string {
+	sum := sha256.Sum256([]byte(salt + secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAPIKey(t *testing.T) {
+	key, creds, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, APIKeyPrefix+creds.Prefix+"_") {
+		t.Errorf("Expected %q to start with its prefix %q", key, creds.Prefix)
+	}
+	if strings.Contains(creds.Hash, key[len(APIKeyPrefix+creds.Prefix+"_"):]) {
+		t.Error("Expected only a hash of the secret to be kept")
+	}
+
+	prefix, secret, ok := ParseAPIKey(key)
+	if !ok || prefix != creds.Prefix {
+		t.Fatalf("Expected %q to parse, got %q, %v", key, prefix, ok)
+	}
+	if !CheckAPIKeySecret(creds.Salt, creds.Hash, secret) {
+		t.Error("Expected the secret to match its hash")
+	}
+	if CheckAPIKeySecret(creds.Salt, creds.Hash, secret+"x") || CheckAPIKeySecret("other", creds.Hash, secret) {
+		t.Error("Expected another secret or salt not to match")
+	}
+
+	other, otherCreds, _ := GenerateAPIKey()
+	if other == key || otherCreds.Prefix == creds.Prefix || otherCreds.Salt == creds.Salt {
+		t.Error("Expected every key to be different")
+	}
+
+	for _, bad := range []string{"", "lib_", "lib_abc", "lib_abc_", "lib__secret", "key_abc_secret"} {
+		if _, _, ok := ParseAPIKey(bad); ok {
+			t.Errorf("Expected %q not to parse", bad)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"digicert-library-app/internal/models"
+)
+
+// Errors of credentials that aren't accepted
+var (
+	ErrInvalidToken   = errors.New("invalid token")
+	ErrInvalidAPIKey  = errors.New("invalid API key")
+	ErrInvalidSession = errors.New("invalid or expired session")
+)
+
+// lastUsedResolution is how stale the recorded last use of a key may get, so
+// a busy key doesn't cost a write per request
+const lastUsedResolution = time.Minute
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	// Subject identifies the caller, the sub claim of a token or of the ID
+	// token a session started with, or api-key:<id> for an API key. The
+	// changes it makes are recorded under it.
+	Subject string
+	// Scopes of an API key, or those of the roles of a token or session
+	Scopes []string
+	// Claims of the token or session, nil for an API key
+	Claims *Claims
+	// APIKey the caller authenticated with, nil for a token
+	APIKey *models.APIKey
+}
+
+// HasScope reports whether the caller holds scope
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// HasRole reports whether the caller holds role, or a role above it. An API
+// key holds a role when it has the scope of the role.
+func (p *Principal) HasRole(role Role) bool {
+	return p.HasScope(role.Scope())
+}
+
+// APIKeyLookup is the part of the API key store authentication needs
+type APIKeyLookup interface {
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (models.APIKey, error)
+	TouchAPIKey(ctx context.Context, id string) error
+}
+
+// Authenticator identifies callers from their token, API key or session
+type Authenticator struct {
+	verifier *Verifier
+	keys     APIKeyLookup
+	sessions *Sessions
+}
+
+// AuthenticatorOption customizes an Authenticator
+type AuthenticatorOption func(*Authenticator)
+
+// WithSessions accepts the sessions of staff who logged in with OpenID
+// Connect
+func WithSessions(sessions *Sessions) AuthenticatorOption {
+	return func(a *Authenticator) {
+		a.sessions = sessions
+	}
+}
+
+func NewAuthenticator(verifier *Verifier, keys APIKeyLookup, opts ...AuthenticatorOption) *Authenticator {
+	a := &Authenticator{verifier: verifier, keys: keys}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Authenticate identifies the caller presenting credential, a JWT or an API
+// key. It fails with ErrInvalidToken or ErrInvalidAPIKey when the credential
+// isn't accepted, other errors come from the key store.
+func (a *Authenticator) Authenticate(ctx context.Context, credential string) (*Principal, error) {
+	if strings.HasPrefix(credential, APIKeyPrefix) {
+		return a.authenticateAPIKey(ctx, credential)
+	}
+	claims, err := a.verifier.Verify(credential)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return &Principal{Subject: claims.Subject, Scopes: roleScopes(claims.Roles), Claims: claims}, nil
+}
+
+func (a *Authenticator) authenticateAPIKey(ctx context.Context, credential string) (*Principal, error) {
+	prefix, secret, ok := ParseAPIKey(credential)
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+	key, err := a.keys.GetAPIKeyByPrefix(ctx, prefix)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if key.RevokedAt != nil || !CheckAPIKeySecret(key.Salt, key.Hash, secret) {
+		return nil, ErrInvalidAPIKey
+	}
+	if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) >= lastUsedResolution {
+		// a failure here shouldn't fail the request the key is valid for
+		if err := a.keys.TouchAPIKey(ctx, key.ID.String()); err != nil {
+			log.Printf("Couldn't record the use of API key %s: %v", key.ID, err)
+		}
+	}
+	return &Principal{Subject: "api-key:" + key.ID.String(), Scopes: key.Scopes, APIKey: &key}, nil
+}
+
+// AuthenticateSession identifies the staff member of a session cookie. It
+// fails with ErrInvalidSession when sessions aren't enabled or the session
+// isn't accepted.
+func (a *Authenticator) AuthenticateSession(session string) (*Principal, error) {
+	if a.sessions == nil {
+		return nil, ErrInvalidSession
+	}
+	claims, err := a.sessions.Verify(session)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSession, err)
+	}
+	return &Principal{Subject: claims.Subject, Scopes: roleScopes(claims.Roles), Claims: claims}, nil
+}
+
+type contextKey struct{}
+
+// WithPrincipal returns a context carrying the authenticated caller
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the authenticated caller of the request, or nil when
+// it wasn't authenticated
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+	return p
+}
@@ -0,0 +1,101 @@
+// Package auth authenticates the callers of the API. Staff send a JWT,
+// verified against the keys and the issuer and audience the server is
+// configured with, and integrations send an API key, checked against the
+// salted hash stored for it.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims are the verified claims of a token. Subject identifies the caller
+// and is what the audit log records, Roles what they may do (see Role).
+type Claims struct {
+	jwt.RegisteredClaims
+	Roles jwt.ClaimStrings `json:"roles,omitempty"`
+}
+
+// Config is what a token must satisfy to be accepted
+type Config struct {
+	// Issuer, when set, must be the iss claim of every token
+	Issuer string
+	// Audience, when set, must be one of the aud claims of every token
+	Audience string
+	// Keys verify the token signatures, see HMACKey, ParsePublicKeyPEM and
+	// ParseJWKS
+	Keys []Key
+	// Leeway tolerates clock skew when checking exp and nbf
+	Leeway time.Duration
+}
+
+// Verifier checks bearer tokens
+type Verifier struct {
+	keys   []Key
+	parser *jwt.Parser
+}
+
+// NewVerifier returns a verifier accepting the tokens cfg describes. It
+// fails when no key is configured, since every token would be rejected.
+func NewVerifier(cfg Config) (*Verifier, error) {
+	if len(cfg.Keys) == 0 {
+		return nil, errors.New("no token verification key configured")
+	}
+	// only the algorithms of the configured keys are accepted, so a token
+	// can't pick a weaker one, or "none"
+	var methods []string
+	for _, key := range cfg.Keys {
+		if !slices.Contains(methods, key.Alg) {
+			methods = append(methods, key.Alg)
+		}
+	}
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	return &Verifier{keys: cfg.Keys, parser: jwt.NewParser(opts...)}, nil
+}
+
+// Verify checks the signature of a token and its exp, nbf, iss and aud
+// claims, returning its claims when it's valid
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	claims := &Claims{}
+	if _, err := v.parser.ParseWithClaims(token, claims, v.keyFunc); err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+	return claims, nil
+}
+
+// keyFunc returns the keys that may have signed a token: those for its
+// algorithm and, when the token names one, with its key id
+func (v *Verifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	var set jwt.VerificationKeySet
+	for _, key := range v.keys {
+		if key.Alg != token.Method.Alg() {
+			continue
+		}
+		if kid != "" && key.ID != "" && key.ID != kid {
+			continue
+		}
+		set.Keys = append(set.Keys, key.Key)
+	}
+	if len(set.Keys) == 0 {
+		return nil, fmt.Errorf("no %s key with id %q", token.Method.Alg(), kid)
+	}
+	return set, nil
+}
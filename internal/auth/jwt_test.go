@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://issuer.example"
+	testAudience = "library-api"
+	testSecret   = "0123456789abcdef0123456789abcdef"
+)
+
+// testKeys are the signing keys tokens are minted with in these tests
+type testKeys struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKeys{rsa: rsaKey, ec: ecKey}
+}
+
+// validClaims returns claims every verifier of these tests accepts
+func validClaims() jwt.RegisteredClaims {
+	now := time.Now()
+	return jwt.RegisteredClaims{
+		Subject:   "alice",
+		Issuer:    testIssuer,
+		Audience:  jwt.ClaimStrings{testAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+	}
+}
+
+func mint(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func newTestVerifier(t *testing.T, keys ...Key) *Verifier {
+	t.Helper()
+	v, err := NewVerifier(Config{Issuer: testIssuer, Audience: testAudience, Keys: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestVerify(t *testing.T) {
+	keys := newTestKeys(t)
+	v := newTestVerifier(t,
+		HMACKey([]byte(testSecret)),
+		Key{Alg: "RS256", Key: &keys.rsa.PublicKey},
+		Key{Alg: "ES256", Key: &keys.ec.PublicKey},
+	)
+	other := newTestKeys(t)
+
+	with := func(change func(c *jwt.RegisteredClaims)) jwt.RegisteredClaims {
+		c := validClaims()
+		change(&c)
+		return c
+	}
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"HS256", mint(t, jwt.SigningMethodHS256, "", []byte(testSecret), validClaims()), true},
+		{"RS256", mint(t, jwt.SigningMethodRS256, "", keys.rsa, validClaims()), true},
+		{"ES256", mint(t, jwt.SigningMethodES256, "", keys.ec, validClaims()), true},
+		{"second audience", mint(t, jwt.SigningMethodHS256, "", []byte(testSecret), with(func(c *jwt.RegisteredClaims) {
+			c.Audience = jwt.ClaimStrings{"other-api", testAudience}
+		})), true},
+		{"expired", mint(t, jwt.SigningMethodHS256, "", []byte(testSecret), with(func(c *jwt.RegisteredClaims) {
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+		})), false},
+		{"no expiry", mint(t, jwt.SigningMethodHS256, "", []byte(testSecret), with(func(c *jwt.RegisteredClaims) {
+			c.ExpiresAt = nil
+		})), false},
+		{"not yet valid", mint(t, jwt.SigningMethodHS256, "", []byte(testSecret), with(func(c *jwt.RegisteredClaims) {
+			c.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Minute))
+		})), false},
+		{"wrong issuer", mint(t, jwt.SigningMethodHS256, "", []byte(testSecret), with(func(c *jwt.RegisteredClaims) {
+			c.Issuer = "https://evil.example"
+		})), false},
+		{"wrong audience", mint(t, jwt.SigningMethodHS256, "", []byte(testSecret), with(func(c *jwt.RegisteredClaims) {
+			c.Audience = jwt.ClaimStrings{"other-api"}
+		})), false},
+		{"no subject", mint(t, jwt.SigningMethodHS256, "", []byte(testSecret), with(func(c *jwt.RegisteredClaims) {
+			c.Subject = ""
+		})), false},
+		{"wrong secret", mint(t, jwt.SigningMethodHS256, "", []byte("fedcba9876543210fedcba9876543210"), validClaims()), false},
+		{"wrong RSA key", mint(t, jwt.SigningMethodRS256, "", other.rsa, validClaims()), false},
+		{"wrong EC key", mint(t, jwt.SigningMethodES256, "", other.ec, validClaims()), false},
+		{"unconfigured algorithm", mint(t, jwt.SigningMethodHS512, "", []byte(testSecret), validClaims()), false},
+		{"unsigned", mint(t, jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType, validClaims()), false},
+		{"tampered", tamper(mint(t, jwt.SigningMethodES256, "", keys.ec, validClaims())), false},
+		{"garbage", "not.a.token", false},
+	}
+	for _, tt := range tests {
+		claims, err := v.Verify(tt.token)
+		if tt.valid && (err != nil || claims.Subject != "alice") {
+			t.Errorf("%s: expected the token to be accepted, got %v", tt.name, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s: expected the token to be rejected", tt.name)
+		}
+	}
+}
+
+// tamper changes the subject of a token, keeping its signature
+func tamper(token string) string {
+	parts := strings.Split(token, ".")
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	payload = []byte(strings.Replace(string(payload), `"alice"`, `"admin"`, 1))
+	parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+	return strings.Join(parts, ".")
+}
+
+func TestVerify_Leeway(t *testing.T) {
+	v, err := NewVerifier(Config{Keys: []Key{HMACKey([]byte(testSecret))}, Leeway: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := validClaims()
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-30 * time.Second))
+	if _, err := v.Verify(mint(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims)); err != nil {
+		t.Errorf("Expected a token expired within the leeway to be accepted, got %v", err)
+	}
+}
+
+func TestNewVerifier_NoKeys(t *testing.T) {
+	if _, err := NewVerifier(Config{Issuer: testIssuer}); err == nil {
+		t.Error("Expected a verifier without keys to be refused")
+	}
+}
+
+func TestParsePublicKeyPEM(t *testing.T) {
+	keys := newTestKeys(t)
+	for _, tt := range []struct {
+		name string
+		pub  interface{}
+		alg  string
+	}{
+		{"RSA", &keys.rsa.PublicKey, "RS256"},
+		{"EC", &keys.ec.PublicKey, "ES256"},
+	} {
+		der, err := x509.MarshalPKIXPublicKey(tt.pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := ParsePublicKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+		if err != nil || key.Alg != tt.alg {
+			t.Errorf("%s: expected an %s key, got %+v, %v", tt.name, tt.alg, key, err)
+		}
+	}
+
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(&p384.PublicKey)
+	if _, err := ParsePublicKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})); err == nil {
+		t.Error("Expected a P-384 key to be refused")
+	}
+	if _, err := ParsePublicKeyPEM([]byte("not PEM")); err == nil {
+		t.Error("Expected garbage to be refused")
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	keys := newTestKeys(t)
+	b64 := base64.RawURLEncoding.EncodeToString
+	doc, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa-1", "use": "sig", "alg": "RS256", "n": b64(keys.rsa.N.Bytes()), "e": b64(big.NewInt(int64(keys.rsa.E)).Bytes())},
+		{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(keys.ec.X.FillBytes(make([]byte, 32))), "y": b64(keys.ec.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "oct", "kid": "hmac-1", "k": b64([]byte(testSecret))},
+		// skipped: an encryption key and an unsupported curve
+		{"kty": "RSA", "kid": "enc-1", "use": "enc", "n": b64(keys.rsa.N.Bytes()), "e": "AQAB"},
+		{"kty": "EC", "kid": "ec-384", "crv": "P-384", "x": "AA", "y": "AA"},
+	}})
+	parsed, err := ParseJWKS(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 3 {
+		t.Fatalf("Expected 3 keys, got %d", len(parsed))
+	}
+	v := newTestVerifier(t, parsed...)
+
+	for _, tt := range []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"RS256", mint(t, jwt.SigningMethodRS256, "rsa-1", keys.rsa, validClaims()), true},
+		{"ES256", mint(t, jwt.SigningMethodES256, "ec-1", keys.ec, validClaims()), true},
+		{"HS256", mint(t, jwt.SigningMethodHS256, "hmac-1", []byte(testSecret), validClaims()), true},
+		{"no kid", mint(t, jwt.SigningMethodES256, "", keys.ec, validClaims()), true},
+		{"unknown kid", mint(t, jwt.SigningMethodRS256, "rsa-2", keys.rsa, validClaims()), false},
+		{"kid of another algorithm", mint(t, jwt.SigningMethodRS256, "ec-1", keys.rsa, validClaims()), false},
+	} {
+		_, err := v.Verify(tt.token)
+		if tt.valid && err != nil {
+			t.Errorf("%s: expected the token to be accepted, got %v", tt.name, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s: expected the token to be rejected", tt.name)
+		}
+	}
+
+	for _, bad := range []string{
+		`not json`,
+		`{"keys":[{"kty":"RSA","n":"!!","e":"AQAB"}]}`,
+		`{"keys":[{"kty":"EC","crv":"P-256","x":"AAAA","y":"AAAA"}]}`,
+	} {
+		if _, err := ParseJWKS([]byte(bad)); err == nil {
+			t.Errorf("Expected %s to be refused", bad)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Key verifies the tokens signed with one algorithm
+type Key struct {
+	// ID matches the kid header of tokens, a key without one is tried for
+	// every token of its algorithm
+	ID string
+	// Alg is HS256, RS256 or ES256
+	Alg string
+	// Key is the HS256 secret ([]byte), or an *rsa.PublicKey or an
+	// *ecdsa.PublicKey on P-256
+	Key interface{}
+}
+
+// HMACKey returns the key verifying HS256 tokens signed with secret
+func HMACKey(secret []byte) Key {
+	return Key{Alg: "HS256", Key: secret}
+}
+
+// ParsePublicKeyPEM reads an RSA or P-256 ECDSA public key, or the key of a
+// certificate, from PEM, for verifying RS256 or ES256 tokens respectively
+func ParsePublicKeyPEM(data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, errors.New("no PEM block found")
+	}
+	var pub interface{}
+	var err error
+	switch block.Type {
+	case "PUBLIC KEY":
+		pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			pub = cert.PublicKey
+		}
+	default:
+		return Key{}, fmt.Errorf("unexpected PEM block %q", block.Type)
+	}
+	if err != nil {
+		return Key{}, err
+	}
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return Key{Alg: "RS256", Key: pub}, nil
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return Key{}, errors.New("ECDSA keys must be on the P-256 curve")
+		}
+		return Key{Alg: "ES256", Key: pub}, nil
+	}
+	return Key{}, fmt.Errorf("unsupported public key type %T", pub)
+}
+
+// jwk is a JSON Web Key (RFC 7517) with the members of RSA, EC and
+// symmetric keys
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	// symmetric
+	K string `json:"k"`
+}
+
+// ParseJWKS reads the keys of a JWK Set document. Keys for encryption or for
+// algorithms other than HS256, RS256 and ES256 are skipped, malformed keys
+// fail the whole set.
+func ParseJWKS(data []byte) ([]Key, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	var keys []Key
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, ok, err := k.key()
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", i, err)
+		}
+		if ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// key converts a JWK, ok is false for keys of an unsupported type or
+// algorithm
+func (k jwk) key() (key Key, ok bool, err error) {
+	key.ID = k.Kid
+	switch k.Kty {
+	case "oct":
+		key.Alg = "HS256"
+		secret, err := decodeMember("k", k.K)
+		if err != nil {
+			return key, false, err
+		}
+		key.Key = secret
+	case "RSA":
+		key.Alg = "RS256"
+		n, err := decodeMember("n", k.N)
+		if err != nil {
+			return key, false, err
+		}
+		e, err := decodeMember("e", k.E)
+		if err != nil {
+			return key, false, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return key, false, errors.New("invalid RSA exponent")
+		}
+		key.Key = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+	case "EC":
+		if k.Crv != "P-256" {
+			return key, false, nil
+		}
+		key.Alg = "ES256"
+		x, err := decodeMember("x", k.X)
+		if err != nil {
+			return key, false, err
+		}
+		y, err := decodeMember("y", k.Y)
+		if err != nil {
+			return key, false, err
+		}
+		// an uncompressed point, checked to be on the curve
+		point := append([]byte{4}, append(x, y...)...)
+		if len(x) != 32 || len(y) != 32 {
+			return key, false, errors.New("invalid P-256 point")
+		}
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return key, false, errors.New("invalid P-256 point")
+		}
+		key.Key = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	default:
+		return key, false, nil
+	}
+	if k.Alg != "" && k.Alg != key.Alg {
+		return key, false, nil
+	}
+	return key, true, nil
+}
+
+// decodeMember decodes a base64url encoded member of a JWK
+func decodeMember(name, value string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("invalid %q", name)
+	}
+	return b, nil
+}
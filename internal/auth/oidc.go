@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// ErrNoRole is returned for a staff member none of whose groups is mapped
+// to a role
+var ErrNoRole = errors.New("no group grants a role")
+
+// OIDCConfig is the client registration of the app at the identity provider
+// staff log in with
+type OIDCConfig struct {
+	// IssuerURL is where the discovery document is found, under
+	// /.well-known/openid-configuration
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the URL of the login callback, as registered
+	RedirectURL string
+	// GroupsClaim is the ID token claim listing the groups of the staff
+	// member, "groups" when empty. The identity provider must be set up to
+	// include it.
+	GroupsClaim string
+	// GroupRoles maps groups to the roles they grant
+	GroupRoles map[string]Role
+}
+
+// OIDC logs staff in with the authorization code flow and PKCE
+type OIDC struct {
+	oauth       oauth2.Config
+	verifier    *oidc.IDTokenVerifier
+	groupsClaim string
+	groupRoles  map[string]Role
+}
+
+// Identity is a staff member who logged in
+type Identity struct {
+	// Subject is the sub claim of their ID token
+	Subject string
+	// Roles their groups grant
+	Roles []string
+}
+
+// NewOIDC fetches the discovery document of the identity provider. ID
+// tokens are verified against the keys of its JWKS, fetched when needed.
+func NewOIDC(ctx context.Context, cfg OIDCConfig) (*OIDC, error) {
+	provider, err := oidc.NewProvider(ctx, cfg.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	groupsClaim := cfg.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+	return &OIDC{
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+		},
+		verifier:    provider.VerifierContext(ctx, &oidc.Config{ClientID: cfg.ClientID}),
+		groupsClaim: groupsClaim,
+		groupRoles:  cfg.GroupRoles,
+	}, nil
+}
+
+// AuthCodeURL returns the URL of the identity provider starting the login
+// of st
+func (o *OIDC) AuthCodeURL(st LoginState) string {
+	return o.oauth.AuthCodeURL(st.State, oidc.Nonce(st.Nonce), oauth2.S256ChallengeOption(st.Verifier))
+}
+
+// Exchange redeems the code the identity provider returned for the login of
+// st, verifies the ID token it gets and maps the groups of the staff member
+// to roles. It fails with ErrNoRole when no group is mapped.
+func (o *OIDC) Exchange(ctx context.Context, code string, st LoginState) (*Identity, error) {
+	token, err := o.oauth.Exchange(ctx, code, oauth2.VerifierOption(st.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("code exchange failed: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("the token response has no ID token")
+	}
+	idToken, err := o.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+	if idToken.Nonce != st.Nonce {
+		return nil, errors.New("the ID token is for another login")
+	}
+
+	var claims map[string]json.RawMessage
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	// a single group may come as a string
+	var groups jwt.ClaimStrings
+	if raw, ok := claims[o.groupsClaim]; ok {
+		if err := json.Unmarshal(raw, &groups); err != nil {
+			return nil, fmt.Errorf("invalid %s claim: %w", o.groupsClaim, err)
+		}
+	}
+	identity := &Identity{Subject: idToken.Subject, Roles: o.roles(groups)}
+	if len(identity.Roles) == 0 {
+		return nil, ErrNoRole
+	}
+	return identity, nil
+}
+
+// roles returns the roles groups grant, lowest first
+func (o *OIDC) roles(groups []string) []string {
+	roleNames := []string{}
+	for _, role := range roles {
+		for _, group := range groups {
+			if o.groupRoles[group] == role && !slices.Contains(roleNames, string(role)) {
+				roleNames = append(roleNames, string(role))
+			}
+		}
+	}
+	return roleNames
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"slices"
+
+	"digicert-library-app/internal/models"
+)
+
+// Role is what a token holder may do, from the roles claim of their token.
+// Each role includes the ones below it.
+type Role string
+
+const (
+	// RolePatron reads the catalog
+	RolePatron Role = "patron"
+	// RoleLibrarian also changes books and reads the audit log
+	RoleLibrarian Role = "librarian"
+	// RoleAdmin also manages API keys
+	RoleAdmin Role = "admin"
+)
+
+// roles from the lowest to the highest
+var roles = []Role{RolePatron, RoleLibrarian, RoleAdmin}
+
+// Scope is the scope a role adds to the ones below it. API keys hold scopes
+// rather than roles, a key with the scope of a role passes for it.
+func (r Role) Scope() string {
+	switch r {
+	case RolePatron:
+		return models.ScopeBooksRead
+	case RoleLibrarian:
+		return models.ScopeBooksWrite
+	case RoleAdmin:
+		return models.ScopeManageAPIKeys
+	}
+	return ""
+}
+
+// roleScopes returns the scopes of the roles a token claims, unknown roles
+// granting none
+func roleScopes(claimed []string) []string {
+	top := -1
+	for _, role := range claimed {
+		if i := slices.Index(roles, Role(role)); i > top {
+			top = i
+		}
+	}
+	scopes := []string{}
+	for _, role := range roles[:top+1] {
+		scopes = append(scopes, role.Scope())
+	}
+	return scopes
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"digicert-library-app/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRoles(t *testing.T) {
+	secret := []byte(testSecret)
+	authenticator := NewAuthenticator(newTestVerifier(t, HMACKey(secret)), nil)
+
+	tests := []struct {
+		name   string
+		roles  interface{}
+		scopes []string
+	}{
+		{"none", nil, []string{}},
+		{"unknown", []string{"janitor"}, []string{}},
+		{"patron", []string{"patron"}, []string{models.ScopeBooksRead}},
+		{"single string", "librarian", []string{models.ScopeBooksRead, models.ScopeBooksWrite}},
+		{"highest wins", []string{"admin", "patron"}, []string{models.ScopeBooksRead, models.ScopeBooksWrite, models.ScopeManageAPIKeys}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := jwt.MapClaims{"sub": "alice", "iss": testIssuer, "aud": testAudience, "exp": validClaims().ExpiresAt.Unix()}
+			if tt.roles != nil {
+				claims["roles"] = tt.roles
+			}
+			p, err := authenticator.Authenticate(context.Background(), mint(t, jwt.SigningMethodHS256, "", secret, claims))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(p.Scopes, tt.scopes) {
+				t.Errorf("Expected scopes %v, got %v", tt.scopes, p.Scopes)
+			}
+			for _, role := range roles {
+				if p.HasRole(role) != slices.Contains(tt.scopes, role.Scope()) {
+					t.Errorf("Unexpected HasRole(%s) for scopes %v", role, p.Scopes)
+				}
+			}
+		})
+	}
+}
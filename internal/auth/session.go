@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// Cookies of staff who log in with OpenID Connect
+const (
+	// SessionCookie holds the session of a staff member who logged in
+	SessionCookie = "library_session"
+	// LoginCookie holds the LoginState of a login in progress
+	LoginCookie = "library_login"
+)
+
+// LoginTimeout is how long a staff member has to log in at the identity
+// provider
+const LoginTimeout = 10 * time.Minute
+
+// audiences keep a session and a login state from passing for each other
+const (
+	sessionAudience = "library-session"
+	loginAudience   = "library-login"
+)
+
+// LoginState is what the login callback checks the answer of the identity
+// provider against. It's kept in the browser, in a signed cookie.
+type LoginState struct {
+	// State is echoed by the identity provider, tying its answer to this
+	// browser
+	State string `json:"state"`
+	// Nonce is echoed in the ID token, tying it to this login
+	Nonce string `json:"nonce"`
+	// Verifier is the PKCE code verifier the code is exchanged with
+	Verifier string `json:"verifier"`
+	// Next is the local path to return to once logged in
+	Next string `json:"next"`
+}
+
+// NewLoginState returns a login state with fresh random values, returning
+// to next
+func NewLoginState(next string) (LoginState, error) {
+	var random [32]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return LoginState{}, err
+	}
+	st := LoginState{State: base64.RawURLEncoding.EncodeToString(random[:16]), Next: next}
+	st.Nonce = base64.RawURLEncoding.EncodeToString(random[16:])
+	st.Verifier = oauth2.GenerateVerifier()
+	return st, nil
+}
+
+type loginClaims struct {
+	jwt.RegisteredClaims
+	LoginState
+}
+
+// Sessions issues and checks the cookies of staff who log in. Both are
+// HS256 tokens signed with the session key, so any instance sharing the key
+// accepts them.
+type Sessions struct {
+	key []byte
+	ttl time.Duration
+}
+
+// NewSessions returns sessions lasting ttl, signed with key
+func NewSessions(key []byte, ttl time.Duration) (*Sessions, error) {
+	if len(key) < 32 {
+		return nil, errors.New("the session key must be at least 32 bytes long")
+	}
+	if ttl <= 0 {
+		return nil, errors.New("the session lifetime must be positive")
+	}
+	return &Sessions{key: key, ttl: ttl}, nil
+}
+
+// TTL is how long a session lasts
+func (s *Sessions) TTL() time.Duration {
+	return s.ttl
+}
+
+// Issue returns the session of subject, holding roles
+func (s *Sessions) Issue(subject string, roles []string) (string, error) {
+	return s.sign(&Claims{RegisteredClaims: s.registered(subject, sessionAudience, s.ttl), Roles: roles})
+}
+
+// Verify returns the claims of a session it issued that hasn't expired
+func (s *Sessions) Verify(session string) (*Claims, error) {
+	claims := &Claims{}
+	if err := s.parse(session, sessionAudience, claims); err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("session has no subject")
+	}
+	return claims, nil
+}
+
+// IssueLoginState returns the cookie value of a login in progress, valid for
+// LoginTimeout
+func (s *Sessions) IssueLoginState(st LoginState) (string, error) {
+	return s.sign(&loginClaims{RegisteredClaims: s.registered("", loginAudience, LoginTimeout), LoginState: st})
+}
+
+// VerifyLoginState returns the state of a login in progress from its cookie
+func (s *Sessions) VerifyLoginState(value string) (LoginState, error) {
+	claims := &loginClaims{}
+	if err := s.parse(value, loginAudience, claims); err != nil {
+		return LoginState{}, err
+	}
+	return claims.LoginState, nil
+}
+
+func (s *Sessions) registered(subject, audience string, ttl time.Duration) jwt.RegisteredClaims {
+	now := time.Now()
+	return jwt.RegisteredClaims{
+		Subject:   subject,
+		Audience:  jwt.ClaimStrings{audience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+	}
+}
+
+func (s *Sessions) sign(claims jwt.Claims) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.key)
+}
+
+func (s *Sessions) parse(value, audience string, claims jwt.Claims) error {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithAudience(audience),
+	)
+	_, err := parser.ParseWithClaims(value, claims, func(*jwt.Token) (interface{}, error) {
+		return s.key, nil
+	})
+	return err
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestSessions(t *testing.T) {
+	sessions, err := NewSessions([]byte(testSecret), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := sessions.Issue("alice", []string{"librarian"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := sessions.Verify(session)
+	if err != nil || claims.Subject != "alice" || !slices.Equal(claims.Roles, []string{"librarian"}) {
+		t.Errorf("Expected alice's session, got %+v (err: %v)", claims, err)
+	}
+
+	st, err := NewLoginState("/books")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loginState, err := sessions.IssueLoginState(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := sessions.VerifyLoginState(loginState); err != nil || got != st {
+		t.Errorf("Expected the login state back, got %+v (err: %v)", got, err)
+	}
+
+	other, _ := NewSessions([]byte("another-key-of-at-least-32-bytes!"), time.Hour)
+	expired, _ := NewSessions([]byte(testSecret), time.Nanosecond)
+	expiredSession, _ := expired.Issue("alice", []string{"librarian"})
+	time.Sleep(time.Millisecond)
+	token := mint(t, jwt.SigningMethodHS256, "", []byte(testSecret), validClaims())
+
+	for name, value := range map[string]string{
+		"login state": loginState,
+		"another key": mustIssue(t, other),
+		"expired":     expiredSession,
+		"API token":   token,
+		"tampered":    tamper(session),
+		"not a token": "session",
+	} {
+		if _, err := sessions.Verify(value); err == nil {
+			t.Errorf("%s: expected the session to be refused", name)
+		}
+	}
+	if _, err := sessions.VerifyLoginState(session); err == nil {
+		t.Error("Expected a session not to pass for a login state")
+	}
+
+	if _, err := NewSessions([]byte("short"), time.Hour); err == nil {
+		t.Error("Expected a short key to be refused")
+	}
+}
+
+func mustIssue(t *testing.T, s *Sessions) string {
+	t.Helper()
+	session, err := s.Issue("alice", []string{"admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
@@ -0,0 +1,213 @@
+// Package catalog converts books to and from the interchange formats
+// cataloguers work with.
+package catalog
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"digicert-library-app/internal/models"
+)
+
+// CSVColumns are the columns of an export, in order
+var CSVColumns = []string{"id", "title", "author", "published_year", "genre", "isbn", "created_at", "updated_at", "version"}
+
+// ImportFields are the book fields an import can set
+var ImportFields = []string{"title", "author", "published_year", "genre", "isbn"}
+
+// formulaPrefixes start cells spreadsheets would evaluate as formulas
+const formulaPrefixes = "=+-@"
+
+// CSVWriter writes books as CSV rows with the CSVColumns header
+type CSVWriter struct {
+	w *csv.Writer
+}
+
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{w: csv.NewWriter(w)}
+}
+
+func (c *CSVWriter) WriteHeader() error {
+	return c.w.Write(CSVColumns)
+}
+
+func (c *CSVWriter) Write(book models.Book) error {
+	year := ""
+	if book.PublishedYear != 0 {
+		year = strconv.Itoa(book.PublishedYear)
+	}
+	return c.w.Write([]string{
+		book.ID.String(),
+		escapeFormula(book.Title),
+		escapeFormula(book.Author),
+		year,
+		escapeFormula(book.Genre),
+		book.ISBN,
+		book.CreatedAt.UTC().Format(time.RFC3339),
+		book.UpdatedAt.UTC().Format(time.RFC3339),
+		strconv.Itoa(book.Version),
+	})
+}
+
+// Flush writes any buffered rows to the underlying writer
+func (c *CSVWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// escapeFormula quotes text a spreadsheet would run as a formula with a
+// leading apostrophe, which spreadsheets hide and imports strip again
+func escapeFormula(value string) string {
+	if value != "" && strings.ContainsRune(formulaPrefixes, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func unescapeFormula(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune(formulaPrefixes, rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
+
+// Record is a book read from an import, with where it starts (the line of a
+// CSV row, the position of a MARC record) and the problems found in it
+type Record struct {
+	Line   int
+	Book   models.Book
+	Errors []FieldError
+}
+
+// FieldError is a problem with one field of an imported record
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// ParseMapping parses a header mapping such as "Book Title:title,Writer:author"
+// into CSV header names keyed to the ImportFields they fill
+func ParseMapping(spec string) (map[string]string, error) {
+	mapping := map[string]string{}
+	if strings.TrimSpace(spec) == "" {
+		return mapping, nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		header, field, ok := strings.Cut(pair, ":")
+		header, field = strings.TrimSpace(header), strings.TrimSpace(field)
+		if !ok || header == "" {
+			return nil, fmt.Errorf("mapping %q must look like Header:field", pair)
+		}
+		if !slices.Contains(ImportFields, field) {
+			return nil, fmt.Errorf("mapping %q targets unknown field %q, expected one of %s", pair, field, strings.Join(ImportFields, ", "))
+		}
+		mapping[header] = field
+	}
+	return mapping, nil
+}
+
+// ReadCSV reads the books of a CSV file. Its first line names the columns,
+// either after the book fields themselves or as keys of mapping. Columns that
+// map to no field, such as the id and timestamps of an export, are ignored.
+// Malformed CSV fails the whole read, invalid values only their record.
+func ReadCSV(r io.Reader, mapping map[string]string) ([]Record, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("CSV is empty, the first line must name the columns")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// spreadsheets often save UTF-8 with a byte order mark
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		field, ok := mapping[name]
+		if !ok && slices.Contains(ImportFields, strings.ToLower(name)) {
+			field = strings.ToLower(name)
+		}
+		if field == "" {
+			continue
+		}
+		if _, dup := columns[field]; dup {
+			return nil, fmt.Errorf("more than one column maps to %s", field)
+		}
+		columns[field] = i
+	}
+	for _, field := range []string{"title", "author"} {
+		if _, ok := columns[field]; !ok {
+			return nil, fmt.Errorf("no column maps to %s", field)
+		}
+	}
+
+	var records []Record
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(row) == 1 && strings.TrimSpace(row[0]) == "" {
+			continue
+		}
+		records = append(records, parseRecord(line, row, columns))
+	}
+}
+
+// parseRecord builds the book of a CSV row from the columns holding each field
+func parseRecord(line int, row []string, columns map[string]int) Record {
+	record := Record{Line: line}
+	value := func(field string) string {
+		i, ok := columns[field]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return unescapeFormula(strings.TrimSpace(row[i]))
+	}
+
+	record.Book.Title = value("title")
+	record.Book.Author = value("author")
+	record.Book.Genre = value("genre")
+	if record.Book.Title == "" {
+		record.Errors = append(record.Errors, FieldError{"title", "title is required"})
+	}
+	if record.Book.Author == "" {
+		record.Errors = append(record.Errors, FieldError{"author", "author is required"})
+	}
+	if year := value("published_year"); year != "" {
+		n, err := strconv.Atoi(year)
+		if err != nil || n <= 0 {
+			record.Errors = append(record.Errors, FieldError{"published_year", "published_year must be a positive year"})
+		}
+		record.Book.PublishedYear = n
+	}
+	record.parseISBN(value("isbn"))
+	return record
+}
+
+// parseISBN sets the book's ISBN to the normalized form of raw, if any
+func (r *Record) parseISBN(raw string) {
+	if raw == "" {
+		return
+	}
+	isbn, err := NormalizeISBN(raw)
+	if err != nil {
+		r.Errors = append(r.Errors, FieldError{"isbn", err.Error()})
+		return
+	}
+	r.Book.ISBN = isbn
+}
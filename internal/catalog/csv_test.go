@@ -0,0 +1,102 @@
+package catalog
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"digicert-library-app/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+	book := models.Book{
+		ID:            uuid.MustParse("123e4567-e89b-12d3-a456-426614174000"),
+		Title:         "=HYPERLINK(\"http://example.com\")",
+		Author:        "Frank Herbert",
+		PublishedYear: 1965,
+		Genre:         "Sci-Fi, Classic",
+		ISBN:          "9780441172719",
+		CreatedAt:     time.Date(2025, 5, 7, 23, 24, 45, 0, time.UTC),
+		UpdatedAt:     time.Date(2025, 5, 8, 10, 0, 0, 0, time.UTC),
+		Version:       3,
+	}
+
+	var buf bytes.Buffer
+	w := NewCSVWriter(&buf)
+	w.WriteHeader()
+	w.Write(book)
+	if err := w.Flush(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "id,title,author,published_year,genre,isbn,created_at,updated_at,version\n" +
+		"123e4567-e89b-12d3-a456-426614174000,\"'=HYPERLINK(\"\"http://example.com\"\")\",Frank Herbert,1965,\"Sci-Fi, Classic\",9780441172719,2025-05-07T23:24:45Z,2025-05-08T10:00:00Z,3\n"
+	if buf.String() != want {
+		t.Errorf("Unexpected CSV\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	// an export imports back to the same fields, formulas unescaped
+	records, err := ReadCSV(&buf, nil)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("Expected one record, got %+v (err: %v)", records, err)
+	}
+	got := records[0]
+	if got.Line != 2 || len(got.Errors) != 0 || got.Book.Title != book.Title || got.Book.Genre != book.Genre || got.Book.PublishedYear != 1965 || got.Book.ISBN != book.ISBN {
+		t.Errorf("Unexpected record %+v", got)
+	}
+}
+
+func TestReadCSV_Mapping(t *testing.T) {
+	mapping, err := ParseMapping("Book Title:title, Writer:author,Year:published_year")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	input := "\ufeffBook Title,Writer,Year,Shelf\n" +
+		"Dune,Frank Herbert,1965,A1\n" +
+		"\"Emma\",,18xx,B2\n" +
+		"Beloved,Toni Morrison\n"
+
+	records, err := ReadCSV(strings.NewReader(input), mapping)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %+v", records)
+	}
+	if b := records[0].Book; b.Title != "Dune" || b.Author != "Frank Herbert" || b.PublishedYear != 1965 {
+		t.Errorf("Unexpected first book %+v", b)
+	}
+	wantErrors := []FieldError{{"author", "author is required"}, {"published_year", "published_year must be a positive year"}}
+	if records[1].Line != 3 || !reflect.DeepEqual(records[1].Errors, wantErrors) {
+		t.Errorf("Expected errors %v on line 3, got %+v", wantErrors, records[1])
+	}
+	if records[2].Book.Title != "Beloved" || len(records[2].Errors) != 0 {
+		t.Errorf("Expected a short row to leave the missing fields empty, got %+v", records[2])
+	}
+}
+
+func TestReadCSV_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"empty", ""},
+		{"no title column", "name,author\nDune,Frank Herbert\n"},
+		{"two title columns", "title,Title,author\nDune,Dune,Frank Herbert\n"},
+		{"bad quoting", "title,author\n\"Dune,Frank Herbert\n"},
+	}
+	for _, tt := range tests {
+		if _, err := ReadCSV(strings.NewReader(tt.input), nil); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+
+	for _, spec := range []string{"Writer", "Writer:publisher", ":author"} {
+		if _, err := ParseMapping(spec); err == nil {
+			t.Errorf("Expected mapping %q to be rejected", spec)
+		}
+	}
+}
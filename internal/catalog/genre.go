@@ -0,0 +1,56 @@
+package catalog
+
+import (
+	"strings"
+
+	"digicert-library-app/internal/models"
+)
+
+// headingGenres maps words of subject and genre/form headings to the genres
+// of models.Genres, the more specific first: "Science fiction" is Sci-Fi
+// before it's Fiction
+var headingGenres = []struct {
+	word  string
+	genre string
+}{
+	{"science fiction", "Sci-Fi"},
+	{"fantasy", "Fantasy"},
+	{"detective", "Mystery"},
+	{"mystery", "Mystery"},
+	{"thriller", "Thriller"},
+	{"suspense", "Thriller"},
+	{"horror", "Horror"},
+	{"love stories", "Romance"},
+	{"romance", "Romance"},
+	{"historical fiction", "Historical"},
+	{"graphic novels", "Comics"},
+	{"comic", "Comics"},
+	{"young adult", "Young Adult"},
+	{"juvenile", "Children"},
+	{"children's", "Children"},
+	{"poetry", "Poetry"},
+	{"drama", "Drama"},
+	{"biograph", "Biography"},
+	{"self-help", "Self-Help"},
+	{"philosophy", "Philosophy"},
+	{"encyclopedias", "Reference"},
+	{"dictionaries", "Reference"},
+	{"history", "History"},
+	{"fiction", "Fiction"},
+}
+
+// GenreFromHeading returns the genre of models.Genres a heading such as
+// "Domestic fiction" or "Science fiction, Polish" files the book under, or ""
+// when it doesn't match one
+func GenreFromHeading(heading string) string {
+	if genre, ok := models.CanonicalGenre(heading); ok {
+		return genre
+	}
+	heading = strings.ToLower(heading)
+	for _, hg := range headingGenres {
+		if strings.Contains(heading, hg.word) {
+			return hg.genre
+		}
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+package catalog
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	errISBNLength   = errors.New("ISBN must have 10 or 13 digits")
+	errISBNDigits   = errors.New("ISBN may only contain digits, hyphens and spaces, and a final X for ISBN-10")
+	errISBNPrefix   = errors.New("ISBN-13 must start with 978 or 979")
+	errISBNChecksum = errors.New("ISBN check digit is wrong")
+)
+
+// NormalizeISBN validates an ISBN-10 or ISBN-13, with or without hyphens and
+// spaces, and returns it as the 13 digits of its ISBN-13 form, so the same
+// book always has the same ISBN
+func NormalizeISBN(raw string) (string, error) {
+	isbn := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(raw))
+	switch len(isbn) {
+	case 10:
+		sum := 0
+		for i, r := range isbn {
+			digit := int(r - '0')
+			if r == 'X' && i == 9 {
+				digit = 10
+			} else if r < '0' || r > '9' {
+				return "", errISBNDigits
+			}
+			sum += (10 - i) * digit
+		}
+		if sum%11 != 0 {
+			return "", errISBNChecksum
+		}
+		isbn = "978" + isbn[:9]
+		return isbn + string(rune('0'+isbn13CheckDigit(isbn))), nil
+	case 13:
+		for _, r := range isbn {
+			if r < '0' || r > '9' {
+				return "", errISBNDigits
+			}
+		}
+		if !strings.HasPrefix(isbn, "978") && !strings.HasPrefix(isbn, "979") {
+			return "", errISBNPrefix
+		}
+		if int(isbn[12]-'0') != isbn13CheckDigit(isbn[:12]) {
+			return "", errISBNChecksum
+		}
+		return isbn, nil
+	}
+	return "", errISBNLength
+}
+
+// isbn13CheckDigit computes the EAN-13 check digit of the first 12 digits,
+// weighted alternately 1 and 3
+func isbn13CheckDigit(digits string) int {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += weight * int(digits[i]-'0')
+	}
+	return (10 - sum%10) % 10
+}
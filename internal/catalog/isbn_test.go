@@ -0,0 +1,32 @@
+package catalog
+
+import "testing"
+
+func TestNormalizeISBN(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{"9780441172719", "9780441172719", false},
+		{"978-0-441-17271-9", "9780441172719", false},
+		{"0441172717", "9780441172719", false},
+		{"0 441 17271 7", "9780441172719", false},
+		// X is a check digit of 10
+		{"080442957X", "9780804429573", false},
+		{"080442957x", "9780804429573", false},
+		{"9791034304813", "9791034304813", false},
+		{"0441172718", "", true},
+		{"9780441172718", "", true},
+		{"X441172717", "", true},
+		{"9770441172719", "", true},
+		{"97804411727", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeISBN(tt.raw)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("NormalizeISBN(%q) = %q, %v, want %q (error: %v)", tt.raw, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MARC 21 delimiters
+const (
+	subfieldDelimiter = 0x1F
+	fieldTerminator   = 0x1E
+	recordTerminator  = 0x1D
+)
+
+// MARCXMLNamespace is the namespace of MARCXML documents
+const MARCXMLNamespace = "http://www.loc.gov/MARC21/slim"
+
+// marcRecord is a MARC 21 bibliographic record, decoded from either syntax
+type marcRecord struct {
+	Leader        string             `xml:"leader"`
+	ControlFields []marcControlField `xml:"controlfield"`
+	DataFields    []marcDataField    `xml:"datafield"`
+}
+
+type marcControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type marcDataField struct {
+	Tag       string         `xml:"tag,attr"`
+	Ind1      string         `xml:"ind1,attr"`
+	Ind2      string         `xml:"ind2,attr"`
+	Subfields []marcSubfield `xml:"subfield"`
+}
+
+type marcSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+// ReadMARC reads a stream of binary MARC 21 (ISO 2709) records. Records are
+// numbered from 1 in the Line of the result. Only UTF-8 records are
+// supported, MARC-8 ones are reported as invalid unless they are plain ASCII.
+func ReadMARC(r io.Reader) ([]Record, error) {
+	reader := bufio.NewReader(r)
+	var records []Record
+	for n := 1; ; n++ {
+		raw, err := reader.ReadBytes(recordTerminator)
+		if err == io.EOF && len(bytes.TrimSpace(raw)) == 0 {
+			return records, nil
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if err == io.EOF {
+			return nil, fmt.Errorf("record %d is truncated", n)
+		}
+		rec, err := parseMARC(raw)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", n, err)
+		}
+		records = append(records, recordFromMARC(n, rec))
+	}
+}
+
+// parseMARC decodes one ISO 2709 record, terminator included
+func parseMARC(raw []byte) (marcRecord, error) {
+	var rec marcRecord
+	if len(raw) < 25 {
+		return rec, errors.New("record is shorter than its leader")
+	}
+	leader := raw[:24]
+	length, err := strconv.Atoi(string(leader[0:5]))
+	if err != nil || length != len(raw) {
+		return rec, fmt.Errorf("record length %q doesn't match the %d bytes read", leader[0:5], len(raw))
+	}
+	base, err := strconv.Atoi(string(leader[12:17]))
+	if err != nil || base < 25 || base > len(raw) {
+		return rec, fmt.Errorf("invalid base address of data %q", leader[12:17])
+	}
+	if leader[9] != 'a' && !isASCII(raw) {
+		return rec, errors.New("MARC-8 encoded records aren't supported, convert them to UTF-8")
+	}
+	rec.Leader = string(leader)
+
+	directory := raw[24 : base-1]
+	if len(directory)%12 != 0 {
+		return rec, errors.New("malformed directory")
+	}
+	data := raw[base:]
+	for i := 0; i < len(directory); i += 12 {
+		entry := directory[i : i+12]
+		tag := string(entry[0:3])
+		fieldLength, err1 := strconv.Atoi(string(entry[3:7]))
+		start, err2 := strconv.Atoi(string(entry[7:12]))
+		if err1 != nil || err2 != nil || start+fieldLength > len(data) || fieldLength == 0 {
+			return rec, fmt.Errorf("malformed directory entry for field %s", tag)
+		}
+		field := data[start : start+fieldLength-1] // without the terminator
+		if !utf8.Valid(field) {
+			return rec, fmt.Errorf("field %s isn't valid UTF-8", tag)
+		}
+
+		if strings.HasPrefix(tag, "00") {
+			rec.ControlFields = append(rec.ControlFields, marcControlField{Tag: tag, Value: string(field)})
+			continue
+		}
+		if len(field) < 2 {
+			return rec, fmt.Errorf("field %s has no indicators", tag)
+		}
+		df := marcDataField{Tag: tag, Ind1: string(field[0]), Ind2: string(field[1])}
+		for _, sub := range bytes.Split(field[2:], []byte{subfieldDelimiter}) {
+			if len(sub) == 0 {
+				continue
+			}
+			df.Subfields = append(df.Subfields, marcSubfield{Code: string(sub[0]), Value: string(sub[1:])})
+		}
+		rec.DataFields = append(rec.DataFields, df)
+	}
+	return rec, nil
+}
+
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadMARCXML reads the records of a MARCXML collection, or a single record
+// document. Records are numbered from 1 in the Line of the result.
+func ReadMARCXML(r io.Reader) ([]Record, error) {
+	dec := xml.NewDecoder(r)
+	var records []Record
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			if records == nil {
+				return nil, errors.New("no MARCXML record found")
+			}
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+		if start.Name.Space != MARCXMLNamespace {
+			return nil, fmt.Errorf("record element must be in the %s namespace", MARCXMLNamespace)
+		}
+		var rec marcRecord
+		if err := dec.DecodeElement(&rec, &start); err != nil {
+			return nil, err
+		}
+		records = append(records, recordFromMARC(len(records)+1, rec))
+	}
+}
+
+// field returns the first data field with one of the tags, tried in order,
+// that matches keep
+func (rec marcRecord) field(keep func(marcDataField) bool, tags ...string) (marcDataField, bool) {
+	for _, tag := range tags {
+		for _, df := range rec.DataFields {
+			if df.Tag == tag && (keep == nil || keep(df)) {
+				return df, true
+			}
+		}
+	}
+	return marcDataField{}, false
+}
+
+func (rec marcRecord) controlField(tag string) string {
+	for _, cf := range rec.ControlFields {
+		if cf.Tag == tag {
+			return cf.Value
+		}
+	}
+	return ""
+}
+
+// subfield returns the first subfield with the code
+func (df marcDataField) subfield(code string) string {
+	for _, sf := range df.Subfields {
+		if sf.Code == code {
+			return strings.TrimSpace(sf.Value)
+		}
+	}
+	return ""
+}
+
+var yearPattern = regexp.MustCompile(`\d{4}`)
+
+// recordFromMARC maps a MARC record onto a book: 245 $a $b title, 100 $a
+// author, 264 (publication) or 260 $c date, 655 or 650 genre and 020 $a
+// ISBN. Headings are free text, the genre is the first one GenreFromHeading
+// maps and is left empty when none does.
+func recordFromMARC(n int, rec marcRecord) Record {
+	record := Record{Line: n}
+
+	if df, ok := rec.field(nil, "245"); ok {
+		title := trimISBD(df.subfield("a"))
+		if subtitle := trimISBD(df.subfield("b")); subtitle != "" {
+			title += ": " + subtitle
+		}
+		record.Book.Title = title
+	}
+	if df, ok := rec.field(nil, "100"); ok {
+		record.Book.Author = trimName(df.subfield("a"))
+	}
+
+	// 264 second indicator 1 is the publication statement
+	isPublication := func(df marcDataField) bool { return df.Tag != "264" || df.Ind2 == "1" }
+	if df, ok := rec.field(isPublication, "264", "260"); ok {
+		if year := yearPattern.FindString(df.subfield("c")); year != "" {
+			record.Book.PublishedYear, _ = strconv.Atoi(year)
+		}
+	}
+	if record.Book.PublishedYear == 0 {
+		// 008/07-10 holds the first date in the fixed length data
+		if f008 := rec.controlField("008"); len(f008) >= 11 {
+			if year, err := strconv.Atoi(f008[7:11]); err == nil && year > 0 {
+				record.Book.PublishedYear = year
+			}
+		}
+	}
+	record.Book.Genre = rec.genre()
+	if df, ok := rec.field(nil, "020"); ok {
+		// "0441172717 (pbk.)" qualifies the number
+		if fields := strings.Fields(df.subfield("a")); len(fields) > 0 {
+			record.parseISBN(fields[0])
+		}
+	}
+
+	if record.Book.Title == "" {
+		record.Errors = append(record.Errors, FieldError{"title", "title is required, 245 $a is missing"})
+	}
+	if record.Book.Author == "" {
+		record.Errors = append(record.Errors, FieldError{"author", "author is required, 100 $a is missing"})
+	}
+	return record
+}
+
+// genre maps the 655 genre/form headings, then the 650 subject headings, $a
+// and then their $v form subdivisions ("Dune (Imaginary place) $v Fiction")
+func (rec marcRecord) genre() string {
+	for _, tag := range []string{"655", "650"} {
+		for _, df := range rec.DataFields {
+			if df.Tag != tag {
+				continue
+			}
+			for _, code := range []string{"a", "v"} {
+				if genre := GenreFromHeading(trimISBD(df.subfield(code))); genre != "" {
+					return genre
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// trimISBD strips the ISBD punctuation cataloguers end subfields with
+func trimISBD(value string) string {
+	return strings.TrimSpace(strings.TrimRight(strings.TrimSpace(value), " /:;,.="))
+}
+
+// trimName strips the punctuation ending a name heading, keeping the period
+// of a final initial such as "Tolkien, J. R. R."
+func trimName(value string) string {
+	value = strings.TrimRight(strings.TrimSpace(value), " ,")
+	if strings.HasSuffix(value, ".") {
+		words := strings.Fields(value)
+		if last := words[len(words)-1]; utf8.RuneCountInString(last) != 2 {
+			value = strings.TrimSuffix(value, ".")
+		}
+	}
+	return value
+}
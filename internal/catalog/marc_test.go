@@ -0,0 +1,168 @@
+package catalog
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"digicert-library-app/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestReadMARC(t *testing.T) {
+	f, err := os.Open("testdata/books.mrc")
+	if err != nil {
+		t.Fatalf("failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	records, err := ReadMARC(f)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Record{
+		{
+			Line: 1,
+			Book: models.Book{Title: "Dune", Author: "Herbert, Frank", PublishedYear: 1965, Genre: "Sci-Fi", ISBN: "9780441172719"},
+		},
+		{
+			// 264 _1 is the publication, not the 264 _4 copyright date
+			Line: 2,
+			Book: models.Book{Title: "Solaris", Author: "Lem, Stanisław", PublishedYear: 2011, Genre: "Sci-Fi", ISBN: "9780156027601"},
+		},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("Unexpected records\n%+v\nwant\n%+v", records, want)
+	}
+}
+
+func TestReadMARCXML(t *testing.T) {
+	f, err := os.Open("testdata/books.xml")
+	if err != nil {
+		t.Fatalf("failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	records, err := ReadMARCXML(f)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Record{
+		{
+			// no publication field, the year comes from 008
+			Line: 1,
+			Book: models.Book{Title: "Emma: a novel", Author: "Austen, Jane", PublishedYear: 1815, Genre: "Fiction"},
+		},
+		{
+			Line:   2,
+			Book:   models.Book{Title: "Beowulf", PublishedYear: 1999},
+			Errors: []FieldError{{"author", "author is required, 100 $a is missing"}},
+		},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("Unexpected records\n%+v\nwant\n%+v", records, want)
+	}
+}
+
+func TestReadMARC_Errors(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/books.mrc")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	// Solaris, the second record, has non-ASCII characters
+	marc8 := bytes.Replace(fixture, []byte("nam a22"), []byte("nam  22"), 2)
+
+	tests := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{"truncated", fixture[:100], "record 1 is truncated"},
+		{"wrong length", append([]byte("99999"), fixture[5:351]...), "record length"},
+		{"marc-8", marc8, "record 2: MARC-8"},
+	}
+	for _, tt := range tests {
+		if _, err := ReadMARC(bytes.NewReader(tt.input)); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	if _, err := ReadMARCXML(strings.NewReader(`<collection><record/></collection>`)); err == nil {
+		t.Error("Expected records outside the MARCXML namespace to be rejected")
+	}
+}
+
+func TestMARCXMLWriter(t *testing.T) {
+	books := []models.Book{
+		{
+			ID:            uuid.MustParse("123e4567-e89b-12d3-a456-426614174000"),
+			Title:         "Dune",
+			Author:        "Herbert, Frank",
+			PublishedYear: 1965,
+			Genre:         "Sci-Fi",
+			ISBN:          "9780441172719",
+			CreatedAt:     time.Date(2025, 5, 7, 23, 24, 45, 0, time.UTC),
+			UpdatedAt:     time.Date(2025, 5, 8, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			ID:        uuid.MustParse("123e4567-e89b-12d3-a456-426614174001"),
+			Title:     "Beowulf & Grendel",
+			Author:    "Anonymous",
+			CreatedAt: time.Date(2025, 5, 7, 23, 24, 45, 0, time.UTC),
+			UpdatedAt: time.Date(2025, 5, 7, 23, 24, 45, 0, time.UTC),
+		},
+	}
+
+	var buf bytes.Buffer
+	w := NewMARCXMLWriter(&buf)
+	w.WriteHeader()
+	for _, book := range books {
+		w.Write(book)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want, err := os.ReadFile("testdata/export.xml")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	if buf.String() != string(want) {
+		t.Errorf("Unexpected MARCXML\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	// the export reads back to the same books
+	records, err := ReadMARCXML(&buf)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %+v (err: %v)", records, err)
+	}
+	for i, record := range records {
+		b := books[i]
+		if record.Book.Title != b.Title || record.Book.Author != b.Author || record.Book.PublishedYear != b.PublishedYear || record.Book.Genre != b.Genre || record.Book.ISBN != b.ISBN {
+			t.Errorf("Record %d doesn't round trip: %+v", i+1, record.Book)
+		}
+	}
+}
+
+func TestGenreFromHeading(t *testing.T) {
+	for heading, want := range map[string]string{
+		"romance":                       "Romance",
+		"Science fiction, Polish":       "Sci-Fi",
+		"Domestic fiction":              "Fiction",
+		"Detective and mystery stories": "Mystery",
+		"Historical fiction":            "Historical",
+		"Juvenile fiction":              "Children",
+		"Autobiographies":               "Biography",
+		"Epic poetry, English (Old)":    "Poetry",
+		"Arrakis (Imaginary place)":     "",
+		"":                              "",
+	} {
+		if got := GenreFromHeading(heading); got != want {
+			t.Errorf("GenreFromHeading(%q) = %q, want %q", heading, got, want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package catalog
+
+import (
+	"bufio"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"time"
+
+	"digicert-library-app/internal/models"
+)
+
+// marcLeader is the leader of exported records: a new (n) language material
+// (a) monograph (m) in UTF-8 (a), cataloged at minimal level (7) without
+// ISBD punctuation (c). The length and base address are left zero, MARCXML
+// doesn't use them.
+const marcLeader = "00000nam a22000007c 4500"
+
+// MARCXMLWriter writes books as the records of a MARCXML collection
+type MARCXMLWriter struct {
+	w   *bufio.Writer
+	enc *xml.Encoder
+}
+
+func NewMARCXMLWriter(w io.Writer) *MARCXMLWriter {
+	bw := bufio.NewWriter(w)
+	enc := xml.NewEncoder(bw)
+	enc.Indent("", "  ")
+	return &MARCXMLWriter{w: bw, enc: enc}
+}
+
+// WriteHeader opens the collection, Close ends it
+func (m *MARCXMLWriter) WriteHeader() error {
+	if _, err := m.w.WriteString(xml.Header); err != nil {
+		return err
+	}
+	return m.enc.EncodeToken(xml.StartElement{
+		Name: xml.Name{Local: "collection"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: MARCXMLNamespace}},
+	})
+}
+
+func (m *MARCXMLWriter) Write(book models.Book) error {
+	return m.enc.EncodeElement(marcFromBook(book), xml.StartElement{Name: xml.Name{Local: "record"}})
+}
+
+// Flush writes any buffered records to the underlying writer
+func (m *MARCXMLWriter) Flush() error {
+	if err := m.enc.Flush(); err != nil {
+		return err
+	}
+	return m.w.Flush()
+}
+
+// Close ends the collection and flushes it
+func (m *MARCXMLWriter) Close() error {
+	if err := m.enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "collection"}}); err != nil {
+		return err
+	}
+	if err := m.enc.Flush(); err != nil {
+		return err
+	}
+	if _, err := m.w.WriteString("\n"); err != nil {
+		return err
+	}
+	return m.w.Flush()
+}
+
+// marcFromBook maps a book onto a MARC record, the reverse of recordFromMARC
+func marcFromBook(book models.Book) marcRecord {
+	rec := marcRecord{Leader: marcLeader}
+	rec.ControlFields = []marcControlField{
+		{Tag: "001", Value: book.ID.String()},
+		{Tag: "005", Value: book.UpdatedAt.UTC().Format("20060102150405") + ".0"},
+		{Tag: "008", Value: fixedLengthData(book)},
+	}
+
+	// 100 first indicator 1 is a surname first name, 0 a forename only
+	nameForm := "0"
+	for _, r := range book.Author {
+		if r == ',' {
+			nameForm = "1"
+			break
+		}
+	}
+	if book.ISBN != "" {
+		rec.DataFields = append(rec.DataFields, marcDataField{Tag: "020", Ind1: " ", Ind2: " ", Subfields: []marcSubfield{{Code: "a", Value: book.ISBN}}})
+	}
+	rec.DataFields = append(rec.DataFields,
+		marcDataField{Tag: "100", Ind1: nameForm, Ind2: " ", Subfields: []marcSubfield{{Code: "a", Value: book.Author}}},
+		marcDataField{Tag: "245", Ind1: "1", Ind2: "0", Subfields: []marcSubfield{{Code: "a", Value: book.Title}}},
+	)
+	if book.PublishedYear != 0 {
+		rec.DataFields = append(rec.DataFields, marcDataField{Tag: "264", Ind1: " ", Ind2: "1", Subfields: []marcSubfield{{Code: "c", Value: strconv.Itoa(book.PublishedYear)}}})
+	}
+	if book.Genre != "" {
+		// second indicator 4: the term comes from no particular thesaurus
+		rec.DataFields = append(rec.DataFields, marcDataField{Tag: "655", Ind1: " ", Ind2: "4", Subfields: []marcSubfield{{Code: "a", Value: book.Genre}}})
+	}
+	return rec
+}
+
+// fixedLengthData renders the 40 characters of field 008 for a book: the
+// date the record was entered, a single known date of publication and blanks
+// (no attempt to code) elsewhere
+func fixedLengthData(book models.Book) string {
+	date1, dateType := "    ", "n"
+	if book.PublishedYear > 0 && book.PublishedYear < 10000 {
+		date1, dateType = strconv.Itoa(book.PublishedYear), "s"
+		for len(date1) < 4 {
+			date1 = "0" + date1
+		}
+	}
+	created := book.CreatedAt
+	if created.IsZero() {
+		created = time.Now()
+	}
+	// 00-05 entered, 06 date type, 07-10 date 1, 11-14 date 2, 15-34 blanks,
+	// 35-37 language (undetermined), 38 modified record, 39 source
+	return created.UTC().Format("060102") + dateType + date1 + "    " + "                    " + "und" + " " + "d"
+}
@@ -0,0 +1,147 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"digicert-library-app/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// APIKeyStore keeps the API keys integrations authenticate with. Backends
+// report a missing key with sql.ErrNoRows.
+type APIKeyStore interface {
+	// CreateAPIKey stores key under a freshly generated ID and returns the
+	// stored key
+	CreateAPIKey(ctx context.Context, key models.APIKey) (models.APIKey, error)
+	// ListAPIKeys returns every key, revoked ones included, oldest first
+	ListAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	// GetAPIKeyByPrefix returns the key with the given prefix, revoked or not
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (models.APIKey, error)
+	// RotateAPIKey gives a key that isn't revoked a new prefix, salt and
+	// hash, so its previous secret stops working
+	RotateAPIKey(ctx context.Context, id, prefix, salt, hash string) (models.APIKey, error)
+	// RevokeAPIKey revokes a key for good, failing with sql.ErrNoRows when
+	// it's already revoked
+	RevokeAPIKey(ctx context.Context, id string) (models.APIKey, error)
+	// TouchAPIKey records that a key was just used
+	TouchAPIKey(ctx context.Context, id string) error
+}
+
+// Store is everything the API keeps: books, their audit log and API keys
+type Store interface {
+	BookStore
+	APIKeyStore
+}
+
+// Compile time check that the SQL backed Database satisfies Store
+var _ Store = (*Database)(nil)
+
+const apiKeyColumns = "id, name, prefix, salt, hash, scopes, created_by, created_at, rotated_at, last_used_at, revoked_at"
+
+func (d *Database) CreateAPIKey(ctx context.Context, key models.APIKey) (models.APIKey, error) {
+	id := uuid.New()
+	query := "INSERT INTO api_keys (id, name, prefix, salt, hash, scopes, created_by) VALUES (?, ?, ?, ?, ?, ?, ?)"
+	_, err := d.Conn.ExecContext(ctx, d.dialect().rebind(query),
+		id.String(), key.Name, key.Prefix, key.Salt, key.Hash, strings.Join(key.Scopes, " "), key.CreatedBy)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	return d.getAPIKey(ctx, d.Conn, "id", id.String())
+}
+
+func (d *Database) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	keys := []models.APIKey{}
+	rows, err := d.Conn.QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys ORDER BY created_at ASC, id ASC")
+	if err != nil {
+		return keys, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return keys, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (d *Database) GetAPIKeyByPrefix(ctx context.Context, prefix string) (models.APIKey, error) {
+	return d.getAPIKey(ctx, d.Conn, "prefix", prefix)
+}
+
+func (d *Database) RotateAPIKey(ctx context.Context, id, prefix, salt, hash string) (models.APIKey, error) {
+	query := "UPDATE api_keys SET prefix = ?, salt = ?, hash = ?, rotated_at = CURRENT_TIMESTAMP WHERE id = ? AND revoked_at IS NULL"
+	return d.updateAPIKey(ctx, id, query, prefix, salt, hash, id)
+}
+
+func (d *Database) RevokeAPIKey(ctx context.Context, id string) (models.APIKey, error) {
+	query := "UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND revoked_at IS NULL"
+	return d.updateAPIKey(ctx, id, query, id)
+}
+
+func (d *Database) TouchAPIKey(ctx context.Context, id string) error {
+	query := "UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?"
+	_, err := d.Conn.ExecContext(ctx, d.dialect().rebind(query), id)
+	return err
+}
+
+// updateAPIKey runs an UPDATE of the key id and returns the updated key, or
+// sql.ErrNoRows when the update matched no row
+func (d *Database) updateAPIKey(ctx context.Context, id, query string, args ...interface{}) (models.APIKey, error) {
+	var key models.APIKey
+	err := d.inTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, d.dialect().rebind(query), args...)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return sql.ErrNoRows
+		}
+		key, err = d.getAPIKey(ctx, tx, "id", id)
+		return err
+	})
+	return key, err
+}
+
+// queryRower is what getAPIKey needs of a connection or a transaction
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// getAPIKey reads the key whose column (id or prefix) holds value
+func (d *Database) getAPIKey(ctx context.Context, db queryRower, column, value string) (models.APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM api_keys WHERE " + column + " = ?"
+	return scanAPIKey(db.QueryRowContext(ctx, d.dialect().rebind(query), value))
+}
+
+// scanAPIKey scans the apiKeyColumns columns
+func scanAPIKey(scanner bookScanner) (models.APIKey, error) {
+	var key models.APIKey
+	var scopes string
+	var createdAt, rotatedAt, lastUsedAt, revokedAt sql.NullTime
+	err := scanner.Scan(&key.ID, &key.Name, &key.Prefix, &key.Salt, &key.Hash, &scopes, &key.CreatedBy,
+		&createdAt, &rotatedAt, &lastUsedAt, &revokedAt)
+	key.Scopes = strings.Fields(scopes)
+	key.CreatedAt = createdAt.Time.UTC()
+	key.RotatedAt = nullTimePtr(rotatedAt)
+	key.LastUsedAt = nullTimePtr(lastUsedAt)
+	key.RevokedAt = nullTimePtr(revokedAt)
+	return key, err
+}
+
+// nullTimePtr returns the UTC time of a nullable column, nil for NULL
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	utc := t.Time.UTC()
+	return &utc
+}
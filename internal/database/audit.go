@@ -0,0 +1,132 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/requestctx"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// unknownActor is recorded for changes made without an actor in the context
+const unknownActor = "unknown"
+
+// newAuditEntry describes the change of a book from before to after, either
+// being nil when the book didn't exist on that side. The actor and request id
+// come from ctx.
+func newAuditEntry(ctx context.Context, action string, id uuid.UUID, before, after *models.Book) models.AuditEntry {
+	actor := requestctx.Actor(ctx)
+	if actor == "" {
+		actor = unknownActor
+	}
+	return models.AuditEntry{
+		BookID:    id,
+		Action:    action,
+		Actor:     actor,
+		RequestID: requestctx.RequestID(ctx),
+		Changes:   auditChanges(before, after),
+	}
+}
+
+// auditFields are the book fields whose changes are recorded. The id and the
+// bookkeeping columns are left out, they change on every write.
+var auditFields = []string{"title", "author", "published_year", "genre", "isbn", "deleted_at"}
+
+// auditChanges returns the fields that differ between two states of a book
+func auditChanges(before, after *models.Book) map[string]models.FieldChange {
+	old, updated := auditSnapshot(before), auditSnapshot(after)
+	changes := map[string]models.FieldChange{}
+	for _, field := range auditFields {
+		if old[field] != updated[field] {
+			changes[field] = models.FieldChange{Before: old[field], After: updated[field]}
+		}
+	}
+	return changes
+}
+
+// auditSnapshot maps the audited fields of a book to comparable values, nil
+// for unset ones
+func auditSnapshot(book *models.Book) map[string]interface{} {
+	snapshot := map[string]interface{}{}
+	if book == nil {
+		return snapshot
+	}
+	snapshot["title"] = book.Title
+	if book.Author != "" {
+		snapshot["author"] = book.Author
+	}
+	if book.PublishedYear != 0 {
+		snapshot["published_year"] = book.PublishedYear
+	}
+	if book.Genre != "" {
+		snapshot["genre"] = book.Genre
+	}
+	if book.ISBN != "" {
+		snapshot["isbn"] = book.ISBN
+	}
+	if book.DeletedAt != nil {
+		snapshot["deleted_at"] = book.DeletedAt.UTC().Format(time.RFC3339)
+	}
+	return snapshot
+}
+
+// writeAudit records entry within tx, the transaction of the change it
+// describes
+func (d *Database) writeAudit(ctx context.Context, tx *sql.Tx, entry models.AuditEntry) error {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+	query := "INSERT INTO book_audit (book_id, action, actor, request_id, changes) VALUES (?, ?, ?, ?, ?)"
+	_, err = tx.ExecContext(ctx, d.dialect().rebind(query), entry.BookID.String(), entry.Action, entry.Actor, entry.RequestID, string(changes))
+	return err
+}
+
+func (d *Database) GetAuditLog(ctx context.Context, q models.AuditQuery) ([]models.AuditEntry, error) {
+	entries := []models.AuditEntry{}
+	var conditions []string
+	var args []interface{}
+	if q.Filter.BookID != "" {
+		conditions = append(conditions, "book_id = ?")
+		args = append(args, q.Filter.BookID)
+	}
+	if q.Filter.Actor != "" {
+		conditions = append(conditions, "actor = ?")
+		args = append(args, q.Filter.Actor)
+	}
+	if !q.Filter.Since.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, d.dialect().timeArg(q.Filter.Since))
+	}
+	query := "SELECT id, book_id, action, actor, request_id, changes, created_at FROM book_audit" +
+		joinConditions(conditions) + " ORDER BY id ASC LIMIT ? OFFSET ?"
+	args = append(args, q.Limit, q.Offset)
+
+	rows, err := d.Conn.QueryContext(ctx, d.dialect().rebind(query), args...)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.AuditEntry
+		var changes string
+		var createdAt sql.NullTime
+		if err := rows.Scan(&entry.ID, &entry.BookID, &entry.Action, &entry.Actor, &entry.RequestID, &changes, &createdAt); err != nil {
+			return entries, err
+		}
+		// numbers stay json.Number so years render as integers
+		dec := json.NewDecoder(bytes.NewReader([]byte(changes)))
+		dec.UseNumber()
+		if err := dec.Decode(&entry.Changes); err != nil {
+			return entries, err
+		}
+		entry.CreatedAt = createdAt.Time.UTC()
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
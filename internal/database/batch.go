@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"digicert-library-app/internal/models"
+	"errors"
+	"fmt"
+)
+
+// ErrBatchAborted is the result of every other operation of an atomic batch
+// once one of its operations failed, nothing of the batch was stored
+var ErrBatchAborted = errors.New("batch aborted by a failed operation")
+
+// OperationResult is the outcome of one operation of a batch: the book it
+// left behind, or why it failed
+type OperationResult struct {
+	Book models.Book
+	Err  error
+}
+
+// errRollback rolls back an atomic batch without failing ApplyBatch, the
+// failure is reported in the results
+var errRollback = errors.New("rollback")
+
+func (d *Database) ApplyBatch(ctx context.Context, ops []models.BatchOperation, atomic bool) ([]OperationResult, error) {
+	results := make([]OperationResult, len(ops))
+	err := d.inTx(ctx, func(tx *sql.Tx) error {
+		for i, op := range ops {
+			if atomic {
+				results[i].Book, results[i].Err = d.applyOperation(ctx, tx, op)
+				if results[i].Err != nil {
+					abortBatch(results, i)
+					return errRollback
+				}
+				continue
+			}
+
+			err := d.inSavepoint(ctx, tx, func() (err error) {
+				results[i].Book, err = d.applyOperation(ctx, tx, op)
+				return err
+			})
+			var opErr *savepointError
+			if errors.As(err, &opErr) {
+				results[i] = OperationResult{Err: opErr.err}
+			} else if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil && err != errRollback {
+		return nil, err
+	}
+	return results, nil
+}
+
+// applyOperation performs one batch operation within tx
+func (d *Database) applyOperation(ctx context.Context, tx *sql.Tx, op models.BatchOperation) (models.Book, error) {
+	if op.Book == nil && op.Op != models.BatchDelete {
+		return models.Book{}, fmt.Errorf("batch %s needs a book", op.Op)
+	}
+	switch op.Op {
+	case models.BatchCreate:
+		return d.createBook(ctx, tx, *op.Book)
+	case models.BatchUpdate:
+		return d.updateBook(ctx, tx, op.ID, *op.Book, op.Version)
+	case models.BatchDelete:
+		return d.deleteBook(ctx, tx, op.ID, op.Version)
+	}
+	return models.Book{}, fmt.Errorf("unknown batch operation %q", op.Op)
+}
+
+// abortBatch marks every result but the failed one as aborted
+func abortBatch(results []OperationResult, failed int) {
+	for i := range results {
+		if i != failed {
+			results[i] = OperationResult{Err: ErrBatchAborted}
+		}
+	}
+}
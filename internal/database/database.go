@@ -4,36 +4,81 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"net"
+	"net/url"
 	"os"
 
 	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
 )
 
 type Database struct {
 	Conn *sql.DB
+	// Dialect of the underlying connection, an empty value means MySQL
+	Dialect Dialect
 }
 
-func NewDBConnection() (*Database, error) {
-	db, err := connect()
+// NewDBConnection connects to the MySQL or Postgres server described by the
+// DB_* environment variables
+func NewDBConnection(dialect Dialect) (*Database, error) {
+	db, err := connect(dialect)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Database{Conn: db}, nil
+	return &Database{Conn: db, Dialect: dialect}, nil
 }
 
-func connect() (*sql.DB, error) {
+// NewSQLiteConnection opens (creating it if needed) the SQLite database file
+// at path. Use ":memory:" for a throwaway database.
+func NewSQLiteConnection(path string) (*Database, error) {
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite"
+	log.Printf("Opening SQLite database: %s", path)
+
+	db, err := sql.Open(SQLite.DriverName(), dsn)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		return nil, err
+	}
+	// SQLite serializes writers anyway, and a single connection keeps
+	// ":memory:" databases from being recreated per connection
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		log.Printf("Database ping failed: %v", err)
+		return nil, err
+	}
+	return &Database{Conn: db, Dialect: SQLite}, nil
+}
+
+// dialect returns the configured dialect, defaulting to MySQL
+func (d *Database) dialect() Dialect {
+	if d.Dialect == "" {
+		return MySQL
+	}
+	return d.Dialect
+}
+
+func connect(dialect Dialect) (*sql.DB, error) {
 	_ = godotenv.Load()
 
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASSWORD")
-	dbHost := os.Getenv("DB_HOST")
-	dbName := os.Getenv("DB_NAME")
+	cfg := connConfig{
+		User:     os.Getenv("DB_USER"),
+		Password: os.Getenv("DB_PASSWORD"),
+		Host:     os.Getenv("DB_HOST"),
+		Port:     os.Getenv("DB_PORT"),
+		Name:     os.Getenv("DB_NAME"),
+		SSLMode:  os.Getenv("DB_SSLMODE"),
+	}
 
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:3306)/%s?parseTime=true", dbUser, dbPassword, dbHost, dbName)
-	log.Printf("Connecting to database with DSN: %s:****@tcp(%s:3306)/%s", dbUser, dbHost, dbName)
+	dsn, redacted, err := buildDSN(dialect, cfg)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Connecting to database with DSN: %s", redacted)
 
-	db, err := sql.Open("mysql", dsn)
+	db, err := sql.Open(dialect.DriverName(), dsn)
 	if err != nil {
 		log.Printf("Database connection failed: %v", err)
 		return nil, err
@@ -49,3 +94,45 @@ func connect() (*sql.DB, error) {
 	log.Println("Database connection and ping successful")
 	return db, nil
 }
+
+// connConfig holds the settings needed to reach a database server
+type connConfig struct {
+	User     string
+	Password string
+	Host     string
+	Port     string
+	Name     string
+	SSLMode  string
+}
+
+// buildDSN returns the driver specific DSN for cfg along with a copy that is
+// safe to log
+func buildDSN(dialect Dialect, cfg connConfig) (string, string, error) {
+	if cfg.Port == "" {
+		cfg.Port = dialect.defaultPort()
+	}
+
+	switch dialect {
+	case MySQL:
+		dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true", cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.Name)
+		redacted := fmt.Sprintf("%s:****@tcp(%s:%s)/%s", cfg.User, cfg.Host, cfg.Port, cfg.Name)
+		return dsn, redacted, nil
+	case Postgres:
+		if cfg.SSLMode == "" {
+			cfg.SSLMode = "disable"
+		}
+		u := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(cfg.User, cfg.Password),
+			Host:     net.JoinHostPort(cfg.Host, cfg.Port),
+			Path:     "/" + cfg.Name,
+			RawQuery: url.Values{"sslmode": {cfg.SSLMode}}.Encode(),
+		}
+		dsn := u.String()
+		u.User = url.UserPassword(cfg.User, "****")
+		redacted, _ := url.PathUnescape(u.String())
+		return dsn, redacted, nil
+	default:
+		return "", "", fmt.Errorf("unsupported database dialect %q", dialect)
+	}
+}
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Dialect identifies the SQL flavour spoken by the connection behind a
+// Database. It drives migration selection and the few places where the
+// generated SQL or driver errors differ between engines.
+type Dialect string
+
+const (
+	MySQL    Dialect = "mysql"
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
+
+// DriverName is the database/sql driver registered for the dialect
+func (d Dialect) DriverName() string {
+	return string(d)
+}
+
+// GooseDialect is the name goose uses for the dialect
+func (d Dialect) GooseDialect() string {
+	if d == SQLite {
+		return "sqlite3"
+	}
+	return string(d)
+}
+
+// MigrationsDir is the directory holding the migrations for the dialect
+func (d Dialect) MigrationsDir() string {
+	return "db/migrations/" + string(d)
+}
+
+// defaultPort is the TCP port the database server listens on by default
+func (d Dialect) defaultPort() string {
+	if d == Postgres {
+		return "5432"
+	}
+	return "3306"
+}
+
+// rebind rewrites the "?" placeholders produced by the query builders into
+// the positional "$n" form Postgres expects. Other dialects are unchanged. A
+// "?" within a quoted string or identifier is left alone; quotes are paired
+// standard SQL style, a doubled quote inside being an escaped one, so
+// E'...' escapes and $$ quoting must not be used in rebound queries.
+func (d Dialect) rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	var quote rune
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			// a doubled quote closes and reopens, which is the same
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// timeArg converts t into a query argument comparable with the dialect's
+// TIMESTAMP columns. SQLite stores CURRENT_TIMESTAMP as UTC text, so times
+// are formatted the same way for the comparison to be lexically correct.
+func (d Dialect) timeArg(t time.Time) interface{} {
+	if d == SQLite {
+		return t.UTC().Format("2006-01-02 15:04:05")
+	}
+	return t.UTC()
+}
+
+// lockClause is appended to a SELECT to lock the selected rows for the rest
+// of the transaction. SQLite has no row locks, a write transaction already
+// excludes every other writer.
+func (d Dialect) lockClause() string {
+	if d == SQLite {
+		return ""
+	}
+	return " FOR UPDATE"
+}
+
+// parseTime converts a scanned aggregate of a TIMESTAMP column, such as MAX,
+// into a time. Drivers return those as time.Time, except SQLite which has no
+// declared type for an aggregate and returns the stored text. NULL is the
+// zero time.
+func (d Dialect) parseTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		return v.UTC(), nil
+	case []byte:
+		return d.parseTime(string(v))
+	case string:
+		for _, layout := range []string{"2006-01-02 15:04:05", time.RFC3339Nano} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t.UTC(), nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("unrecognized timestamp %q", v)
+	}
+	return time.Time{}, fmt.Errorf("unexpected timestamp type %T", value)
+}
+
+// isDuplicateKey reports whether err is a unique or primary key violation
+func (d Dialect) isDuplicateKey(err error) bool {
+	switch d {
+	case Postgres:
+		// SQLSTATE 23505 is unique_violation
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) {
+			return pqErr.Code == "23505"
+		}
+	case SQLite:
+		var sqliteErr *sqlite.Error
+		if errors.As(err, &sqliteErr) {
+			code := sqliteErr.Code()
+			return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+		}
+	default:
+		// MySQL error code 1062 is ER_DUP_ENTRY
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) {
+			return mysqlErr.Number == 1062
+		}
+	}
+	return false
+}
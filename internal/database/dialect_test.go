@@ -0,0 +1,95 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+func TestRebind(t *testing.T) {
+	query := "UPDATE books SET title = ?, author = ? WHERE id = ?"
+	if got := MySQL.rebind(query); got != query {
+		t.Errorf("Expected MySQL query to be unchanged, got %q", got)
+	}
+	want := "UPDATE books SET title = $1, author = $2 WHERE id = $3"
+	if got := Postgres.rebind(query); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	// "?" in quoted text isn't a placeholder
+	for query, want := range map[string]string{
+		"SELECT 'why?' AS q, title FROM books WHERE id = ?":     "SELECT 'why?' AS q, title FROM books WHERE id = $1",
+		"SELECT 'it''s ?' FROM books WHERE a = ? AND b = ?":     "SELECT 'it''s ?' FROM books WHERE a = $1 AND b = $2",
+		`SELECT "odd?column" FROM books WHERE id = ?`:           `SELECT "odd?column" FROM books WHERE id = $1`,
+		"SELECT '\"?' FROM books WHERE title LIKE ? ESCAPE '!'": "SELECT '\"?' FROM books WHERE title LIKE $1 ESCAPE '!'",
+	} {
+		if got := Postgres.rebind(query); got != want {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+	}
+}
+
+func TestIsDuplicateKey(t *testing.T) {
+	if !MySQL.isDuplicateKey(&mysql.MySQLError{Number: 1062}) {
+		t.Errorf("Expected MySQL 1062 to be a duplicate key error")
+	}
+	if !Postgres.isDuplicateKey(&pq.Error{Code: "23505"}) {
+		t.Errorf("Expected Postgres 23505 to be a duplicate key error")
+	}
+	if Postgres.isDuplicateKey(&mysql.MySQLError{Number: 1062}) {
+		t.Errorf("Expected a MySQL error not to match the Postgres dialect")
+	}
+	if MySQL.isDuplicateKey(errors.New("boom")) {
+		t.Errorf("Expected a generic error not to be a duplicate key error")
+	}
+}
+
+func TestBuildDSN(t *testing.T) {
+	cfg := connConfig{User: "root", Password: "p@ss", Host: "db", Name: "digicert"}
+
+	dsn, redacted, err := buildDSN(MySQL, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dsn != "root:p@ss@tcp(db:3306)/digicert?parseTime=true" {
+		t.Errorf("Unexpected MySQL DSN %q", dsn)
+	}
+	if redacted != "root:****@tcp(db:3306)/digicert" {
+		t.Errorf("Unexpected redacted MySQL DSN %q", redacted)
+	}
+
+	cfg.Port = "6543"
+	dsn, redacted, err = buildDSN(Postgres, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dsn != "postgres://root:p%40ss@db:6543/digicert?sslmode=disable" {
+		t.Errorf("Unexpected Postgres DSN %q", dsn)
+	}
+	if redacted != "postgres://root:****@db:6543/digicert?sslmode=disable" {
+		t.Errorf("Unexpected redacted Postgres DSN %q", redacted)
+	}
+
+	if _, _, err := buildDSN(SQLite, cfg); err == nil {
+		t.Errorf("Expected an error for a dialect without a server DSN")
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	want := time.Date(2025, 5, 1, 12, 30, 0, 0, time.UTC)
+	for _, value := range []interface{}{want, "2025-05-01 12:30:00", []byte("2025-05-01T12:30:00Z")} {
+		got, err := SQLite.parseTime(value)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("parseTime(%v) = %v, %v; want %v", value, got, err, want)
+		}
+	}
+	if got, err := MySQL.parseTime(nil); err != nil || !got.IsZero() {
+		t.Errorf("Expected NULL to be the zero time, got %v (err: %v)", got, err)
+	}
+	if _, err := SQLite.parseTime("yesterday"); err == nil {
+		t.Error("Expected an error for an unrecognized timestamp")
+	}
+}
@@ -3,7 +3,12 @@ package database
 import (
 	"database/sql"
 	"digicert-library-app/internal/models"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -22,15 +27,46 @@ func generatePlaceholders(count int) string {
 
 // Column management functions
 func getBookColumns() []string {
-	return []string{"id", "title", "author", "published_year", "genre"}
+	return []string{"id", "title", "author", "published_year", "genre", "isbn", "created_at", "updated_at", "version", "deleted_at"}
+}
+
+// getSortableColumns maps the field names accepted by the list endpoint to
+// the expressions they sort on. Only these are ever interpolated into ORDER
+// BY. Nullable columns are coalesced so every backend orders NULLs the same.
+func getSortableColumns() map[string]string {
+	return map[string]string{
+		"id":             "id",
+		"title":          "title",
+		"author":         "COALESCE(author, '')",
+		"genre":          "COALESCE(genre, '')",
+		"published_year": "COALESCE(published_year, 0)",
+		"created_at":     "created_at",
+		"updated_at":     "updated_at",
+	}
+}
+
+// SortableFields lists the field names that can be used to sort books
+func SortableFields() []string {
+	fields := make([]string, 0, len(getSortableColumns()))
+	for field := range getSortableColumns() {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// IsSortableField reports whether books can be sorted by field
+func IsSortableField(field string) bool {
+	_, ok := getSortableColumns()[field]
+	return ok
 }
 
 func getInsertColumns() []string {
-	return []string{"id", "title", "author", "published_year", "genre"}
+	return []string{"id", "title", "author", "published_year", "genre", "isbn"}
 }
 
 func getUpdateColumns() []string {
-	return []string{"title", "author", "published_year", "genre"}
+	return []string{"title", "author", "published_year", "genre", "isbn"}
 }
 
 // Helper functions using dynamic placeholders
@@ -38,6 +74,17 @@ func getBookColumnsString() string {
 	return strings.Join(getBookColumns(), ", ")
 }
 
+// getQualifiedBookColumnsString prefixes every book column with a table alias,
+// for queries joining books with another table
+func getQualifiedBookColumnsString(alias string) string {
+	columns := getBookColumns()
+	qualified := make([]string, len(columns))
+	for i, col := range columns {
+		qualified[i] = alias + "." + col
+	}
+	return strings.Join(qualified, ", ")
+}
+
 func getInsertColumnsString() string {
 	return strings.Join(getInsertColumns(), ", ")
 }
@@ -52,25 +99,295 @@ func getUpdateColumnsString() string {
 	for i, col := range columns {
 		updateParts[i] = col + " = ?"
 	}
-	return strings.Join(updateParts, ", ")
+	return strings.Join(updateParts, ", ") + ", " + bumpVersion
 }
 
-func scanBookRow(row *sql.Row) (models.Book, error) {
+// bumpVersion is added to the SET list of every update
+const bumpVersion = "version = version + 1"
+
+// buildPatchSetClause renders the SET list for a partial update of fields,
+// in a stable column order, and its arguments
+func buildPatchSetClause(fields map[string]interface{}) (string, []interface{}, error) {
+	for col := range fields {
+		if !slices.Contains(getUpdateColumns(), col) {
+			return "", nil, fmt.Errorf("column %q cannot be updated", col)
+		}
+	}
+
+	var parts []string
+	var args []interface{}
+	for _, col := range getUpdateColumns() {
+		if value, ok := fields[col]; ok {
+			if isbn, ok := value.(string); ok && col == "isbn" {
+				value = isbnArg(isbn)
+			}
+			parts = append(parts, col+" = ?")
+			args = append(args, value)
+		}
+	}
+	if len(parts) == 0 {
+		return "", nil, nil
+	}
+	return strings.Join(append(parts, bumpVersion), ", "), args, nil
+}
+
+// liveCondition excludes books in the trash, every read of live books has it
+const liveCondition = "deleted_at IS NULL"
+
+// trashCondition selects the books in the trash
+const trashCondition = "deleted_at IS NOT NULL"
+
+// buildWhereClause turns a filter into a WHERE clause (empty when there is
+// nothing to filter on) and its arguments
+func (d *Database) buildWhereClause(filter models.BookFilter) (string, []interface{}) {
+	conditions, args := d.buildConditions(filter)
+	return joinConditions(conditions), args
+}
+
+// buildConditions returns the individual conditions of a filter and their
+// arguments, to be combined with AND
+func (d *Database) buildConditions(filter models.BookFilter) ([]string, []interface{}) {
+	conditions := []string{liveCondition}
+	var args []interface{}
+	if filter.Deleted {
+		conditions[0] = trashCondition
+	}
+
+	if filter.Author != "" {
+		conditions = append(conditions, "LOWER(author) = LOWER(?)")
+		args = append(args, filter.Author)
+	}
+	if filter.Genre != "" {
+		conditions = append(conditions, "LOWER(genre) = LOWER(?)")
+		args = append(args, filter.Genre)
+	}
+	if filter.Title != "" {
+		conditions = append(conditions, "LOWER(title) LIKE LOWER(?) ESCAPE '!'")
+		args = append(args, "%"+escapeLike(filter.Title)+"%")
+	}
+	if filter.YearMin != 0 {
+		conditions = append(conditions, "published_year >= ?")
+		args = append(args, filter.YearMin)
+	}
+	if filter.YearMax != 0 {
+		conditions = append(conditions, "published_year <= ?")
+		args = append(args, filter.YearMax)
+	}
+
+	addTime := func(condition string, t time.Time) {
+		if t.IsZero() {
+			return
+		}
+		conditions = append(conditions, condition)
+		args = append(args, d.dialect().timeArg(t))
+	}
+	addTime("created_at >= ?", filter.CreatedSince)
+	addTime("created_at < ?", filter.CreatedBefore)
+	addTime("updated_at >= ?", filter.UpdatedSince)
+	addTime("updated_at < ?", filter.UpdatedBefore)
+
+	return conditions, args
+}
+
+// buildCursorCondition returns the keyset condition selecting the rows that
+// sort after cursor. For keys k1..kn it expands to
+// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ..., flipping the comparison for
+// descending keys, since row value comparisons can't mix directions.
+func (d *Database) buildCursorCondition(sortFields []models.SortField, cursor models.Cursor) (string, []interface{}) {
+	columns := getSortableColumns()
+	keys := orderKeys(sortFields)
+	values := append(append([]interface{}{}, cursor.Values...), cursor.ID)
+
+	var alternatives []string
+	var args []interface{}
+	for i, key := range keys {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, columns[keys[j].Field]+" = ?")
+			args = append(args, d.sortArg(values[j]))
+		}
+		op := " > ?"
+		if key.Desc {
+			op = " < ?"
+		}
+		parts = append(parts, columns[key.Field]+op)
+		args = append(args, d.sortArg(values[i]))
+		alternatives = append(alternatives, "("+strings.Join(parts, " AND ")+")")
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
+
+// sortArg converts a sort key value into a query argument
+func (d *Database) sortArg(value interface{}) interface{} {
+	if t, ok := value.(time.Time); ok {
+		return d.dialect().timeArg(t)
+	}
+	return value
+}
+
+func joinConditions(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// escapeLike escapes the LIKE wildcards in a user supplied value, using "!"
+// as the escape character since it needs no quoting in any dialect
+func escapeLike(value string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(value)
+}
+
+// orderKeys returns the effective ordering for a sort: the known fields up
+// to and including id. id is unique, so it always ends the ordering, as the
+// final ascending tiebreaker when not requested explicitly. Unknown fields
+// are skipped, callers are expected to validate them with IsSortableField.
+func orderKeys(sortFields []models.SortField) []models.SortField {
+	columns := getSortableColumns()
+	var keys []models.SortField
+	for _, field := range sortFields {
+		if _, ok := columns[field.Field]; !ok {
+			continue
+		}
+		keys = append(keys, field)
+		if field.Field == "id" {
+			// nothing after a unique column can affect the order
+			return keys
+		}
+	}
+	return append(keys, models.SortField{Field: "id"})
+}
+
+// buildOrderByClause renders the effective ordering so pages are deterministic
+func buildOrderByClause(sortFields []models.SortField) string {
+	columns := getSortableColumns()
+	var parts []string
+	for _, key := range orderKeys(sortFields) {
+		direction := "ASC"
+		if key.Desc {
+			direction = "DESC"
+		}
+		parts = append(parts, columns[key.Field]+" "+direction)
+	}
+	return " ORDER BY " + strings.Join(parts, ", ")
+}
+
+// CursorFor returns the keyset cursor positioned on book for a sort, so the
+// next page starts right after it
+func CursorFor(book models.Book, sortFields []models.SortField) models.Cursor {
+	cursor := models.Cursor{ID: book.ID.String()}
+	for _, key := range orderKeys(sortFields) {
+		if key.Field != "id" {
+			cursor.Values = append(cursor.Values, sortValue(book, key.Field))
+		}
+	}
+	return cursor
+}
+
+// CursorFields returns the fields whose values a cursor for the sort carries,
+// in order. The id is carried separately.
+func CursorFields(sortFields []models.SortField) []string {
+	var fields []string
+	for _, key := range orderKeys(sortFields) {
+		if key.Field != "id" {
+			fields = append(fields, key.Field)
+		}
+	}
+	return fields
+}
+
+// sortValue returns the value of a sortable field, with the same zero value
+// substitution for NULLs as getSortableColumns
+func sortValue(book models.Book, field string) interface{} {
+	switch field {
+	case "id":
+		return book.ID.String()
+	case "title":
+		return book.Title
+	case "author":
+		return book.Author
+	case "genre":
+		return book.Genre
+	case "published_year":
+		return book.PublishedYear
+	case "created_at":
+		return book.CreatedAt
+	case "updated_at":
+		return book.UpdatedAt
+	}
+	return nil
+}
+
+// FormatSortValue renders a sort key value as a string for use in a cursor
+func FormatSortValue(value interface{}) string {
+	switch v := value.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case int:
+		return strconv.Itoa(v)
+	case string:
+		return v
+	}
+	return fmt.Sprint(value)
+}
+
+// ParseSortValue is the inverse of FormatSortValue for a given field
+func ParseSortValue(field, raw string) (interface{}, error) {
+	switch field {
+	case "published_year":
+		return strconv.Atoi(raw)
+	case "created_at", "updated_at":
+		return time.Parse(time.RFC3339Nano, raw)
+	case "title", "author", "genre":
+		return raw, nil
+	}
+	return nil, fmt.Errorf("unknown sort field %q", field)
+}
+
+// bookScanner is satisfied by both *sql.Row and *sql.Rows
+type bookScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanBook scans the getBookColumns columns, followed by any extra selected
+// columns into extra
+func scanBook(scanner bookScanner, extra ...interface{}) (models.Book, error) {
 	var book models.Book
-	err := row.Scan(&book.ID, &book.Title, &book.Author, &book.PublishedYear, &book.Genre)
+	var isbn sql.NullString
+	var createdAt, updatedAt, deletedAt sql.NullTime
+	dest := []interface{}{&book.ID, &book.Title, &book.Author, &book.PublishedYear, &book.Genre, &isbn, &createdAt, &updatedAt, &book.Version, &deletedAt}
+	err := scanner.Scan(append(dest, extra...)...)
+	book.ISBN = isbn.String
+	book.CreatedAt = createdAt.Time.UTC()
+	book.UpdatedAt = updatedAt.Time.UTC()
+	if deletedAt.Valid {
+		t := deletedAt.Time.UTC()
+		book.DeletedAt = &t
+	}
 	return book, err
 }
 
+func scanBookRow(row *sql.Row) (models.Book, error) {
+	return scanBook(row)
+}
+
 func scanBookRows(rows *sql.Rows) (models.Book, error) {
-	var book models.Book
-	err := rows.Scan(&book.ID, &book.Title, &book.Author, &book.PublishedYear, &book.Genre)
-	return book, err
+	return scanBook(rows)
 }
 
 func getInsertValues(id uuid.UUID, book models.Book) []interface{} {
-	return []interface{}{id, book.Title, book.Author, book.PublishedYear, book.Genre}
+	return []interface{}{id, book.Title, book.Author, book.PublishedYear, book.Genre, isbnArg(book.ISBN)}
 }
 
 func getUpdateValues(book models.Book, id string) []interface{} {
-	return []interface{}{book.Title, book.Author, book.PublishedYear, book.Genre, id}
+	return []interface{}{book.Title, book.Author, book.PublishedYear, book.Genre, isbnArg(book.ISBN), id}
+}
+
+// isbnArg stores a missing ISBN as NULL, the unique index allows any number
+// of those
+func isbnArg(isbn string) interface{} {
+	if isbn == "" {
+		return nil
+	}
+	return isbn
 }
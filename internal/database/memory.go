@@ -0,0 +1,617 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/search"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStore is a thread-safe, non-persistent BookStore intended for local
+// development, demos and tests. It mirrors the semantics of the MySQL backend,
+// including sql.ErrNoRows for missing books.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	books   map[string]models.Book
+	audit   []models.AuditEntry
+	apiKeys []models.APIKey
+}
+
+// Compile time check that MemoryStore satisfies Store
+var _ Store = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{books: map[string]models.Book{}}
+}
+
+func (m *MemoryStore) GetBooks(ctx context.Context, q models.BookQuery) ([]models.Book, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	books := []models.Book{}
+	for _, book := range m.books {
+		if matchesFilter(book, q.Filter) {
+			books = append(books, book)
+		}
+	}
+	sortBooks(books, q.Sort)
+
+	offset := q.Offset
+	if q.After != nil {
+		// skip everything up to and including the cursor position
+		offset = sort.Search(len(books), func(i int) bool {
+			return compareKeys(CursorFor(books[i], q.Sort), *q.After, q.Sort) > 0
+		})
+	}
+	if offset < 0 || offset >= len(books) {
+		return []models.Book{}, nil
+	}
+	books = books[offset:]
+	if q.Limit >= 0 && q.Limit < len(books) {
+		books = books[:q.Limit]
+	}
+	return books, nil
+}
+
+func (m *MemoryStore) CountBooks(ctx context.Context, filter models.BookFilter) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, book := range m.books {
+		if matchesFilter(book, filter) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MemoryStore) BookStats(ctx context.Context, filter models.BookFilter) (models.BookStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var stats models.BookStats
+	for _, book := range m.books {
+		// like the SQL backends, LastModified spans live and trashed books
+		either := filter
+		either.Deleted = book.DeletedAt != nil
+		if !matchesFilter(book, either) {
+			continue
+		}
+		if book.UpdatedAt.After(stats.LastModified) {
+			stats.LastModified = book.UpdatedAt
+		}
+		if matchesFilter(book, filter) {
+			stats.Count++
+			stats.VersionSum += int64(book.Version)
+		}
+	}
+	return stats, nil
+}
+
+func (m *MemoryStore) GetBookByID(ctx context.Context, id string) (models.Book, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	book, ok := m.books[id]
+	if !ok || book.DeletedAt != nil {
+		return models.Book{}, sql.ErrNoRows
+	}
+	return book, nil
+}
+
+func (m *MemoryStore) BookExists(ctx context.Context, id string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.books[id]
+	return ok, nil
+}
+
+func (m *MemoryStore) GetBookByISBN(ctx context.Context, isbn string) (models.Book, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, book := range m.books {
+		if book.ISBN == isbn && book.DeletedAt == nil {
+			return book, nil
+		}
+	}
+	return models.Book{}, sql.ErrNoRows
+}
+
+func (m *MemoryStore) FindDuplicates(ctx context.Context, books []models.Book) ([]models.Book, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	found := []models.Book{}
+	for _, existing := range m.books {
+		if existing.DeletedAt != nil {
+			continue
+		}
+		for _, book := range books {
+			if (book.ISBN != "" && existing.ISBN == book.ISBN) ||
+				(strings.EqualFold(strings.TrimSpace(existing.Title), strings.TrimSpace(book.Title)) &&
+					strings.EqualFold(strings.TrimSpace(existing.Author), strings.TrimSpace(book.Author))) {
+				found = append(found, existing)
+				break
+			}
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].ID.String() < found[j].ID.String() })
+	return found, nil
+}
+
+func (m *MemoryStore) CreateBook(ctx context.Context, newBook models.Book) (models.Book, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.createBook(ctx, newBook)
+}
+
+func (m *MemoryStore) UpdateBook(ctx context.Context, id string, updatedBook models.Book, version int) (models.Book, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.updateBook(ctx, id, updatedBook, version)
+}
+
+// createBook, updateBook and deleteBook carry out the writes of the same
+// name for the exported methods and batches. Callers must hold the write
+// lock.
+func (m *MemoryStore) createBook(ctx context.Context, newBook models.Book) (models.Book, error) {
+	if m.isbnTaken(newBook.ISBN, "") {
+		return models.Book{}, ErrDuplicateISBN
+	}
+	now := time.Now().UTC()
+	newBook.ID = uuid.New()
+	newBook.CreatedAt = now
+	newBook.UpdatedAt = now
+	newBook.Version = 1
+	m.books[newBook.ID.String()] = newBook
+	m.record(ctx, models.AuditCreate, nil, &newBook)
+	return newBook, nil
+}
+
+func (m *MemoryStore) updateBook(ctx context.Context, id string, updatedBook models.Book, version int) (models.Book, error) {
+	book, err := m.lookup(id, version)
+	if err != nil {
+		return models.Book{}, err
+	}
+	if m.isbnTaken(updatedBook.ISBN, id) {
+		return models.Book{}, ErrDuplicateISBN
+	}
+	updatedBook.ID = book.ID
+	updatedBook.CreatedAt = book.CreatedAt
+	updatedBook.UpdatedAt = time.Now().UTC()
+	updatedBook.Version = book.Version + 1
+	m.books[id] = updatedBook
+	m.record(ctx, models.AuditUpdate, &book, &updatedBook)
+	return updatedBook, nil
+}
+
+func (m *MemoryStore) deleteBook(ctx context.Context, id string, version int) (models.Book, error) {
+	book, err := m.lookup(id, version)
+	if err != nil {
+		return models.Book{}, err
+	}
+	before := book
+	now := time.Now().UTC()
+	book.DeletedAt = &now
+	book.UpdatedAt = now
+	book.Version++
+	m.books[id] = book
+	m.record(ctx, models.AuditDelete, &before, &book)
+	return book, nil
+}
+
+func (m *MemoryStore) PatchBook(ctx context.Context, id string, fields map[string]interface{}, version int) (models.Book, error) {
+	if _, _, err := buildPatchSetClause(fields); err != nil {
+		return models.Book{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	book, err := m.lookup(id, version)
+	if err != nil {
+		return models.Book{}, err
+	}
+	if len(fields) == 0 {
+		return book, nil
+	}
+	before := book
+	for col, value := range fields {
+		switch col {
+		case "title":
+			book.Title, _ = value.(string)
+		case "author":
+			book.Author, _ = value.(string)
+		case "published_year":
+			book.PublishedYear, _ = value.(int)
+		case "genre":
+			book.Genre, _ = value.(string)
+		case "isbn":
+			book.ISBN, _ = value.(string)
+		}
+	}
+	if m.isbnTaken(book.ISBN, id) {
+		return models.Book{}, ErrDuplicateISBN
+	}
+	book.UpdatedAt = time.Now().UTC()
+	book.Version++
+	m.books[id] = book
+	m.record(ctx, models.AuditUpdate, &before, &book)
+	return book, nil
+}
+
+func (m *MemoryStore) DeleteBook(ctx context.Context, id string, version int) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.deleteBook(ctx, id, version); err != nil {
+		return "", err
+	}
+	return "Book Deleted", nil
+}
+
+func (m *MemoryStore) ApplyBatch(ctx context.Context, ops []models.BatchOperation, atomic bool) ([]OperationResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// holding the lock for the whole batch makes it a transaction, undone
+	// by restoring this state
+	books, auditLen := maps.Clone(m.books), len(m.audit)
+
+	results := make([]OperationResult, len(ops))
+	for i, op := range ops {
+		if op.Book == nil && op.Op != models.BatchDelete {
+			results[i].Err = fmt.Errorf("batch %s needs a book", op.Op)
+		} else {
+			switch op.Op {
+			case models.BatchCreate:
+				results[i].Book, results[i].Err = m.createBook(ctx, *op.Book)
+			case models.BatchUpdate:
+				results[i].Book, results[i].Err = m.updateBook(ctx, op.ID, *op.Book, op.Version)
+			case models.BatchDelete:
+				results[i].Book, results[i].Err = m.deleteBook(ctx, op.ID, op.Version)
+			default:
+				results[i].Err = fmt.Errorf("unknown batch operation %q", op.Op)
+			}
+		}
+		if atomic && results[i].Err != nil {
+			m.books, m.audit = books, m.audit[:auditLen]
+			abortBatch(results, i)
+			break
+		}
+	}
+	return results, nil
+}
+
+func (m *MemoryStore) RestoreBook(ctx context.Context, id string) (models.Book, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	book, ok := m.books[id]
+	if !ok || book.DeletedAt == nil {
+		return models.Book{}, sql.ErrNoRows
+	}
+	before := book
+	book.DeletedAt = nil
+	book.UpdatedAt = time.Now().UTC()
+	book.Version++
+	m.books[id] = book
+	m.record(ctx, models.AuditRestore, &before, &book)
+	return book, nil
+}
+
+func (m *MemoryStore) PurgeDeletedBooks(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var purged int64
+	for id, book := range m.books {
+		if book.DeletedAt != nil && book.DeletedAt.Before(before) {
+			delete(m.books, id)
+			m.record(ctx, models.AuditPurge, &book, nil)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// record appends the audit entry of a change. Callers must hold the write
+// lock, which makes the entry atomic with the change.
+func (m *MemoryStore) record(ctx context.Context, action string, before, after *models.Book) {
+	id := uuid.Nil
+	if before != nil {
+		id = before.ID
+	} else if after != nil {
+		id = after.ID
+	}
+	entry := newAuditEntry(ctx, action, id, before, after)
+	entry.ID = int64(len(m.audit) + 1)
+	entry.CreatedAt = time.Now().UTC()
+	m.audit = append(m.audit, entry)
+}
+
+func (m *MemoryStore) GetAuditLog(ctx context.Context, q models.AuditQuery) ([]models.AuditEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := []models.AuditEntry{}
+	for _, entry := range m.audit {
+		if q.Filter.BookID != "" && entry.BookID.String() != q.Filter.BookID {
+			continue
+		}
+		if q.Filter.Actor != "" && entry.Actor != q.Filter.Actor {
+			continue
+		}
+		if !q.Filter.Since.IsZero() && entry.CreatedAt.Before(q.Filter.Since) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if q.Offset < 0 || q.Offset >= len(entries) {
+		return []models.AuditEntry{}, nil
+	}
+	entries = entries[q.Offset:]
+	if q.Limit >= 0 && q.Limit < len(entries) {
+		entries = entries[:q.Limit]
+	}
+	return entries, nil
+}
+
+// isbnTaken reports whether a book other than the one with id, trashed or
+// not, has isbn, as the unique index of the SQL backends would. Callers must
+// hold the lock.
+func (m *MemoryStore) isbnTaken(isbn, id string) bool {
+	if isbn == "" {
+		return false
+	}
+	for otherID, book := range m.books {
+		if book.ISBN == isbn && otherID != id {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup returns the live book to write to, checking the expected version
+// like the SQL backends do. Callers must hold the write lock.
+func (m *MemoryStore) lookup(id string, version int) (models.Book, error) {
+	book, ok := m.books[id]
+	if !ok || book.DeletedAt != nil {
+		return models.Book{}, sql.ErrNoRows
+	}
+	if version != 0 && book.Version != version {
+		return models.Book{}, ErrVersionMismatch
+	}
+	return book, nil
+}
+
+// searchWeights ranks matches in the title above author and genre matches
+var searchWeights = []struct {
+	weight float64
+	field  func(models.Book) string
+}{
+	{3, func(b models.Book) string { return b.Title }},
+	{2, func(b models.Book) string { return b.Author }},
+	{1, func(b models.Book) string { return b.Genre }},
+}
+
+func (m *MemoryStore) SearchBooks(ctx context.Context, q search.Query, limit, offset int) ([]models.SearchResult, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	results := []models.SearchResult{}
+	for _, book := range m.books {
+		if book.DeletedAt != nil {
+			continue
+		}
+		score := 0.0
+		matchedAll := true
+		for _, term := range q.Terms {
+			termScore := 0.0
+			for _, w := range searchWeights {
+				// matches in short fields weigh more, like a tf-idf ranking
+				text := w.field(book)
+				if count := term.Count(text); count > 0 {
+					termScore += w.weight * float64(count) / float64(len(search.Tokenize(text)))
+				}
+			}
+			if termScore == 0 {
+				matchedAll = false
+				break
+			}
+			score += termScore
+		}
+		if matchedAll {
+			results = append(results, models.SearchResult{Book: book, Score: score})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Book.ID.String() < results[j].Book.ID.String()
+	})
+	if offset < 0 || offset >= len(results) {
+		return []models.SearchResult{}, nil
+	}
+	results = results[offset:]
+	if limit >= 0 && limit < len(results) {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// matchesFilter applies a BookFilter the same way the SQL WHERE clause does
+func matchesFilter(book models.Book, filter models.BookFilter) bool {
+	if (book.DeletedAt != nil) != filter.Deleted {
+		return false
+	}
+	if filter.Author != "" && !strings.EqualFold(book.Author, filter.Author) {
+		return false
+	}
+	if filter.Genre != "" && !strings.EqualFold(book.Genre, filter.Genre) {
+		return false
+	}
+	if filter.Title != "" && !strings.Contains(strings.ToLower(book.Title), strings.ToLower(filter.Title)) {
+		return false
+	}
+	if filter.YearMin != 0 && book.PublishedYear < filter.YearMin {
+		return false
+	}
+	if filter.YearMax != 0 && book.PublishedYear > filter.YearMax {
+		return false
+	}
+	if !filter.CreatedSince.IsZero() && book.CreatedAt.Before(filter.CreatedSince) {
+		return false
+	}
+	if !filter.CreatedBefore.IsZero() && !book.CreatedAt.Before(filter.CreatedBefore) {
+		return false
+	}
+	if !filter.UpdatedSince.IsZero() && book.UpdatedAt.Before(filter.UpdatedSince) {
+		return false
+	}
+	if !filter.UpdatedBefore.IsZero() && !book.UpdatedAt.Before(filter.UpdatedBefore) {
+		return false
+	}
+	return true
+}
+
+// sortBooks orders books like the SQL ORDER BY clause
+func sortBooks(books []models.Book, sortFields []models.SortField) {
+	sort.Slice(books, func(i, j int) bool {
+		return compareBooks(books[i], books[j], sortFields) < 0
+	})
+}
+
+// compareBooks compares two books on the effective ordering of a sort
+func compareBooks(a, b models.Book, sortFields []models.SortField) int {
+	return compareKeys(CursorFor(a, sortFields), CursorFor(b, sortFields), sortFields)
+}
+
+// compareKeys compares two keyset positions taken with the same sort
+func compareKeys(a, b models.Cursor, sortFields []models.SortField) int {
+	keys := orderKeys(sortFields)
+	for i, key := range keys {
+		var c int
+		if i < len(a.Values) && i < len(b.Values) {
+			c = compareValues(a.Values[i], b.Values[i])
+		} else {
+			c = strings.Compare(a.ID, b.ID)
+		}
+		if key.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compareValues compares two sort key values of the same type
+func compareValues(a, b interface{}) int {
+	switch x := a.(type) {
+	case string:
+		y, _ := b.(string)
+		return strings.Compare(x, y)
+	case int:
+		y, _ := b.(int)
+		return cmp.Compare(x, y)
+	case time.Time:
+		y, _ := b.(time.Time)
+		return x.Compare(y)
+	}
+	return 0
+}
+
+func (m *MemoryStore) CreateAPIKey(ctx context.Context, key models.APIKey) (models.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.apiKeys {
+		if existing.Prefix == key.Prefix {
+			return models.APIKey{}, fmt.Errorf("duplicate API key prefix %q", key.Prefix)
+		}
+	}
+	key.ID = uuid.New()
+	key.CreatedAt = time.Now().UTC()
+	key.RotatedAt, key.LastUsedAt, key.RevokedAt = nil, nil, nil
+	m.apiKeys = append(m.apiKeys, key)
+	return key, nil
+}
+
+func (m *MemoryStore) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]models.APIKey{}, m.apiKeys...), nil
+}
+
+func (m *MemoryStore) GetAPIKeyByPrefix(ctx context.Context, prefix string) (models.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, key := range m.apiKeys {
+		if key.Prefix == prefix {
+			return key, nil
+		}
+	}
+	return models.APIKey{}, sql.ErrNoRows
+}
+
+func (m *MemoryStore) RotateAPIKey(ctx context.Context, id, prefix, salt, hash string) (models.APIKey, error) {
+	return m.updateAPIKey(id, func(key *models.APIKey, now time.Time) {
+		key.Prefix, key.Salt, key.Hash = prefix, salt, hash
+		key.RotatedAt = &now
+	})
+}
+
+func (m *MemoryStore) RevokeAPIKey(ctx context.Context, id string) (models.APIKey, error) {
+	return m.updateAPIKey(id, func(key *models.APIKey, now time.Time) {
+		key.RevokedAt = &now
+	})
+}
+
+func (m *MemoryStore) TouchAPIKey(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.apiKeys {
+		if m.apiKeys[i].ID.String() == id {
+			now := time.Now().UTC()
+			m.apiKeys[i].LastUsedAt = &now
+			return nil
+		}
+	}
+	return nil
+}
+
+// updateAPIKey applies change to the key id unless it's missing or revoked,
+// and returns the updated key
+func (m *MemoryStore) updateAPIKey(id string, change func(key *models.APIKey, now time.Time)) (models.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.apiKeys {
+		if m.apiKeys[i].ID.String() == id && m.apiKeys[i].RevokedAt == nil {
+			change(&m.apiKeys[i], time.Now().UTC())
+			return m.apiKeys[i], nil
+		}
+	}
+	return models.APIKey{}, sql.ErrNoRows
+}
@@ -0,0 +1,277 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/requestctx"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore_CRUD(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	if _, err := store.CreateBook(ctx, models.Book{Title: "Dune", Author: "Frank Herbert"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	books, _ := store.GetBooks(ctx, models.BookQuery{Limit: 10})
+	if len(books) != 1 {
+		t.Fatalf("Expected 1 book, got %d", len(books))
+	}
+	id := books[0].ID.String()
+
+	if _, err := store.UpdateBook(ctx, id, models.Book{Title: "Dune Messiah", Author: "Frank Herbert"}, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	book, err := store.GetBookByID(ctx, id)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if book.Title != "Dune Messiah" || book.ID.String() != id {
+		t.Errorf("Unexpected book after update: %+v", book)
+	}
+
+	if _, err := store.DeleteBook(ctx, id, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := store.GetBookByID(ctx, id); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows after delete, got %v", err)
+	}
+	if _, err := store.UpdateBook(ctx, id, book, 0); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows updating a deleted book, got %v", err)
+	}
+	if _, err := store.DeleteBook(ctx, id, 0); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows deleting twice, got %v", err)
+	}
+}
+
+func TestMemoryStore_ISBN(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	dune, _ := store.CreateBook(ctx, models.Book{Title: "Dune", Author: "Frank Herbert", ISBN: "9780441172719"})
+	emma, _ := store.CreateBook(ctx, models.Book{Title: "Emma", Author: "Jane Austen"})
+	if _, err := store.CreateBook(ctx, models.Book{Title: "Dune", Author: "Frank Herbert", ISBN: "9780441172719"}); err != ErrDuplicateISBN {
+		t.Errorf("Expected ErrDuplicateISBN creating a second copy, got %v", err)
+	}
+	if _, err := store.PatchBook(ctx, emma.ID.String(), map[string]interface{}{"isbn": "9780441172719"}, 0); err != ErrDuplicateISBN {
+		t.Errorf("Expected ErrDuplicateISBN patching in a taken ISBN, got %v", err)
+	}
+	if book, err := store.GetBookByISBN(ctx, "9780441172719"); err != nil || book.ID != dune.ID {
+		t.Errorf("Expected to find Dune by its ISBN, got %+v (err: %v)", book, err)
+	}
+
+	// a trashed book keeps its ISBN but isn't found by it
+	store.DeleteBook(ctx, dune.ID.String(), 0)
+	if _, err := store.GetBookByISBN(ctx, "9780441172719"); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for a book in the trash, got %v", err)
+	}
+	if _, err := store.UpdateBook(ctx, emma.ID.String(), models.Book{Title: "Emma", Author: "Jane Austen", ISBN: "9780441172719"}, 0); err != ErrDuplicateISBN {
+		t.Errorf("Expected ErrDuplicateISBN for the ISBN of a trashed book, got %v", err)
+	}
+}
+
+func TestMemoryStore_Versions(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	created, _ := store.CreateBook(ctx, models.Book{Title: "Dune", Author: "Frank Herbert"})
+	id := created.ID.String()
+	if created.Version != 1 {
+		t.Fatalf("Expected a new book at version 1, got %d", created.Version)
+	}
+
+	if _, err := store.UpdateBook(ctx, id, models.Book{Title: "Dune Messiah", Author: "Frank Herbert"}, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := store.UpdateBook(ctx, id, models.Book{Title: "Stale", Author: "Frank Herbert"}, 1); err != ErrVersionMismatch {
+		t.Errorf("Expected ErrVersionMismatch for a stale update, got %v", err)
+	}
+	patched, err := store.PatchBook(ctx, id, map[string]interface{}{"genre": "Sci-Fi"}, 2)
+	if err != nil || patched.Version != 3 || patched.Title != "Dune Messiah" {
+		t.Errorf("Expected the patch to apply at version 2, got %+v (err: %v)", patched, err)
+	}
+	if _, err := store.DeleteBook(ctx, id, 2); err != ErrVersionMismatch {
+		t.Errorf("Expected ErrVersionMismatch for a stale delete, got %v", err)
+	}
+	if _, err := store.DeleteBook(ctx, id, 3); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := store.DeleteBook(ctx, id, 3); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for a deleted book, got %v", err)
+	}
+}
+
+func TestMemoryStore_Pagination(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for i := 0; i < 5; i++ {
+		store.CreateBook(ctx, models.Book{Title: fmt.Sprintf("Book %d", i), Author: "Author"})
+	}
+
+	byTitle := []models.SortField{{Field: "title"}}
+	page, _ := store.GetBooks(ctx, models.BookQuery{Limit: 2, Offset: 2, Sort: byTitle})
+	if len(page) != 2 || page[0].Title != "Book 2" || page[1].Title != "Book 3" {
+		t.Errorf("Unexpected second page: %+v", page)
+	}
+	last, _ := store.GetBooks(ctx, models.BookQuery{Limit: 2, Offset: 4})
+	if len(last) != 1 {
+		t.Errorf("Expected 1 book on last page, got %d", len(last))
+	}
+	past, _ := store.GetBooks(ctx, models.BookQuery{Limit: 2, Offset: 10})
+	if past == nil || len(past) != 0 {
+		t.Errorf("Expected empty non-nil page past the end, got %+v", past)
+	}
+}
+
+func TestMemoryStore_ConcurrentAccess(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			store.CreateBook(ctx, models.Book{Title: "Book", Author: "Author"})
+		}()
+		go func() {
+			defer wg.Done()
+			store.GetBooks(ctx, models.BookQuery{Limit: 10})
+		}()
+	}
+	wg.Wait()
+
+	books, _ := store.GetBooks(ctx, models.BookQuery{Limit: 100})
+	if len(books) != 50 {
+		t.Errorf("Expected 50 books, got %d", len(books))
+	}
+}
+
+func TestMemoryStore_TimestampsFilterAndSort(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	first, _ := store.CreateBook(ctx, models.Book{Title: "First", Author: "Author"})
+	second, _ := store.CreateBook(ctx, models.Book{Title: "Second", Author: "Author"})
+	if first.CreatedAt.IsZero() || !first.CreatedAt.Equal(first.UpdatedAt) {
+		t.Fatalf("Expected created_at and updated_at to be set on create, got %+v", first)
+	}
+
+	time.Sleep(time.Millisecond)
+	checkpoint := time.Now().UTC()
+	time.Sleep(time.Millisecond)
+	store.UpdateBook(ctx, first.ID.String(), models.Book{Title: "First, revised", Author: "Author"}, 0)
+
+	updated, _ := store.GetBookByID(ctx, first.ID.String())
+	if !updated.CreatedAt.Equal(first.CreatedAt) || !updated.UpdatedAt.After(checkpoint) {
+		t.Errorf("Expected update to keep created_at and bump updated_at, got %+v", updated)
+	}
+
+	changed, _ := store.GetBooks(ctx, models.BookQuery{Limit: 10, Filter: models.BookFilter{UpdatedSince: checkpoint}})
+	if len(changed) != 1 || changed[0].ID != first.ID {
+		t.Errorf("Expected only the updated book since the checkpoint, got %+v", changed)
+	}
+
+	sorted, _ := store.GetBooks(ctx, models.BookQuery{Limit: 10, Sort: []models.SortField{{Field: "updated_at", Desc: true}}})
+	if len(sorted) != 2 || sorted[0].ID != first.ID || sorted[1].ID != second.ID {
+		t.Errorf("Expected most recently updated book first, got %+v", sorted)
+	}
+}
+
+func TestMemoryStore_FilterAndSortFields(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	store.CreateBook(ctx, models.Book{Title: "Dune", Author: "Frank Herbert", PublishedYear: 1965, Genre: "Sci-Fi"})
+	store.CreateBook(ctx, models.Book{Title: "Dune Messiah", Author: "Frank Herbert", PublishedYear: 1969, Genre: "Sci-Fi"})
+	store.CreateBook(ctx, models.Book{Title: "Emma", Author: "Jane Austen", PublishedYear: 1815, Genre: "Romance"})
+
+	tests := []struct {
+		filter models.BookFilter
+		want   int
+	}{
+		{models.BookFilter{Author: "frank herbert"}, 2},
+		{models.BookFilter{Genre: "romance"}, 1},
+		{models.BookFilter{Title: "MESSIAH"}, 1},
+		{models.BookFilter{YearMin: 1900}, 2},
+		{models.BookFilter{YearMin: 1966, YearMax: 1970}, 1},
+		{models.BookFilter{Author: "Frank Herbert", Title: "emma"}, 0},
+	}
+	for _, tt := range tests {
+		books, _ := store.GetBooks(ctx, models.BookQuery{Limit: 10, Filter: tt.filter})
+		if len(books) != tt.want {
+			t.Errorf("filter %+v: expected %d books, got %d", tt.filter, tt.want, len(books))
+		}
+		if count, _ := store.CountBooks(ctx, tt.filter); count != tt.want {
+			t.Errorf("filter %+v: expected count %d, got %d", tt.filter, tt.want, count)
+		}
+	}
+
+	sorted, _ := store.GetBooks(ctx, models.BookQuery{Limit: 10, Sort: []models.SortField{{Field: "author"}, {Field: "published_year", Desc: true}}})
+	titles := []string{sorted[0].Title, sorted[1].Title, sorted[2].Title}
+	if titles[0] != "Dune Messiah" || titles[1] != "Dune" || titles[2] != "Emma" {
+		t.Errorf("Unexpected sort order %v", titles)
+	}
+}
+
+func TestMemoryStore_AuditLog(t *testing.T) {
+	ctx := requestctx.WithActor(context.Background(), "librarian")
+	store := NewMemoryStore()
+	dune, _ := store.CreateBook(ctx, models.Book{Title: "Dune", Author: "Frank Herbert"})
+	emma, _ := store.CreateBook(ctx, models.Book{Title: "Emma", Author: "Jane Austen"})
+	id := dune.ID.String()
+	store.PatchBook(ctx, id, map[string]interface{}{"genre": "Sci-Fi"}, 0)
+	// no-op and failed writes aren't recorded
+	store.PatchBook(ctx, id, map[string]interface{}{}, 0)
+	store.UpdateBook(ctx, id, models.Book{Title: "Dune"}, 1)
+	store.DeleteBook(context.Background(), emma.ID.String(), 0)
+
+	history, _ := store.GetAuditLog(ctx, models.AuditQuery{Filter: models.AuditFilter{BookID: id}, Limit: 10})
+	if len(history) != 2 || history[0].Action != models.AuditCreate || history[1].Action != models.AuditUpdate {
+		t.Fatalf("Expected a create and an update, got %+v", history)
+	}
+	want := map[string]models.FieldChange{"genre": {Before: nil, After: "Sci-Fi"}}
+	if !reflect.DeepEqual(history[1].Changes, want) {
+		t.Errorf("Expected changes %v, got %v", want, history[1].Changes)
+	}
+
+	byActor, _ := store.GetAuditLog(ctx, models.AuditQuery{Filter: models.AuditFilter{Actor: unknownActor}, Limit: 10})
+	if len(byActor) != 1 || byActor[0].BookID != emma.ID || byActor[0].Action != models.AuditDelete {
+		t.Errorf("Expected the anonymous delete alone, got %+v", byActor)
+	}
+	if page, _ := store.GetAuditLog(ctx, models.AuditQuery{Limit: 2, Offset: 2}); len(page) != 2 || page[0].ID != 3 {
+		t.Errorf("Expected the second page to start at entry 3, got %+v", page)
+	}
+}
+
+func TestMemoryStore_ApplyBatch(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	dune, _ := store.CreateBook(ctx, models.Book{Title: "Dune", Author: "Frank Herbert"})
+	ops := []models.BatchOperation{
+		{Op: models.BatchCreate, Book: &models.Book{Title: "Emma", Author: "Jane Austen"}},
+		{Op: models.BatchDelete, ID: dune.ID.String(), Version: 2},
+	}
+
+	results, err := store.ApplyBatch(ctx, ops, true)
+	if err != nil || results[0].Err != ErrBatchAborted || results[1].Err != ErrVersionMismatch {
+		t.Fatalf("Expected the atomic batch to abort on the stale delete, got %+v (err: %v)", results, err)
+	}
+	if n, _ := store.CountBooks(ctx, models.BookFilter{}); n != 1 {
+		t.Errorf("Expected the create to be undone, got %d books", n)
+	}
+	if entries, _ := store.GetAuditLog(ctx, models.AuditQuery{Limit: 10}); len(entries) != 1 {
+		t.Errorf("Expected the audit of the create to be undone, got %+v", entries)
+	}
+
+	results, err = store.ApplyBatch(ctx, ops, false)
+	if err != nil || results[0].Err != nil || results[0].Book.Title != "Emma" || results[1].Err != ErrVersionMismatch {
+		t.Fatalf("Expected the partial batch to keep the create, got %+v (err: %v)", results, err)
+	}
+	if n, _ := store.CountBooks(ctx, models.BookFilter{}); n != 2 {
+		t.Errorf("Expected 2 books, got %d", n)
+	}
+}
@@ -4,16 +4,26 @@ import (
 	"context"
 	"database/sql"
 	"digicert-library-app/internal/models"
+	"strings"
+	"time"
 
-	"github.com/go-sql-driver/mysql"
 	"github.com/google/uuid"
 )
 
 // CRUD functions using the helper functions
-func (d *Database) GetBooks(ctx context.Context, limit, offset int) ([]models.Book, error) {
+func (d *Database) GetBooks(ctx context.Context, q models.BookQuery) ([]models.Book, error) {
 	books := []models.Book{}
-	query := "SELECT " + getBookColumnsString() + " FROM books LIMIT ? OFFSET ?"
-	rows, err := d.Conn.QueryContext(ctx, query, limit, offset)
+	conditions, args := d.buildConditions(q.Filter)
+	offset := q.Offset
+	if q.After != nil {
+		condition, cursorArgs := d.buildCursorCondition(q.Sort, *q.After)
+		conditions = append(conditions, condition)
+		args = append(args, cursorArgs...)
+		offset = 0
+	}
+	query := "SELECT " + getBookColumnsString() + " FROM books" + joinConditions(conditions) + buildOrderByClause(q.Sort) + " LIMIT ? OFFSET ?"
+	args = append(args, q.Limit, offset)
+	rows, err := d.Conn.QueryContext(ctx, d.dialect().rebind(query), args...)
 	if err != nil {
 		return books, err
 	}
@@ -33,9 +43,42 @@ func (d *Database) GetBooks(ctx context.Context, limit, offset int) ([]models.Bo
 	return books, nil
 }
 
+func (d *Database) CountBooks(ctx context.Context, filter models.BookFilter) (int, error) {
+	where, args := d.buildWhereClause(filter)
+	query := "SELECT COUNT(*) FROM books" + where
+
+	var count int
+	if err := d.Conn.QueryRowContext(ctx, d.dialect().rebind(query), args...).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (d *Database) BookStats(ctx context.Context, filter models.BookFilter) (models.BookStats, error) {
+	// the first condition picks live or trashed books and takes no argument.
+	// LastModified spans both, so moving a book to or from the trash, which
+	// updates it, moves the LastModified of the list it left too.
+	conditions, args := d.buildConditions(filter)
+	state := conditions[0]
+	query := "SELECT COALESCE(SUM(CASE WHEN " + state + " THEN 1 ELSE 0 END), 0), MAX(updated_at)," +
+		" COALESCE(SUM(CASE WHEN " + state + " THEN version ELSE 0 END), 0) FROM books" + joinConditions(conditions[1:])
+
+	var stats models.BookStats
+	var lastModified interface{}
+	if err := d.Conn.QueryRowContext(ctx, d.dialect().rebind(query), args...).Scan(&stats.Count, &lastModified, &stats.VersionSum); err != nil {
+		return stats, err
+	}
+	t, err := d.dialect().parseTime(lastModified)
+	if err != nil {
+		return stats, err
+	}
+	stats.LastModified = t
+	return stats, nil
+}
+
 func (d *Database) GetBookByID(ctx context.Context, id string) (models.Book, error) {
-	query := "SELECT " + getBookColumnsString() + " FROM books WHERE id = ?"
-	row := d.Conn.QueryRowContext(ctx, query, id)
+	query := "SELECT " + getBookColumnsString() + " FROM books WHERE id = ? AND " + liveCondition
+	row := d.Conn.QueryRowContext(ctx, d.dialect().rebind(query), id)
 
 	book, err := scanBookRow(row)
 	if err != nil {
@@ -47,53 +90,235 @@ func (d *Database) GetBookByID(ctx context.Context, id string) (models.Book, err
 	return book, nil
 }
 
-func (d *Database) CreateBook(ctx context.Context, newBook models.Book) (string, error) {
-	id := uuid.New()
-	query := "INSERT INTO books (" + getInsertColumnsString() + ") VALUES (" + getInsertPlaceholders() + ")"
-	values := getInsertValues(id, newBook)
+func (d *Database) BookExists(ctx context.Context, id string) (bool, error) {
+	var count int
+	query := "SELECT COUNT(*) FROM books WHERE id = ?"
+	if err := d.Conn.QueryRowContext(ctx, d.dialect().rebind(query), id).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
 
-	_, err := d.Conn.ExecContext(ctx, query, values...)
-	if err != nil {
-		// Check for duplicate entry error (MySQL error code 1062)
-		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
-			return "", err
+func (d *Database) GetBookByISBN(ctx context.Context, isbn string) (models.Book, error) {
+	query := "SELECT " + getBookColumnsString() + " FROM books WHERE isbn = ? AND " + liveCondition
+	return scanBookRow(d.Conn.QueryRowContext(ctx, d.dialect().rebind(query), isbn))
+}
+
+// duplicatesChunk is how many books FindDuplicates looks up per query, up to
+// 600 placeholders, well within the limit of every dialect
+const duplicatesChunk = 200
+
+func (d *Database) FindDuplicates(ctx context.Context, books []models.Book) ([]models.Book, error) {
+	found := []models.Book{}
+	for start := 0; start < len(books); start += duplicatesChunk {
+		var matches []string
+		var args []interface{}
+		for _, book := range books[start:min(start+duplicatesChunk, len(books))] {
+			matches = append(matches, "(LOWER(TRIM(title)) = LOWER(?) AND LOWER(TRIM(author)) = LOWER(?))")
+			args = append(args, strings.TrimSpace(book.Title), strings.TrimSpace(book.Author))
+			if book.ISBN != "" {
+				matches = append(matches, "isbn = ?")
+				args = append(args, book.ISBN)
+			}
+		}
+		query := "SELECT " + getBookColumnsString() + " FROM books WHERE " + liveCondition +
+			" AND (" + strings.Join(matches, " OR ") + ") ORDER BY id"
+		rows, err := d.Conn.QueryContext(ctx, d.dialect().rebind(query), args...)
+		if err != nil {
+			return found, err
+		}
+		for rows.Next() {
+			book, err := scanBookRows(rows)
+			if err != nil {
+				rows.Close()
+				return found, err
+			}
+			found = append(found, book)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return found, err
 		}
-		return "", err
 	}
-	return "Book Inserted", nil
+	return found, nil
 }
 
-func (d *Database) UpdateBook(ctx context.Context, id string, updatedBook models.Book) (string, error) {
-	query := "UPDATE books SET " + getUpdateColumnsString() + " WHERE id = ?"
-	values := getUpdateValues(updatedBook, id)
+func (d *Database) CreateBook(ctx context.Context, newBook models.Book) (models.Book, error) {
+	var book models.Book
+	err := d.inTx(ctx, func(tx *sql.Tx) (err error) {
+		book, err = d.createBook(ctx, tx, newBook)
+		return err
+	})
+	return book, err
+}
 
-	result, err := d.Conn.ExecContext(ctx, query, values...)
+func (d *Database) UpdateBook(ctx context.Context, id string, updatedBook models.Book, version int) (models.Book, error) {
+	var book models.Book
+	err := d.inTx(ctx, func(tx *sql.Tx) (err error) {
+		book, err = d.updateBook(ctx, tx, id, updatedBook, version)
+		return err
+	})
+	return book, err
+}
+
+func (d *Database) PatchBook(ctx context.Context, id string, fields map[string]interface{}, version int) (models.Book, error) {
+	setClause, values, err := buildPatchSetClause(fields)
 	if err != nil {
-		return "", err
+		return models.Book{}, err
 	}
+	if setClause == "" {
+		// nothing to write, but the precondition still applies
+		book, err := d.GetBookByID(ctx, id)
+		if err == nil && version != 0 && book.Version != version {
+			return models.Book{}, ErrVersionMismatch
+		}
+		return book, err
+	}
+
+	query := "UPDATE books SET " + setClause + " WHERE id = ?"
+	var book models.Book
+	err = d.inTx(ctx, func(tx *sql.Tx) (err error) {
+		book, err = d.updateLiveBook(ctx, tx, id, version, models.AuditUpdate, query, append(values, id))
+		return err
+	})
+	return book, err
+}
 
-	rowsAffected, err := result.RowsAffected()
+// DeleteBook moves a book to the trash, PurgeDeletedBooks removes it for good
+func (d *Database) DeleteBook(ctx context.Context, id string, version int) (string, error) {
+	err := d.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := d.deleteBook(ctx, tx, id, version)
+		return err
+	})
 	if err != nil {
 		return "", err
 	}
-	if rowsAffected == 0 {
-		return "", sql.ErrNoRows
+	return "Book Deleted", nil
+}
+
+// createBook inserts newBook under a fresh id within tx and returns it as
+// stored
+func (d *Database) createBook(ctx context.Context, tx *sql.Tx, newBook models.Book) (models.Book, error) {
+	id := uuid.New()
+	query := "INSERT INTO books (" + getInsertColumnsString() + ") VALUES (" + getInsertPlaceholders() + ")"
+	if _, err := tx.ExecContext(ctx, d.dialect().rebind(query), getInsertValues(id, newBook)...); err != nil {
+		return models.Book{}, d.writeError(err)
+	}
+	// Read the row back so server-set columns are reflected in the result
+	book, err := d.readBook(ctx, tx, id.String())
+	if err != nil {
+		return models.Book{}, err
 	}
-	return "Book Updated", nil
+	if err := d.writeAudit(ctx, tx, newAuditEntry(ctx, models.AuditCreate, book.ID, nil, &book)); err != nil {
+		return models.Book{}, err
+	}
+	return book, nil
+}
+
+// updateBook replaces the fields of a live book within tx
+func (d *Database) updateBook(ctx context.Context, tx *sql.Tx, id string, updatedBook models.Book, version int) (models.Book, error) {
+	query := "UPDATE books SET " + getUpdateColumnsString() + " WHERE id = ?"
+	return d.updateLiveBook(ctx, tx, id, version, models.AuditUpdate, query, getUpdateValues(updatedBook, id))
+}
+
+// deleteBook moves a live book to the trash within tx
+func (d *Database) deleteBook(ctx context.Context, tx *sql.Tx, id string, version int) (models.Book, error) {
+	query := "UPDATE books SET deleted_at = CURRENT_TIMESTAMP, " + bumpVersion + " WHERE id = ?"
+	return d.updateLiveBook(ctx, tx, id, version, models.AuditDelete, query, []interface{}{id})
 }
 
-func (d *Database) DeleteBook(ctx context.Context, id string) (string, error) {
-	query := "DELETE FROM books WHERE id = ?"
-	result, err := d.Conn.ExecContext(ctx, query, id)
+// updateLiveBook runs query, an UPDATE of the live book id, within tx once
+// the book is locked and found at the expected version, and audits the
+// change. It returns the book as the update left it.
+func (d *Database) updateLiveBook(ctx context.Context, tx *sql.Tx, id string, version int, action, query string, args []interface{}) (models.Book, error) {
+	before, err := d.lockBook(ctx, tx, id, liveCondition)
 	if err != nil {
-		return "", err
+		return models.Book{}, err
+	}
+	if version != 0 && before.Version != version {
+		return models.Book{}, ErrVersionMismatch
+	}
+	if _, err := tx.ExecContext(ctx, d.dialect().rebind(query), args...); err != nil {
+		return models.Book{}, d.writeError(err)
 	}
-	rowsAffected, err := result.RowsAffected()
+	after, err := d.readBook(ctx, tx, id)
 	if err != nil {
-		return "", err
+		return models.Book{}, err
 	}
-	if rowsAffected == 0 {
-		return "", sql.ErrNoRows
+	if err := d.writeAudit(ctx, tx, newAuditEntry(ctx, action, before.ID, &before, &after)); err != nil {
+		return models.Book{}, err
 	}
-	return "Book Deleted", nil
+	return after, nil
+}
+
+// writeError translates the error of a books INSERT or UPDATE. The ids are
+// generated, so the ISBN is the only unique column a write can clash on.
+func (d *Database) writeError(err error) error {
+	if d.dialect().isDuplicateKey(err) {
+		return ErrDuplicateISBN
+	}
+	return err
+}
+
+func (d *Database) RestoreBook(ctx context.Context, id string) (models.Book, error) {
+	query := "UPDATE books SET deleted_at = NULL, " + bumpVersion + " WHERE id = ?"
+	var book models.Book
+	err := d.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := d.lockBook(ctx, tx, id, trashCondition)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, d.dialect().rebind(query), id); err != nil {
+			return err
+		}
+		book, err = d.readBook(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		return d.writeAudit(ctx, tx, newAuditEntry(ctx, models.AuditRestore, before.ID, &before, &book))
+	})
+	if err != nil {
+		return models.Book{}, err
+	}
+	return book, nil
+}
+
+func (d *Database) PurgeDeletedBooks(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	err := d.inTx(ctx, func(tx *sql.Tx) error {
+		query := "SELECT " + getBookColumnsString() + " FROM books WHERE " + trashCondition + " AND deleted_at < ?" + d.dialect().lockClause()
+		rows, err := tx.QueryContext(ctx, d.dialect().rebind(query), d.dialect().timeArg(before))
+		if err != nil {
+			return err
+		}
+		var books []models.Book
+		for rows.Next() {
+			book, err := scanBookRows(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			books = append(books, book)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, book := range books {
+			if _, err := tx.ExecContext(ctx, d.dialect().rebind("DELETE FROM books WHERE id = ?"), book.ID.String()); err != nil {
+				return err
+			}
+			if err := d.writeAudit(ctx, tx, newAuditEntry(ctx, models.AuditPurge, book.ID, &book, nil)); err != nil {
+				return err
+			}
+		}
+		purged = int64(len(books))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
 }
@@ -0,0 +1,629 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/requestctx"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+)
+
+const testBookID = "123e4567-e89b-12d3-a456-426614174000"
+
+var (
+	bookColumns = []string{"id", "title", "author", "published_year", "genre", "isbn", "created_at", "updated_at", "version", "deleted_at"}
+	testTime    = time.Date(2025, 5, 7, 23, 24, 45, 0, time.UTC)
+)
+
+func getMockDatabase(t *testing.T) (*Database, sqlmock.Sqlmock) {
+	return getMockDialectDatabase(t, "")
+}
+
+func getMockDialectDatabase(t *testing.T, dialect Dialect) (*Database, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &Database{Conn: db, Dialect: dialect}, mock
+}
+
+func TestGetBooks_ScansRows(t *testing.T) {
+	d, mock := getMockDatabase(t)
+	rows := sqlmock.NewRows(bookColumns).
+		AddRow("123e4567-e89b-12d3-a456-426614174000", "Book One", "Author One", 2020, "Fiction", nil, testTime, testTime, 1, nil).
+		AddRow("123e4567-e89b-12d3-a456-426614174001", "Book Two", "Author Two", 2021, "Non-Fiction", nil, testTime, testTime, 1, nil)
+	mock.ExpectQuery("SELECT id, title, author, published_year, genre, isbn, created_at, updated_at, version, deleted_at FROM books WHERE deleted_at IS NULL ORDER BY id ASC LIMIT \\? OFFSET \\?").
+		WithArgs(10, 0).
+		WillReturnRows(rows)
+
+	books, err := d.GetBooks(context.Background(), models.BookQuery{Limit: 10})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(books) != 2 {
+		t.Errorf("Expected 2 books, got %d", len(books))
+	}
+	if !books[0].CreatedAt.Equal(testTime) || !books[0].UpdatedAt.Equal(testTime) {
+		t.Errorf("Expected timestamps to be scanned, got %v / %v", books[0].CreatedAt, books[0].UpdatedAt)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGetBooks_DBError(t *testing.T) {
+	d, mock := getMockDatabase(t)
+	mock.ExpectQuery("SELECT id, title, author, published_year, genre, isbn, created_at, updated_at, version, deleted_at FROM books").WillReturnError(errors.New("db error"))
+
+	if _, err := d.GetBooks(context.Background(), models.BookQuery{Limit: 10}); err == nil {
+		t.Errorf("Expected error, got nil")
+	}
+}
+
+func TestGetBooks_FiltersAndSorts(t *testing.T) {
+	d, mock := getMockDatabase(t)
+	since := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT .* FROM books WHERE deleted_at IS NULL AND updated_at >= \\? ORDER BY updated_at DESC, id ASC LIMIT \\? OFFSET \\?").
+		WithArgs(since, 5, 10).
+		WillReturnRows(sqlmock.NewRows(bookColumns))
+
+	_, err := d.GetBooks(context.Background(), models.BookQuery{
+		Filter: models.BookFilter{UpdatedSince: since},
+		Sort:   []models.SortField{{Field: "updated_at", Desc: true}, {Field: "unknown"}},
+		Limit:  5,
+		Offset: 10,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGetBooks_FieldFilters(t *testing.T) {
+	d, mock := getMockDatabase(t)
+	where := "WHERE deleted_at IS NULL AND LOWER\\(author\\) = LOWER\\(\\?\\) AND LOWER\\(genre\\) = LOWER\\(\\?\\) " +
+		"AND LOWER\\(title\\) LIKE LOWER\\(\\?\\) ESCAPE '!' AND published_year >= \\? AND published_year <= \\? "
+	order := "ORDER BY title ASC, COALESCE\\(published_year, 0\\) DESC, id ASC "
+	mock.ExpectQuery("SELECT .* FROM books "+where+order+"LIMIT \\? OFFSET \\?").
+		WithArgs("Frank Herbert", "sci-fi", "%100!%!_dune%", 1960, 1970, 10, 0).
+		WillReturnRows(sqlmock.NewRows(bookColumns))
+
+	_, err := d.GetBooks(context.Background(), models.BookQuery{
+		Filter: models.BookFilter{Author: "Frank Herbert", Genre: "sci-fi", Title: "100%_dune", YearMin: 1960, YearMax: 1970},
+		Sort:   []models.SortField{{Field: "title"}, {Field: "published_year", Desc: true}},
+		Limit:  10,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestCountBooks_RespectsFilter(t *testing.T) {
+	d, mock := getMockDatabase(t)
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM books WHERE deleted_at IS NULL AND LOWER\\(genre\\) = LOWER\\(\\?\\)").
+		WithArgs("Fiction").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(42))
+
+	count, err := d.CountBooks(context.Background(), models.BookFilter{Genre: "Fiction"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count != 42 {
+		t.Errorf("Expected 42, got %d", count)
+	}
+}
+
+func TestBuildOrderByClause(t *testing.T) {
+	tests := []struct {
+		sort []models.SortField
+		want string
+	}{
+		{nil, " ORDER BY id ASC"},
+		{[]models.SortField{{Field: "author", Desc: true}}, " ORDER BY COALESCE(author, '') DESC, id ASC"},
+		{[]models.SortField{{Field: "id", Desc: true}, {Field: "title"}}, " ORDER BY id DESC"},
+		{[]models.SortField{{Field: "title; DROP TABLE books"}}, " ORDER BY id ASC"},
+	}
+	for _, tt := range tests {
+		if got := buildOrderByClause(tt.sort); got != tt.want {
+			t.Errorf("buildOrderByClause(%+v) = %q, want %q", tt.sort, got, tt.want)
+		}
+	}
+}
+
+func TestBuildCursorCondition(t *testing.T) {
+	d := &Database{Dialect: Postgres}
+	sortFields := []models.SortField{{Field: "author"}, {Field: "published_year", Desc: true}}
+	cursor := models.Cursor{Values: []interface{}{"Herbert", 1965}, ID: testBookID}
+
+	condition, args := d.buildCursorCondition(sortFields, cursor)
+	want := "((COALESCE(author, '') > ?) OR (COALESCE(author, '') = ? AND COALESCE(published_year, 0) < ?) OR " +
+		"(COALESCE(author, '') = ? AND COALESCE(published_year, 0) = ? AND id > ?))"
+	if condition != want {
+		t.Errorf("Unexpected condition\n got: %s\nwant: %s", condition, want)
+	}
+	if len(args) != 6 || args[0] != "Herbert" || args[2] != 1965 || args[5] != testBookID {
+		t.Errorf("Unexpected args %v", args)
+	}
+}
+
+func TestBookStats(t *testing.T) {
+	d, mock := getMockDatabase(t)
+	mock.ExpectQuery("SELECT COALESCE\\(SUM\\(CASE WHEN deleted_at IS NULL THEN 1 ELSE 0 END\\), 0\\), MAX\\(updated_at\\)," +
+		" COALESCE\\(SUM\\(CASE WHEN deleted_at IS NULL THEN version ELSE 0 END\\), 0\\) FROM books WHERE LOWER\\(genre\\) = LOWER\\(\\?\\)").
+		WithArgs("Sci-Fi").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "max", "sum"}).AddRow(3, testTime, 7))
+
+	stats, err := d.BookStats(context.Background(), models.BookFilter{Genre: "Sci-Fi"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Count != 3 || stats.VersionSum != 7 || !stats.LastModified.Equal(testTime) {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestGetBookByID_NotFound(t *testing.T) {
+	d, mock := getMockDatabase(t)
+	mock.ExpectQuery("SELECT id, title, author, published_year, genre, isbn, created_at, updated_at, version, deleted_at FROM books WHERE id = \\? AND deleted_at IS NULL").
+		WithArgs(testBookID).
+		WillReturnRows(sqlmock.NewRows(bookColumns))
+
+	if _, err := d.GetBookByID(context.Background(), testBookID); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestBookExists(t *testing.T) {
+	d, mock := getMockDatabase(t)
+	// trashed books count, the query doesn't look at deleted_at
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM books WHERE id = \\?$").
+		WithArgs(testBookID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	if exists, err := d.BookExists(context.Background(), testBookID); err != nil || !exists {
+		t.Errorf("Expected the book to exist, got %v (err: %v)", exists, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	d, mock := getMockDatabase(t)
+	const titleAuthor = "\\(LOWER\\(TRIM\\(title\\)\\) = LOWER\\(\\?\\) AND LOWER\\(TRIM\\(author\\)\\) = LOWER\\(\\?\\)\\)"
+	mock.ExpectQuery("SELECT .* FROM books WHERE deleted_at IS NULL AND \\("+titleAuthor+" OR isbn = \\? OR "+titleAuthor+"\\) ORDER BY id$").
+		WithArgs("Dune", "Frank Herbert", "9780441172719", "Emma", "Jane Austen").
+		WillReturnRows(bookRows("Dune", 1, nil))
+
+	books := []models.Book{
+		{Title: " Dune ", Author: "Frank Herbert", ISBN: "9780441172719"},
+		{Title: "Emma", Author: "Jane Austen"},
+	}
+	found, err := d.FindDuplicates(context.Background(), books)
+	if err != nil || len(found) != 1 {
+		t.Errorf("Expected one duplicate, got %+v (err: %v)", found, err)
+	}
+
+	// long imports are looked up a chunk at a time
+	many := make([]models.Book, duplicatesChunk+1)
+	for i := range many {
+		many[i] = models.Book{Title: "Book", Author: "Author"}
+	}
+	mock.ExpectQuery("SELECT .* FROM books WHERE").WillReturnRows(sqlmock.NewRows(bookColumns))
+	mock.ExpectQuery("SELECT .* FROM books WHERE deleted_at IS NULL AND \\("+titleAuthor+"\\) ORDER BY id$").
+		WithArgs("Book", "Author").
+		WillReturnRows(sqlmock.NewRows(bookColumns))
+	if _, err := d.FindDuplicates(context.Background(), many); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+// bookRows returns the test book as a single result row
+func bookRows(title string, version int, deletedAt interface{}) *sqlmock.Rows {
+	return sqlmock.NewRows(bookColumns).
+		AddRow(testBookID, title, "Test Author", 2023, "Fiction", nil, testTime, testTime, version, deletedAt)
+}
+
+const (
+	lockLiveBookQuery  = "SELECT id, title, author, published_year, genre, isbn, created_at, updated_at, version, deleted_at FROM books WHERE id = \\? AND deleted_at IS NULL FOR UPDATE"
+	lockTrashBookQuery = "SELECT .* FROM books WHERE id = \\? AND deleted_at IS NOT NULL FOR UPDATE"
+	readBookQuery      = "SELECT .* FROM books WHERE id = \\?$"
+	insertAuditQuery   = "INSERT INTO book_audit \\(book_id, action, actor, request_id, changes\\) VALUES \\(\\?, \\?, \\?, \\?, \\?\\)"
+)
+
+func TestCreateBook_InsertsAllColumns(t *testing.T) {
+	d, mock := getMockDatabase(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO books \\(id, title, author, published_year, genre, isbn\\) VALUES \\(\\?, \\?, \\?, \\?, \\?, \\?\\)").
+		WithArgs(sqlmock.AnyArg(), "Test Book", "Test Author", 2023, "Fiction", nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(readBookQuery).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(bookRows("Test Book", 1, nil))
+	mock.ExpectExec(insertAuditQuery).
+		WithArgs(testBookID, "create", "librarian", "req-1", `{"author":{"before":null,"after":"Test Author"},"genre":{"before":null,"after":"Fiction"},"published_year":{"before":null,"after":2023},"title":{"before":null,"after":"Test Book"}}`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	ctx := requestctx.WithRequestID(requestctx.WithActor(context.Background(), "librarian"), "req-1")
+	book := models.Book{Title: "Test Book", Author: "Test Author", PublishedYear: 2023, Genre: "Fiction"}
+	created, err := d.CreateBook(ctx, book)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if created.ID.String() != testBookID {
+		t.Errorf("Expected the persisted book to be returned, got %+v", created)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestCreateBook_RollsBackWhenAuditFails(t *testing.T) {
+	d, mock := getMockDatabase(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO books").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(readBookQuery).WillReturnRows(bookRows("Test Book", 1, nil))
+	mock.ExpectExec(insertAuditQuery).WillReturnError(errors.New("disk full"))
+	mock.ExpectRollback()
+
+	if _, err := d.CreateBook(context.Background(), models.Book{Title: "Test Book"}); err == nil {
+		t.Error("Expected the audit failure to fail the create")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestCreateBook_DuplicateISBN(t *testing.T) {
+	d, mock := getMockDatabase(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO books").
+		WithArgs(sqlmock.AnyArg(), "Dune", "Frank Herbert", 0, "", "9780441172719").
+		WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry '9780441172719' for key 'idx_books_isbn'"})
+	mock.ExpectRollback()
+
+	_, err := d.CreateBook(context.Background(), models.Book{Title: "Dune", Author: "Frank Herbert", ISBN: "9780441172719"})
+	if err != ErrDuplicateISBN {
+		t.Errorf("Expected ErrDuplicateISBN, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestUpdateBook_NotFound(t *testing.T) {
+	d, mock := getMockDatabase(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockLiveBookQuery).
+		WithArgs(testBookID).
+		WillReturnRows(sqlmock.NewRows(bookColumns))
+	mock.ExpectRollback()
+
+	book := models.Book{Title: "Updated Title", Author: "Updated Author"}
+	if _, err := d.UpdateBook(context.Background(), testBookID, book, 0); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestPatchBook_UpdatesOnlyGivenColumns(t *testing.T) {
+	d, mock := getMockDatabase(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockLiveBookQuery).
+		WithArgs(testBookID).
+		WillReturnRows(bookRows("Dune", 1, nil))
+	mock.ExpectExec("UPDATE books SET title = \\?, genre = \\?, version = version \\+ 1 WHERE id = \\?").
+		WithArgs("Dune Messiah", "", testBookID).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(readBookQuery).
+		WithArgs(testBookID).
+		WillReturnRows(sqlmock.NewRows(bookColumns).
+			AddRow(testBookID, "Dune Messiah", "Test Author", 2023, "", nil, testTime, testTime, 2, nil))
+	mock.ExpectExec(insertAuditQuery).
+		WithArgs(testBookID, "update", unknownActor, "", `{"genre":{"before":"Fiction","after":null},"title":{"before":"Dune","after":"Dune Messiah"}}`).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+
+	book, err := d.PatchBook(context.Background(), testBookID, map[string]interface{}{"genre": "", "title": "Dune Messiah"}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if book.Title != "Dune Messiah" || book.PublishedYear != 2023 || book.Version != 2 {
+		t.Errorf("Expected the updated book to be returned, got %+v", book)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestPatchBook_RejectsUnknownColumns(t *testing.T) {
+	d, mock := getMockDatabase(t)
+	if _, err := d.PatchBook(context.Background(), testBookID, map[string]interface{}{"id": testBookID}, 0); err == nil {
+		t.Error("Expected an error patching id")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestPatchBook_NotFound(t *testing.T) {
+	d, mock := getMockDatabase(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockLiveBookQuery).
+		WithArgs(testBookID).
+		WillReturnRows(sqlmock.NewRows(bookColumns))
+	mock.ExpectRollback()
+
+	if _, err := d.PatchBook(context.Background(), testBookID, map[string]interface{}{"author": "Jane Austen"}, 0); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestUpdateBook_VersionMismatch(t *testing.T) {
+	d, mock := getMockDatabase(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockLiveBookQuery).
+		WithArgs(testBookID).
+		WillReturnRows(bookRows("Test Book", 4, nil))
+	mock.ExpectRollback()
+
+	book := models.Book{Title: "Updated Title", Author: "Updated Author"}
+	if _, err := d.UpdateBook(context.Background(), testBookID, book, 3); err != ErrVersionMismatch {
+		t.Errorf("Expected ErrVersionMismatch, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestDeleteBook_VersionedNotFound(t *testing.T) {
+	d, mock := getMockDatabase(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockLiveBookQuery).
+		WithArgs(testBookID).
+		WillReturnRows(sqlmock.NewRows(bookColumns))
+	mock.ExpectRollback()
+
+	if _, err := d.DeleteBook(context.Background(), testBookID, 3); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for a missing book, got %v", err)
+	}
+}
+
+func TestDeleteBook_Valid(t *testing.T) {
+	d, mock := getMockDatabase(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockLiveBookQuery).
+		WithArgs(testBookID).
+		WillReturnRows(bookRows("Test Book", 1, nil))
+	mock.ExpectExec("UPDATE books SET deleted_at = CURRENT_TIMESTAMP, version = version \\+ 1 WHERE id = \\?").
+		WithArgs(testBookID).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(readBookQuery).
+		WithArgs(testBookID).
+		WillReturnRows(bookRows("Test Book", 2, testTime))
+	mock.ExpectExec(insertAuditQuery).
+		WithArgs(testBookID, "delete", unknownActor, "", `{"deleted_at":{"before":null,"after":"2025-05-07T23:24:45Z"}}`).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectCommit()
+
+	if _, err := d.DeleteBook(context.Background(), testBookID, 0); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestRestoreBook(t *testing.T) {
+	d, mock := getMockDatabase(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockTrashBookQuery).
+		WithArgs(testBookID).
+		WillReturnRows(sqlmock.NewRows(bookColumns))
+	mock.ExpectRollback()
+
+	if _, err := d.RestoreBook(context.Background(), testBookID); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for a book not in the trash, got %v", err)
+	}
+}
+
+func TestPurgeDeletedBooks(t *testing.T) {
+	d, mock := getMockDatabase(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .* FROM books WHERE deleted_at IS NOT NULL AND deleted_at < \\? FOR UPDATE").
+		WithArgs(testTime).
+		WillReturnRows(bookRows("Test Book", 2, testTime))
+	mock.ExpectExec("DELETE FROM books WHERE id = \\?").
+		WithArgs(testBookID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertAuditQuery).
+		WithArgs(testBookID, "purge", "purge-job", "", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(4, 1))
+	mock.ExpectCommit()
+
+	ctx := requestctx.WithActor(context.Background(), "purge-job")
+	purged, err := d.PurgeDeletedBooks(ctx, testTime)
+	if err != nil || purged != 1 {
+		t.Errorf("Expected 1 book purged, got %d (err: %v)", purged, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGetAuditLog(t *testing.T) {
+	d, mock := getMockDatabase(t)
+	since := testTime.Add(-time.Hour)
+	rows := sqlmock.NewRows([]string{"id", "book_id", "action", "actor", "request_id", "changes", "created_at"}).
+		AddRow(7, testBookID, "update", "librarian", "req-1", `{"published_year":{"before":1965,"after":1966}}`, testTime)
+	mock.ExpectQuery("SELECT id, book_id, action, actor, request_id, changes, created_at FROM book_audit "+
+		"WHERE book_id = \\? AND actor = \\? AND created_at >= \\? ORDER BY id ASC LIMIT \\? OFFSET \\?").
+		WithArgs(testBookID, "librarian", since, 10, 0).
+		WillReturnRows(rows)
+
+	entries, err := d.GetAuditLog(context.Background(), models.AuditQuery{
+		Filter: models.AuditFilter{BookID: testBookID, Actor: "librarian", Since: since},
+		Limit:  10,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].ID != 7 || entries[0].RequestID != "req-1" {
+		t.Fatalf("Unexpected entries %+v", entries)
+	}
+	change := entries[0].Changes["published_year"]
+	if change.Before != json.Number("1965") || change.After != json.Number("1966") {
+		t.Errorf("Expected the year change to be decoded, got %+v", change)
+	}
+}
+
+func TestPostgres_GetBookByID(t *testing.T) {
+	d, mock := getMockDialectDatabase(t, Postgres)
+	rows := sqlmock.NewRows(bookColumns).
+		AddRow(testBookID, "Test Book", "Test Author", 2023, "Fiction", nil, testTime, testTime, 1, nil)
+	mock.ExpectQuery("SELECT id, title, author, published_year, genre, isbn, created_at, updated_at, version, deleted_at FROM books WHERE id = \\$1 AND deleted_at IS NULL").
+		WithArgs(testBookID).
+		WillReturnRows(rows)
+
+	book, err := d.GetBookByID(context.Background(), testBookID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if book.Title != "Test Book" {
+		t.Errorf("Expected title Test Book, got %q", book.Title)
+	}
+}
+
+func TestPostgres_CreateBook(t *testing.T) {
+	d, mock := getMockDialectDatabase(t, Postgres)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO books \\(id, title, author, published_year, genre, isbn\\) VALUES \\(\\$1, \\$2, \\$3, \\$4, \\$5, \\$6\\)").
+		WithArgs(sqlmock.AnyArg(), "Test Book", "Test Author", 2023, "Fiction", nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT id, title, author, published_year, genre, isbn, created_at, updated_at, version, deleted_at FROM books WHERE id = \\$1").
+		WillReturnRows(bookRows("Test Book", 1, nil))
+	mock.ExpectExec("INSERT INTO book_audit \\(book_id, action, actor, request_id, changes\\) VALUES \\(\\$1, \\$2, \\$3, \\$4, \\$5\\)").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	book := models.Book{Title: "Test Book", Author: "Test Author", PublishedYear: 2023, Genre: "Fiction"}
+	if _, err := d.CreateBook(context.Background(), book); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestPostgres_UpdateBook(t *testing.T) {
+	d, mock := getMockDialectDatabase(t, Postgres)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .* FROM books WHERE id = \\$1 AND deleted_at IS NULL FOR UPDATE").
+		WithArgs(testBookID).
+		WillReturnRows(bookRows("Test Book", 1, nil))
+	mock.ExpectExec("UPDATE books SET title = \\$1, author = \\$2, published_year = \\$3, genre = \\$4, isbn = \\$5, version = version \\+ 1 WHERE id = \\$6").
+		WithArgs("Updated Title", "Updated Author", 2024, "Drama", nil, testBookID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT .* FROM books WHERE id = \\$1").
+		WillReturnRows(bookRows("Updated Title", 2, nil))
+	mock.ExpectExec("INSERT INTO book_audit").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	book := models.Book{Title: "Updated Title", Author: "Updated Author", PublishedYear: 2024, Genre: "Drama"}
+	if _, err := d.UpdateBook(context.Background(), testBookID, book, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestSQLite_DeleteBookNotFound(t *testing.T) {
+	d, mock := getMockDialectDatabase(t, SQLite)
+	mock.ExpectBegin()
+	// SQLite has no row locks, the transaction alone serializes writers
+	mock.ExpectQuery("SELECT .* FROM books WHERE id = \\? AND deleted_at IS NULL$").
+		WithArgs(testBookID).
+		WillReturnRows(sqlmock.NewRows(bookColumns))
+	mock.ExpectRollback()
+
+	if _, err := d.DeleteBook(context.Background(), testBookID, 0); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestApplyBatch_PartialRollsBackFailedOperations(t *testing.T) {
+	d, mock := getMockDatabase(t)
+	mock.ExpectBegin()
+	// the first delete targets a missing book and is undone on its own
+	mock.ExpectExec("SAVEPOINT batch_item").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(lockLiveBookQuery).WithArgs(testBookID).WillReturnRows(sqlmock.NewRows(bookColumns))
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT batch_item").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SAVEPOINT batch_item").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO books").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(readBookQuery).WillReturnRows(bookRows("Emma", 1, nil))
+	mock.ExpectExec(insertAuditQuery).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("RELEASE SAVEPOINT batch_item").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	results, err := d.ApplyBatch(context.Background(), []models.BatchOperation{
+		{Op: models.BatchDelete, ID: testBookID},
+		{Op: models.BatchCreate, Book: &models.Book{Title: "Emma", Author: "Jane Austen"}},
+	}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if results[0].Err != sql.ErrNoRows || results[1].Err != nil || results[1].Book.Title != "Emma" {
+		t.Errorf("Unexpected results %+v", results)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestApplyBatch_AtomicRollsBackEverything(t *testing.T) {
+	d, mock := getMockDatabase(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO books").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(readBookQuery).WillReturnRows(bookRows("Emma", 1, nil))
+	mock.ExpectExec(insertAuditQuery).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(lockLiveBookQuery).WithArgs(testBookID).WillReturnRows(bookRows("Dune", 4, nil))
+	mock.ExpectRollback()
+
+	results, err := d.ApplyBatch(context.Background(), []models.BatchOperation{
+		{Op: models.BatchCreate, Book: &models.Book{Title: "Emma", Author: "Jane Austen"}},
+		{Op: models.BatchDelete, ID: testBookID, Version: 3},
+		{Op: models.BatchDelete, ID: testBookID},
+	}, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if results[0].Err != ErrBatchAborted || results[1].Err != ErrVersionMismatch || results[2].Err != ErrBatchAborted {
+		t.Errorf("Unexpected results %+v", results)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"context"
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/search"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// postgresSearchVector must match the expression of the books_search_idx GIN
+// index for Postgres to use it
+const postgresSearchVector = "to_tsvector('simple', COALESCE(title, '') || ' ' || COALESCE(author, '') || ' ' || COALESCE(genre, ''))"
+
+func (d *Database) SearchBooks(ctx context.Context, q search.Query, limit, offset int) ([]models.SearchResult, error) {
+	var query string
+	var args []interface{}
+
+	switch d.dialect() {
+	case Postgres:
+		tsquery := postgresTSQuery(q)
+		// normalization 1 favours shorter books, as bm25 does
+		query = "SELECT " + getBookColumnsString() + ", ts_rank(" + postgresSearchVector + ", to_tsquery('simple', ?), 1) AS score" +
+			" FROM books WHERE " + liveCondition + " AND " + postgresSearchVector + " @@ to_tsquery('simple', ?)" +
+			" ORDER BY score DESC, id ASC LIMIT ? OFFSET ?"
+		args = []interface{}{tsquery, tsquery, limit, offset}
+	case SQLite:
+		// bm25 is lower for better matches
+		query = "SELECT " + getQualifiedBookColumnsString("b") + ", -bm25(books_fts) AS score" +
+			" FROM books_fts JOIN books b ON b.id = books_fts.id WHERE b." + liveCondition + " AND books_fts MATCH ?" +
+			" ORDER BY score DESC, b.id ASC LIMIT ? OFFSET ?"
+		args = []interface{}{sqliteMatchQuery(q), limit, offset}
+	default:
+		boolean := mysqlBooleanQuery(q)
+		query = "SELECT " + getBookColumnsString() + ", MATCH(title, author, genre) AGAINST (? IN BOOLEAN MODE) AS score" +
+			" FROM books WHERE " + liveCondition + " AND MATCH(title, author, genre) AGAINST (? IN BOOLEAN MODE)" +
+			" ORDER BY score DESC, id ASC LIMIT ? OFFSET ?"
+		args = []interface{}{boolean, boolean, limit, offset}
+	}
+
+	results := []models.SearchResult{}
+	rows, err := d.Conn.QueryContext(ctx, d.dialect().rebind(query), args...)
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var score float64
+		book, err := scanBook(rows, &score)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, models.SearchResult{Book: book, Score: score})
+	}
+	if err := rows.Err(); err != nil {
+		return results, err
+	}
+	return results, nil
+}
+
+// mysqlMinTokenSize is the default innodb_ft_min_token_size, shorter words
+// aren't indexed
+const mysqlMinTokenSize = 3
+
+// mysqlStopwords is the default InnoDB stopword list, words it doesn't index
+var mysqlStopwords = map[string]bool{
+	"a": true, "about": true, "an": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"com": true, "de": true, "en": true, "for": true, "from": true, "how": true, "i": true, "in": true,
+	"is": true, "it": true, "la": true, "of": true, "on": true, "or": true, "that": true, "the": true,
+	"this": true, "to": true, "was": true, "what": true, "when": true, "where": true, "who": true,
+	"will": true, "with": true, "und": true, "www": true,
+}
+
+// mysqlIndexed reports whether InnoDB indexes word with its default settings
+func mysqlIndexed(word string) bool {
+	return utf8.RuneCountInString(word) >= mysqlMinTokenSize && !mysqlStopwords[word]
+}
+
+// mysqlBooleanQuery renders q in MySQL's boolean full-text syntax, where every
+// term is required: +word +prefix* +"a phrase". A word that isn't indexed, or
+// a phrase of such words, can never be found, so it's left optional rather
+// than making the whole search come back empty. Prefixes are kept whatever
+// their length, MySQL doesn't drop them.
+func mysqlBooleanQuery(q search.Query) string {
+	parts := make([]string, len(q.Terms))
+	for i, term := range q.Terms {
+		required := "+"
+		if !term.Prefix && !slices.ContainsFunc(term.Words, mysqlIndexed) {
+			required = ""
+		}
+		switch {
+		case term.Phrase():
+			parts[i] = required + `"` + strings.Join(term.Words, " ") + `"`
+		case term.Prefix:
+			parts[i] = required + term.Words[0] + "*"
+		default:
+			parts[i] = required + term.Words[0]
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// postgresTSQuery renders q as a tsquery: word & prefix:* & (phrase <-> words)
+func postgresTSQuery(q search.Query) string {
+	parts := make([]string, len(q.Terms))
+	for i, term := range q.Terms {
+		words := make([]string, len(term.Words))
+		for j, word := range term.Words {
+			words[j] = "'" + word + "'"
+		}
+		if term.Prefix {
+			words[len(words)-1] += ":*"
+		}
+		if term.Phrase() {
+			parts[i] = "(" + strings.Join(words, " <-> ") + ")"
+		} else {
+			parts[i] = words[0]
+		}
+	}
+	return strings.Join(parts, " & ")
+}
+
+// sqliteMatchQuery renders q as an FTS5 query: "word" AND "prefix"* AND "a phrase"
+func sqliteMatchQuery(q search.Query) string {
+	parts := make([]string, len(q.Terms))
+	for i, term := range q.Terms {
+		parts[i] = `"` + strings.Join(term.Words, " ") + `"`
+		if term.Prefix {
+			parts[i] += "*"
+		}
+	}
+	return strings.Join(parts, " AND ")
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/search"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSearchQueryRendering(t *testing.T) {
+	q, err := search.Parse(`dune "frank herbert" mess*`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got, want := mysqlBooleanQuery(q), `+dune +"frank herbert" +mess*`; got != want {
+		t.Errorf("mysqlBooleanQuery = %q, want %q", got, want)
+	}
+	if got, want := postgresTSQuery(q), `'dune' & ('frank' <-> 'herbert') & 'mess':*`; got != want {
+		t.Errorf("postgresTSQuery = %q, want %q", got, want)
+	}
+	if got, want := sqliteMatchQuery(q), `"dune" AND "frank herbert" AND "mess"*`; got != want {
+		t.Errorf("sqliteMatchQuery = %q, want %q", got, want)
+	}
+}
+
+func TestMySQLBooleanQuery_UnindexedWords(t *testing.T) {
+	for raw, want := range map[string]string{
+		// "the" is a stopword and "x" too short, requiring them would match nothing
+		"the dune x":              `the +dune x`,
+		`"of the" herbert`:        `"of the" +herbert`,
+		`"children of dune"`:      `+"children of dune"`,
+		"it* ok*":                 `+it* +ok*`,
+		"to be":                   `to be`,
+		"Dune Messiah by Herbert": `+dune +messiah by +herbert`,
+	} {
+		q, err := search.Parse(raw)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := mysqlBooleanQuery(q); got != want {
+			t.Errorf("mysqlBooleanQuery(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
+
+func TestSearchBooks_MySQL(t *testing.T) {
+	d, mock := getMockDatabase(t)
+	q, _ := search.Parse("dune")
+	rows := sqlmock.NewRows(append(bookColumns, "score")).
+		AddRow(testBookID, "Dune", "Frank Herbert", 1965, "Sci-Fi", nil, testTime, testTime, 1, nil, 1.5)
+	mock.ExpectQuery("SELECT .*, MATCH\\(title, author, genre\\) AGAINST \\(\\? IN BOOLEAN MODE\\) AS score FROM books "+
+		"WHERE deleted_at IS NULL AND MATCH\\(title, author, genre\\) AGAINST \\(\\? IN BOOLEAN MODE\\) ORDER BY score DESC, id ASC LIMIT \\? OFFSET \\?").
+		WithArgs("+dune", "+dune", 10, 0).
+		WillReturnRows(rows)
+
+	results, err := d.SearchBooks(context.Background(), q, 10, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 1 || results[0].Book.Title != "Dune" || results[0].Score != 1.5 {
+		t.Errorf("Unexpected results %+v", results)
+	}
+}
+
+func TestMemoryStore_SearchBooks(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	store.CreateBook(ctx, models.Book{Title: "Dune", Author: "Frank Herbert", Genre: "Sci-Fi"})
+	store.CreateBook(ctx, models.Book{Title: "Dune Messiah", Author: "Frank Herbert", Genre: "Sci-Fi"})
+	store.CreateBook(ctx, models.Book{Title: "Herbert", Author: "Jane Doe", Genre: "Gardening"})
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"dune", []string{"Dune", "Dune Messiah"}},
+		{`"frank herbert" mess*`, []string{"Dune Messiah"}},
+		{`"herbert frank"`, nil},
+	}
+	for _, tt := range tests {
+		q, _ := search.Parse(tt.query)
+		results, err := store.SearchBooks(ctx, q, 10, 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var titles []string
+		for _, result := range results {
+			titles = append(titles, result.Book.Title)
+		}
+		if len(titles) != len(tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.query, tt.want, titles)
+			continue
+		}
+		for i := range titles {
+			if titles[i] != tt.want[i] {
+				t.Errorf("%s: expected %v, got %v", tt.query, tt.want, titles)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/search"
+)
+
+// ErrVersionMismatch is returned by writes given an expected version when the
+// book has been changed since, so callers don't overwrite someone else's edit
+var ErrVersionMismatch = errors.New("book version does not match")
+
+// ErrDuplicateISBN is returned by writes giving a book the ISBN of another
+// one, including books in the trash
+var ErrDuplicateISBN = errors.New("a book with this ISBN already exists")
+
+// BookStore is the storage contract used by the books handler. Backends report
+// a missing book with sql.ErrNoRows so handlers can map it to a 404 regardless
+// of the implementation behind the interface.
+//
+// Deleting a book moves it to the trash. Books in the trash are invisible to
+// every method but the listing ones given a Deleted filter, BookExists,
+// RestoreBook and PurgeDeletedBooks.
+//
+// Every write increments the book's version. Writes taking a version only
+// apply when the book is still at that version, failing with
+// ErrVersionMismatch otherwise. A version of 0 applies unconditionally.
+//
+// Every write is recorded in the audit log atomically with the change itself,
+// attributed to the actor and request id carried by ctx (see requestctx).
+type BookStore interface {
+	AuditStore
+	GetBooks(ctx context.Context, q models.BookQuery) ([]models.Book, error)
+	// CountBooks returns how many books match filter, ignoring pagination
+	CountBooks(ctx context.Context, filter models.BookFilter) (int, error)
+	// BookStats returns the count, latest update and version sum of the
+	// books matching filter in a single query
+	BookStats(ctx context.Context, filter models.BookFilter) (models.BookStats, error)
+	GetBookByID(ctx context.Context, id string) (models.Book, error)
+	// BookExists reports whether the book is live or in the trash
+	BookExists(ctx context.Context, id string) (bool, error)
+	// GetBookByISBN returns the live book with the given normalized ISBN-13
+	GetBookByISBN(ctx context.Context, isbn string) (models.Book, error)
+	// FindDuplicates returns the live books sharing the ISBN of any of
+	// books, or its title and author ignoring case and surrounding space
+	FindDuplicates(ctx context.Context, books []models.Book) ([]models.Book, error)
+	// CreateBook persists newBook under a freshly generated ID and returns
+	// the stored book
+	CreateBook(ctx context.Context, newBook models.Book) (models.Book, error)
+	// UpdateBook replaces the fields of a book and returns the stored book
+	UpdateBook(ctx context.Context, id string, updatedBook models.Book, version int) (models.Book, error)
+	// PatchBook sets only the given columns (title, author, published_year,
+	// genre, isbn) to their new values and returns the updated book
+	PatchBook(ctx context.Context, id string, fields map[string]interface{}, version int) (models.Book, error)
+	DeleteBook(ctx context.Context, id string, version int) (string, error)
+	// RestoreBook takes a book out of the trash and returns it, failing with
+	// sql.ErrNoRows when it isn't in the trash
+	RestoreBook(ctx context.Context, id string) (models.Book, error)
+	// PurgeDeletedBooks permanently removes the books deleted before the
+	// given time and returns how many there were
+	PurgeDeletedBooks(ctx context.Context, before time.Time) (int64, error)
+	// ApplyBatch performs ops in order within a single transaction and
+	// reports the outcome of each. When atomic, the first failure undoes the
+	// whole batch and every other operation fails with ErrBatchAborted.
+	// Otherwise only the failed operations are undone. The error is only
+	// set when the batch couldn't run at all.
+	ApplyBatch(ctx context.Context, ops []models.BatchOperation, atomic bool) ([]OperationResult, error)
+	// SearchBooks runs a full-text search over title, author and genre and
+	// returns the matches ordered by descending relevance. Highlights are
+	// left to the caller.
+	SearchBooks(ctx context.Context, q search.Query, limit, offset int) ([]models.SearchResult, error)
+}
+
+// AuditStore reads the audit log of book changes
+type AuditStore interface {
+	// GetAuditLog returns the entries matching the query, oldest first.
+	// Entries outlive their book, so the history of a purged book remains.
+	GetAuditLog(ctx context.Context, q models.AuditQuery) ([]models.AuditEntry, error)
+}
+
+// Compile time check that the MySQL backed Database satisfies BookStore
+var _ BookStore = (*Database)(nil)
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"digicert-library-app/internal/models"
+)
+
+// inTx runs fn in a transaction, committing it when fn succeeds
+func (d *Database) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := d.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockBook reads the book matching id and condition (live or in the trash)
+// within tx, locking its row until the transaction ends
+func (d *Database) lockBook(ctx context.Context, tx *sql.Tx, id, condition string) (models.Book, error) {
+	query := "SELECT " + getBookColumnsString() + " FROM books WHERE id = ? AND " + condition + d.dialect().lockClause()
+	return scanBook(tx.QueryRowContext(ctx, d.dialect().rebind(query), id))
+}
+
+// readBook reads the book id, whether live or in the trash, within tx
+func (d *Database) readBook(ctx context.Context, tx *sql.Tx, id string) (models.Book, error) {
+	query := "SELECT " + getBookColumnsString() + " FROM books WHERE id = ?"
+	return scanBook(tx.QueryRowContext(ctx, d.dialect().rebind(query), id))
+}
+
+// inSavepoint runs fn within tx behind a savepoint, undoing only fn's writes
+// when it fails. The transaction stays usable afterwards, which Postgres
+// otherwise refuses after a failed statement.
+func (d *Database) inSavepoint(ctx context.Context, tx *sql.Tx, fn func() error) error {
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT batch_item"); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		if _, rbErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT batch_item"); rbErr != nil {
+			return rbErr
+		}
+		return &savepointError{err}
+	}
+	_, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT batch_item")
+	return err
+}
+
+// savepointError is an error of the work done in a savepoint, which was
+// rolled back without affecting the transaction
+type savepointError struct {
+	err error
+}
+
+func (e *savepointError) Error() string { return e.err.Error() }
+
+func (e *savepointError) Unwrap() error { return e.err }
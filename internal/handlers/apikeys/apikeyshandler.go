@@ -0,0 +1,141 @@
+// Package apikeys serves the admin endpoints managing the API keys of
+// integrations.
+package apikeys
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"digicert-library-app/internal/auth"
+	"digicert-library-app/internal/database"
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/problem"
+	"digicert-library-app/internal/requestctx"
+	"digicert-library-app/internal/validation"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type APIKeysHandler struct {
+	store database.APIKeyStore
+}
+
+func InitAPIKeysHandler(ctx context.Context, store database.APIKeyStore) *APIKeysHandler {
+	return &APIKeysHandler{store: store}
+}
+
+// CreateAPIKey handles POST /admin/api-keys. The response holds the key in
+// plaintext, the only time it's shown.
+func (a *APIKeysHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx := r.Context()
+
+	var req models.APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.InvalidPayload, "Invalid request payload")
+		return
+	}
+	if errs := validation.APIKey(&req); errs != nil {
+		problem.WriteErrors(w, r, problem.ValidationFailed, "Validation failed", errs)
+		return
+	}
+
+	plaintext, creds, err := auth.GenerateAPIKey()
+	if err != nil {
+		problem.Write(w, r, problem.InternalError, "Couldn't generate API key")
+		return
+	}
+	key, err := a.store.CreateAPIKey(ctx, models.APIKey{
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		CreatedBy: requestctx.Actor(ctx),
+		Prefix:    creds.Prefix,
+		Salt:      creds.Salt,
+		Hash:      creds.Hash,
+	})
+	if err != nil {
+		problem.Write(w, r, problem.InternalError, "Couldn't create API key")
+		return
+	}
+	w.Header().Set("Location", "/admin/api-keys/"+key.ID.String())
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.APIKeyResponse{APIKey: key, Key: plaintext})
+}
+
+// ListAPIKeys handles GET /admin/api-keys, listing every key, revoked ones
+// included, without their secrets
+func (a *APIKeysHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	keys, err := a.store.ListAPIKeys(r.Context())
+	if err != nil {
+		problem.Write(w, r, problem.InternalError, "Error in fetching API keys")
+		return
+	}
+	json.NewEncoder(w).Encode(models.APIKeysResponse{Data: keys})
+}
+
+// RotateAPIKey handles POST /admin/api-keys/{id}/rotate, replacing the secret
+// of a key. The previous one stops working at once, the response holds the
+// new key in plaintext.
+func (a *APIKeysHandler) RotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := keyID(w, r)
+	if !ok {
+		return
+	}
+	plaintext, creds, err := auth.GenerateAPIKey()
+	if err != nil {
+		problem.Write(w, r, problem.InternalError, "Couldn't generate API key")
+		return
+	}
+	key, err := a.store.RotateAPIKey(r.Context(), id, creds.Prefix, creds.Salt, creds.Hash)
+	if err != nil {
+		writeStoreError(w, r, err, "Couldn't rotate API key")
+		return
+	}
+	json.NewEncoder(w).Encode(models.APIKeyResponse{APIKey: key, Key: plaintext})
+}
+
+// RevokeAPIKey handles DELETE /admin/api-keys/{id}. Revoked keys stay listed
+// with the time they were revoked.
+func (a *APIKeysHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := keyID(w, r)
+	if !ok {
+		return
+	}
+	key, err := a.store.RevokeAPIKey(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, r, err, "Couldn't revoke API key")
+		return
+	}
+	json.NewEncoder(w).Encode(models.APIKeyResponse{APIKey: key})
+}
+
+// keyID returns the key id of the request path, writing the error response
+// and returning false when it isn't a UUID
+func keyID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := mux.Vars(r)["id"]
+	if _, err := uuid.Parse(id); err != nil {
+		problem.Write(w, r, problem.InvalidID, "Invalid API key ID format")
+		return "", false
+	}
+	return id, true
+}
+
+// writeStoreError answers a failed change of a key, a missing or revoked key
+// being a 404
+func writeStoreError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	if err == sql.ErrNoRows {
+		problem.Write(w, r, problem.APIKeyNotFound, "API key not found or revoked")
+		return
+	}
+	problem.Write(w, r, problem.InternalError, message)
+}
@@ -0,0 +1,123 @@
+package apikeys
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"digicert-library-app/internal/auth"
+	"digicert-library-app/internal/database"
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/requestctx"
+
+	"github.com/gorilla/mux"
+)
+
+func newRouter(store database.APIKeyStore) *mux.Router {
+	handler := InitAPIKeysHandler(context.Background(), store)
+	r := mux.NewRouter()
+	r.HandleFunc("/admin/api-keys", handler.ListAPIKeys).Methods("GET")
+	r.HandleFunc("/admin/api-keys", handler.CreateAPIKey).Methods("POST")
+	r.HandleFunc("/admin/api-keys/{id}/rotate", handler.RotateAPIKey).Methods("POST")
+	r.HandleFunc("/admin/api-keys/{id}", handler.RevokeAPIKey).Methods("DELETE")
+	return r
+}
+
+func serve(r http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req = req.WithContext(requestctx.WithActor(req.Context(), "admin"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// checkKey reports whether plaintext is the current secret of the stored key
+func checkKey(t *testing.T, store database.APIKeyStore, plaintext string) bool {
+	t.Helper()
+	prefix, secret, ok := auth.ParseAPIKey(plaintext)
+	if !ok {
+		return false
+	}
+	key, err := store.GetAPIKeyByPrefix(context.Background(), prefix)
+	return err == nil && auth.CheckAPIKeySecret(key.Salt, key.Hash, secret)
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	store := database.NewMemoryStore()
+	r := newRouter(store)
+
+	w := serve(r, "POST", "/admin/api-keys", `{"name":" Kiosk ","scopes":["books:read","books:read"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body)
+	}
+	var created models.APIKeyResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if created.APIKey.Name != "Kiosk" || len(created.APIKey.Scopes) != 1 || created.APIKey.CreatedBy != "admin" {
+		t.Errorf("Unexpected key %+v", created.APIKey)
+	}
+	if w.Header().Get("Location") != "/admin/api-keys/"+created.APIKey.ID.String() {
+		t.Errorf("Unexpected Location %q", w.Header().Get("Location"))
+	}
+	if !checkKey(t, store, created.Key) {
+		t.Errorf("Expected the returned key %q to authenticate", created.Key)
+	}
+
+	w = serve(r, "GET", "/admin/api-keys", "")
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "hash") || strings.Contains(w.Body.String(), created.Key) {
+		t.Errorf("Expected the list without secrets, got %d: %s", w.Code, w.Body)
+	}
+
+	w = serve(r, "POST", "/admin/api-keys/"+created.APIKey.ID.String()+"/rotate", "")
+	var rotated models.APIKeyResponse
+	json.Unmarshal(w.Body.Bytes(), &rotated)
+	if w.Code != http.StatusOK || rotated.Key == "" || rotated.APIKey.Prefix == created.APIKey.Prefix || rotated.APIKey.RotatedAt == nil {
+		t.Fatalf("Expected the key to be rotated, got %d: %s", w.Code, w.Body)
+	}
+	if checkKey(t, store, created.Key) || !checkKey(t, store, rotated.Key) {
+		t.Error("Expected only the rotated key to authenticate")
+	}
+
+	w = serve(r, "DELETE", "/admin/api-keys/"+created.APIKey.ID.String(), "")
+	var revoked models.APIKeyResponse
+	json.Unmarshal(w.Body.Bytes(), &revoked)
+	if w.Code != http.StatusOK || revoked.APIKey.RevokedAt == nil || revoked.Key != "" {
+		t.Errorf("Expected the key to be revoked, got %d: %s", w.Code, w.Body)
+	}
+
+	for _, path := range []string{"/admin/api-keys/" + created.APIKey.ID.String(), "/admin/api-keys/" + created.APIKey.ID.String() + "/rotate"} {
+		method := "DELETE"
+		if strings.HasSuffix(path, "/rotate") {
+			method = "POST"
+		}
+		if w := serve(r, method, path, ""); w.Code != http.StatusNotFound {
+			t.Errorf("%s %s: expected status 404 for a revoked key, got %d", method, path, w.Code)
+		}
+	}
+}
+
+func TestAPIKeyErrors(t *testing.T) {
+	r := newRouter(database.NewMemoryStore())
+
+	tests := []struct {
+		name, method, path, body string
+		code                     int
+	}{
+		{"invalid payload", "POST", "/admin/api-keys", `{`, http.StatusBadRequest},
+		{"no name", "POST", "/admin/api-keys", `{"scopes":["books:read"]}`, http.StatusUnprocessableEntity},
+		{"no scopes", "POST", "/admin/api-keys", `{"name":"Kiosk","scopes":[]}`, http.StatusUnprocessableEntity},
+		{"unknown scope", "POST", "/admin/api-keys", `{"name":"Kiosk","scopes":["api_keys:manage"]}`, http.StatusUnprocessableEntity},
+		{"invalid id", "DELETE", "/admin/api-keys/not-a-uuid", "", http.StatusBadRequest},
+		{"unknown id", "POST", "/admin/api-keys/123e4567-e89b-12d3-a456-426614174000/rotate", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(r, tt.method, tt.path, tt.body); w.Code != tt.code {
+				t.Errorf("Expected status %d, got %d: %s", tt.code, w.Code, w.Body)
+			}
+		})
+	}
+}
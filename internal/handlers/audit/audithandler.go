@@ -0,0 +1,71 @@
+// Package audit serves the audit log of changes made to the catalog.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"digicert-library-app/internal/database"
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/problem"
+)
+
+// maxPageLimit caps the page size a client can request
+const maxPageLimit = 100
+
+type AuditHandler struct {
+	store database.AuditStore
+}
+
+func InitAuditHandler(ctx context.Context, store database.AuditStore) *AuditHandler {
+	return &AuditHandler{store: store}
+}
+
+// GetAuditLog handles GET /audit, listing the changes made to any book
+// oldest first. actor keeps the changes of one actor and since, an RFC 3339
+// timestamp, the changes made from then on.
+func (a *AuditHandler) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx := r.Context()
+	values := r.URL.Query()
+
+	filter := models.AuditFilter{Actor: strings.TrimSpace(values.Get("actor"))}
+	if since := values.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			problem.Write(w, r, problem.BadRequest, "since must be an RFC 3339 timestamp")
+			return
+		}
+		filter.Since = t
+	}
+
+	page := 1
+	limit := 10
+	if p, err := strconv.Atoi(values.Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(values.Get("limit")); err == nil && l > 0 {
+		limit = min(l, maxPageLimit)
+	}
+
+	entries, err := a.store.GetAuditLog(ctx, models.AuditQuery{
+		Filter: filter,
+		Limit:  limit,
+		Offset: (page - 1) * limit,
+	})
+	if err != nil {
+		problem.Write(w, r, problem.InternalError, "Error in fetching the audit log")
+		return
+	}
+
+	json.NewEncoder(w).Encode(models.AuditResponse{
+		Data:  entries,
+		Page:  page,
+		Limit: limit,
+	})
+}
@@ -0,0 +1,55 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"digicert-library-app/internal/database"
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/requestctx"
+)
+
+func TestGetAuditLog(t *testing.T) {
+	store := database.NewMemoryStore()
+	librarian := requestctx.WithActor(context.Background(), "librarian")
+	book, _ := store.CreateBook(librarian, models.Book{Title: "Dune", Author: "Frank Herbert"})
+	store.CreateBook(requestctx.WithActor(context.Background(), "admin"), models.Book{Title: "Emma", Author: "Jane Austen"})
+	store.DeleteBook(librarian, book.ID.String(), 0)
+	handler := InitAuditHandler(context.Background(), store)
+
+	tests := []struct {
+		name    string
+		query   string
+		code    int
+		actions []string
+	}{
+		{"everything", "", http.StatusOK, []string{"create", "create", "delete"}},
+		{"by actor", "?actor=librarian", http.StatusOK, []string{"create", "delete"}},
+		{"since", "?since=2999-01-01T00:00:00Z", http.StatusOK, nil},
+		{"paginated", "?actor=librarian&page=2&limit=1", http.StatusOK, []string{"delete"}},
+		{"invalid since", "?since=yesterday", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.GetAuditLog(w, httptest.NewRequest("GET", "/audit"+tt.query, nil))
+
+			if w.Code != tt.code {
+				t.Fatalf("Expected status %d, got %d", tt.code, w.Code)
+			}
+			var resp models.AuditResponse
+			_ = json.Unmarshal(w.Body.Bytes(), &resp)
+			if len(resp.Data) != len(tt.actions) {
+				t.Fatalf("Expected actions %v, got %+v", tt.actions, resp.Data)
+			}
+			for i, entry := range resp.Data {
+				if entry.Action != tt.actions[i] {
+					t.Errorf("Expected actions %v, got %+v", tt.actions, resp.Data)
+				}
+			}
+		})
+	}
+}
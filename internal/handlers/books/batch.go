@@ -0,0 +1,173 @@
+package books
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"digicert-library-app/internal/database"
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/problem"
+	"digicert-library-app/internal/validation"
+
+	"github.com/google/uuid"
+)
+
+// maxBatchSize caps the number of operations of a single batch
+const maxBatchSize = 1000
+
+// BatchBooks handles POST /books:batch, applying a list of create, update and
+// delete operations in one transaction. In atomic mode (the default) either
+// every operation is stored or none is, and the response takes the status of
+// the operation that failed. In partial mode the failed operations are
+// skipped, and a 207 reports them along with the ones that were stored.
+func (b *BooksHandler) BatchBooks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx := r.Context()
+
+	var req models.BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.InvalidPayload, "Invalid request payload")
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = models.BatchAtomic
+	}
+	if req.Mode != models.BatchAtomic && req.Mode != models.BatchPartial {
+		problem.Write(w, r, problem.BadRequest, "mode must be atomic or partial")
+		return
+	}
+	if len(req.Operations) == 0 || len(req.Operations) > maxBatchSize {
+		problem.Write(w, r, problem.BadRequest, fmt.Sprintf("A batch needs between 1 and %d operations", maxBatchSize))
+		return
+	}
+	atomic := req.Mode == models.BatchAtomic
+
+	// invalid operations never reach the store, the valid ones keep their
+	// index in the request
+	results := make([]models.BatchResult, len(req.Operations))
+	var ops []models.BatchOperation
+	var indexes []int
+	for i, op := range req.Operations {
+		results[i].Index = i
+		if status, msg, fieldErrs := b.validateOperation(ctx, op); status != 0 {
+			results[i].Status, results[i].Error, results[i].Errors = status, msg, fieldErrs
+			continue
+		}
+		ops = append(ops, op)
+		indexes = append(indexes, i)
+	}
+
+	committed := false
+	if atomic && firstFailure(results) >= 0 {
+		abortPending(results)
+	} else if len(ops) > 0 {
+		outcomes, err := b.store.ApplyBatch(ctx, ops, atomic)
+		if err != nil {
+			problem.Write(w, r, problem.InternalError, "Failed to apply batch")
+			return
+		}
+		for j, outcome := range outcomes {
+			result := &results[indexes[j]]
+			if outcome.Err != nil {
+				result.Status, result.Error = batchErrorStatus(outcome.Err)
+				continue
+			}
+			book := outcome.Book
+			result.Book = &book
+			result.Status = http.StatusOK
+			if ops[j].Op == models.BatchCreate {
+				result.Status = http.StatusCreated
+			}
+			committed = true
+		}
+	}
+
+	status := http.StatusOK
+	if failed := firstFailure(results); failed >= 0 {
+		status = http.StatusMultiStatus
+		if atomic {
+			status = results[failed].Status
+		}
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.BatchResponse{
+		Mode:      req.Mode,
+		Committed: committed,
+		Results:   results,
+	})
+}
+
+// validateOperation checks an operation the way the single book endpoints
+// check their request, returning the status and message of the first problem
+// and, for an invalid book, every invalid field
+func (b *BooksHandler) validateOperation(ctx context.Context, op models.BatchOperation) (int, string, validation.Errors) {
+	switch op.Op {
+	case models.BatchCreate, models.BatchUpdate, models.BatchDelete:
+	default:
+		return http.StatusBadRequest, "op must be create, update or delete", nil
+	}
+	if op.Op != models.BatchCreate {
+		if _, err := uuid.Parse(op.ID); err != nil {
+			return http.StatusBadRequest, "Invalid book ID format", nil
+		}
+		if op.Version == 0 && b.requireIfMatch {
+			return http.StatusPreconditionRequired, "version is required, send the version of the book you are changing", nil
+		}
+	}
+	if op.Op != models.BatchDelete {
+		if op.Book == nil {
+			return http.StatusBadRequest, "book is required", nil
+		}
+		errs := validation.Book(op.Book)
+		if errs != nil && op.Op == models.BatchUpdate {
+			// as for PUT, a missing book is left for the store to report
+			if current, err := b.store.GetBookByID(ctx, op.ID); err == nil {
+				errs = changedFieldErrors(errs, current, *op.Book)
+			}
+		}
+		if errs != nil {
+			return http.StatusUnprocessableEntity, validationFailed, errs
+		}
+	}
+	return 0, "", nil
+}
+
+// batchErrorStatus maps a store error of an operation to the status and
+// message the single book endpoints would have answered with
+func batchErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound, "Book not found"
+	case errors.Is(err, database.ErrVersionMismatch):
+		return http.StatusPreconditionFailed, "Book has been modified, fetch it again and retry with its current version"
+	case errors.Is(err, database.ErrDuplicateISBN):
+		return http.StatusConflict, duplicateISBNMessage
+	case errors.Is(err, database.ErrBatchAborted):
+		return http.StatusFailedDependency, "Not applied, another operation of the batch failed"
+	}
+	return http.StatusInternalServerError, "Failed to apply operation"
+}
+
+// firstFailure returns the index of the first failed result, or -1
+func firstFailure(results []models.BatchResult) int {
+	for i, result := range results {
+		if result.Status >= 400 && result.Status != http.StatusFailedDependency {
+			return i
+		}
+	}
+	return -1
+}
+
+// abortPending marks the operations that passed validation as not applied
+func abortPending(results []models.BatchResult) {
+	for i := range results {
+		if results[i].Status == 0 {
+			results[i].Status, results[i].Error = batchErrorStatus(database.ErrBatchAborted)
+		}
+	}
+}
@@ -9,22 +9,41 @@ import (
 
 	"digicert-library-app/internal/database"
 	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/problem"
+	"digicert-library-app/internal/validation"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
 type BooksHandler struct {
-	db *database.Database
+	store          database.BookStore
+	cursorSecret   []byte
+	requireIfMatch bool
+	cacheControl   string
 }
 
-func InitBooksHandler(ctx context.Context, db *database.Database) *BooksHandler {
+func InitBooksHandler(ctx context.Context, store database.BookStore, opts ...Option) *BooksHandler {
 	// Initialize the Book handler
-	return &BooksHandler{
-		db: db,
+	b := &BooksHandler{
+		store:        store,
+		cacheControl: defaultCacheControl,
 	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if len(b.cursorSecret) == 0 {
+		b.cursorSecret = randomSecret()
+	}
+	return b
 }
 func (b *BooksHandler) GetBooks(w http.ResponseWriter, r *http.Request) {
+	b.listBooks(w, r, false)
+}
+
+// listBooks serves a page of the live books, or of the trash when deleted is
+// set, with the same filters, sorting and pagination either way
+func (b *BooksHandler) listBooks(w http.ResponseWriter, r *http.Request, deleted bool) {
 	w.Header().Set("Content-Type", "application/json")
 
 	ctx := r.Context()
@@ -38,21 +57,89 @@ func (b *BooksHandler) GetBooks(w http.ResponseWriter, r *http.Request) {
 		page = p
 	}
 	if l, err := strconv.Atoi(limitParam); err == nil && l > 0 {
-		limit = l
+		limit = min(l, maxPageLimit)
 	}
 	offset := (page - 1) * limit
 
-	books, err := b.db.GetBooks(ctx, limit, offset)
+	filter, err := parseBookFilter(r.URL.Query())
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest, err.Error())
+		return
+	}
+	filter.Deleted = deleted
+	sortFields, err := parseSort(r.URL.Query().Get("sort"))
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(models.ErrorResponse{Error: "Failed to fetch books"})
+		problem.Write(w, r, problem.BadRequest, err.Error())
 		return
 	}
 
+	// cursor based (keyset) pagination replaces page when a cursor is given
+	var after *models.Cursor
+	if cursorParam := r.URL.Query().Get("cursor"); cursorParam != "" {
+		if pageParam != "" {
+			problem.Write(w, r, problem.BadRequest, "Use either page or cursor, not both")
+			return
+		}
+		cursor, err := b.decodeCursor(cursorParam, sortFields)
+		if err != nil {
+			problem.Write(w, r, problem.BadRequest, err.Error())
+			return
+		}
+		after = &cursor
+		page, offset = 0, 0
+	}
+
+	// the stats validate the page without loading it, kiosks polling an
+	// unchanged catalog get a 304 for a single aggregate query
+	stats, err := b.store.BookStats(ctx, filter)
+	if err != nil {
+		problem.Write(w, r, problem.InternalError, "Failed to count books")
+		return
+	}
+	etag := b.listETag(r, stats)
+	if notModified(r, etag, stats.LastModified) {
+		b.setCacheHeaders(w, etag, stats.LastModified)
+		writeNotModified(w)
+		return
+	}
+
+	// one extra row tells whether there is a next page to point a cursor at
+	books, err := b.store.GetBooks(ctx, models.BookQuery{
+		Filter: filter,
+		Sort:   sortFields,
+		Limit:  limit + 1,
+		Offset: offset,
+		After:  after,
+	})
+	if err != nil {
+		problem.Write(w, r, problem.InternalError, "Failed to fetch books")
+		return
+	}
+	var nextCursor string
+	if len(books) > limit {
+		books = books[:limit]
+		nextCursor = b.encodeCursor(database.CursorFor(books[len(books)-1], sortFields), sortFields)
+	}
+
+	total := stats.Count
+	totalPages := (total + limit - 1) / limit
+	var links *models.PageLinks
+	if after != nil {
+		links = buildCursorLinks(r.URL, limit, nextCursor)
+	} else {
+		links = buildPageLinks(r.URL, page, limit, totalPages)
+	}
+	w.Header().Set("Link", links.Header())
+	b.setCacheHeaders(w, etag, stats.LastModified)
+
 	json.NewEncoder(w).Encode(models.BooksResponse{
-		Data:  books,
-		Page:  page,
-		Limit: limit,
+		Data:       books,
+		Page:       page,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: totalPages,
+		NextCursor: nextCursor,
+		Links:      links,
 	})
 }
 
@@ -64,20 +151,23 @@ func (b *BooksHandler) GetBookByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 	if _, err := uuid.Parse(id); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(models.ErrorResponse{Error: "Invalid book ID format"})
+		problem.Write(w, r, problem.InvalidID, "Invalid book ID format")
 		return
 	}
 
-	book, err := b.db.GetBookByID(ctx, id)
+	book, err := b.store.GetBookByID(ctx, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			w.WriteHeader(http.StatusNotFound)
-			json.NewEncoder(w).Encode(models.ErrorResponse{Error: "Book not found"})
+			problem.Write(w, r, problem.BookNotFound, "Book not found")
 			return
 		}
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(models.ErrorResponse{Error: "Error in fetching books from library"})
+		problem.Write(w, r, problem.InternalError, "Error in fetching books from library")
+		return
+	}
+	etag := bookETag(book)
+	b.setCacheHeaders(w, etag, book.UpdatedAt)
+	if notModified(r, etag, book.UpdatedAt) {
+		writeNotModified(w)
 		return
 	}
 	json.NewEncoder(w).Encode(models.BookResponse{Book: book})
@@ -90,30 +180,28 @@ func (b *BooksHandler) CreateBook(w http.ResponseWriter, r *http.Request) {
 
 	var newBook models.Book
 	if err := json.NewDecoder(r.Body).Decode(&newBook); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(models.ErrorResponse{Error: "Invalid request payload"})
+		problem.Write(w, r, problem.InvalidPayload, "Invalid request payload")
 		return
 	}
 
-	// Validate required fields
-	if newBook.Title == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(models.ErrorResponse{Error: "Title is required"})
-		return
-	}
-	if newBook.Author == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(models.ErrorResponse{Error: "Author is required"})
+	if errs := validation.Book(&newBook); errs != nil {
+		writeValidationErrors(w, r, errs)
 		return
 	}
 
-	_, err := b.db.CreateBook(ctx, newBook)
+	book, err := b.store.CreateBook(ctx, newBook)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(models.ErrorResponse{Error: "Couldn't create book"})
+		if err == database.ErrDuplicateISBN {
+			writeDuplicateISBN(w, r)
+			return
+		}
+		problem.Write(w, r, problem.InternalError, "Couldn't create book")
 		return
 	}
-	json.NewEncoder(w).Encode(models.MessageResponse{Message: "Book created"})
+	w.Header().Set("Location", "/books/"+book.ID.String())
+	w.Header().Set("ETag", bookETag(book))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.BookResponse{Book: book})
 }
 
 func (b *BooksHandler) UpdateBook(w http.ResponseWriter, r *http.Request) {
@@ -123,43 +211,58 @@ func (b *BooksHandler) UpdateBook(w http.ResponseWriter, r *http.Request) {
 
 	var updateBook models.Book
 	if err := json.NewDecoder(r.Body).Decode(&updateBook); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(models.ErrorResponse{Error: "Invalid request payload"})
+		problem.Write(w, r, problem.InvalidPayload, "Invalid request payload")
 		return
 	}
 	vars := mux.Vars(r)
 	id := vars["id"]
 
 	if _, err := uuid.Parse(id); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(models.ErrorResponse{Error: "Invalid book ID format"})
+		problem.Write(w, r, problem.InvalidID, "Invalid book ID format")
 		return
 	}
 
-	// Validate required fields for update
-	if updateBook.Title == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(models.ErrorResponse{Error: "Title is required"})
-		return
+	if errs := validation.Book(&updateBook); errs != nil {
+		// fields kept as they are stored aren't held to newer rules
+		current, err := b.store.GetBookByID(ctx, id)
+		if err == sql.ErrNoRows {
+			problem.Write(w, r, problem.BookNotFound, "Book not found")
+			return
+		}
+		if err != nil {
+			problem.Write(w, r, problem.InternalError, "Error in fetching books from library")
+			return
+		}
+		if errs = changedFieldErrors(errs, current, updateBook); errs != nil {
+			writeValidationErrors(w, r, errs)
+			return
+		}
 	}
-	if updateBook.Author == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(models.ErrorResponse{Error: "Author is required"})
+
+	version, ok := b.expectedVersion(ctx, w, r, id)
+	if !ok {
 		return
 	}
 
-	resultMsg, err := b.db.UpdateBook(ctx, id, updateBook)
+	book, err := b.store.UpdateBook(ctx, id, updateBook, version)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			w.WriteHeader(http.StatusNotFound)
-			json.NewEncoder(w).Encode(models.ErrorResponse{Error: "Book not found"})
+			problem.Write(w, r, problem.BookNotFound, "Book not found")
+			return
+		}
+		if err == database.ErrVersionMismatch {
+			writePreconditionFailed(w, r)
 			return
 		}
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(models.ErrorResponse{Error: "Failed to update book"})
+		if err == database.ErrDuplicateISBN {
+			writeDuplicateISBN(w, r)
+			return
+		}
+		problem.Write(w, r, problem.InternalError, "Failed to update book")
 		return
 	}
-	json.NewEncoder(w).Encode(models.MessageResponse{Message: resultMsg})
+	w.Header().Set("ETag", bookETag(book))
+	json.NewEncoder(w).Encode(models.BookResponse{Book: book})
 }
 
 func (b *BooksHandler) DeleteBook(w http.ResponseWriter, r *http.Request) {
@@ -171,20 +274,26 @@ func (b *BooksHandler) DeleteBook(w http.ResponseWriter, r *http.Request) {
 	id := vars["id"]
 
 	if _, err := uuid.Parse(id); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(models.ErrorResponse{Error: "Invalid book ID format"})
+		problem.Write(w, r, problem.InvalidID, "Invalid book ID format")
+		return
+	}
+
+	version, ok := b.expectedVersion(ctx, w, r, id)
+	if !ok {
 		return
 	}
 
-	resultMsg, err := b.db.DeleteBook(ctx, id)
+	resultMsg, err := b.store.DeleteBook(ctx, id, version)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			w.WriteHeader(http.StatusNotFound)
-			json.NewEncoder(w).Encode(models.ErrorResponse{Error: "Book not found"})
+			problem.Write(w, r, problem.BookNotFound, "Book not found")
+			return
+		}
+		if err == database.ErrVersionMismatch {
+			writePreconditionFailed(w, r)
 			return
 		}
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(models.ErrorResponse{Error: "Failed to delete book"})
+		problem.Write(w, r, problem.InternalError, "Failed to delete book")
 		return
 	}
 	json.NewEncoder(w).Encode(models.MessageResponse{Message: resultMsg})
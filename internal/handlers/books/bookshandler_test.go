@@ -3,33 +3,163 @@ package books
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	"digicert-library-app/internal/database"
 	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/problem"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
-	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
-func getMockHandler(t *testing.T) (*BooksHandler, sqlmock.Sqlmock) {
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("failed to open sqlmock database: %v", err)
+const testBookID = "123e4567-e89b-12d3-a456-426614174000"
+
+// fakeStore is an in-memory BookStore used to exercise the handlers without
+// scripting SQL. When err is set every call fails with it. Methods it doesn't
+// implement fall through to the embedded (nil) BookStore and panic, tests of
+// those features use database.MemoryStore instead.
+type fakeStore struct {
+	database.BookStore
+	books map[string]models.Book
+	err   error
+	// lastQuery records the query passed to GetBooks
+	lastQuery models.BookQuery
+}
+
+func newFakeStore(books ...models.Book) *fakeStore {
+	f := &fakeStore{books: map[string]models.Book{}}
+	for _, book := range books {
+		f.books[book.ID.String()] = book
+	}
+	return f
+}
+
+func (f *fakeStore) GetBooks(ctx context.Context, q models.BookQuery) ([]models.Book, error) {
+	f.lastQuery = q
+	if f.err != nil {
+		return nil, f.err
+	}
+	limit, offset := q.Limit, q.Offset
+	books := []models.Book{}
+	for _, book := range f.books {
+		books = append(books, book)
 	}
-	handler := InitBooksHandler(context.Background(), &database.Database{Conn: db})
-	return handler, mock
+	if offset >= len(books) {
+		return []models.Book{}, nil
+	}
+	books = books[offset:]
+	if limit < len(books) {
+		books = books[:limit]
+	}
+	return books, nil
+}
+
+func (f *fakeStore) BookStats(ctx context.Context, filter models.BookFilter) (models.BookStats, error) {
+	if f.err != nil {
+		return models.BookStats{}, f.err
+	}
+	stats := models.BookStats{Count: len(f.books)}
+	for _, book := range f.books {
+		stats.VersionSum += int64(book.Version)
+		if book.UpdatedAt.After(stats.LastModified) {
+			stats.LastModified = book.UpdatedAt
+		}
+	}
+	return stats, nil
+}
+
+func (f *fakeStore) GetBookByID(ctx context.Context, id string) (models.Book, error) {
+	if f.err != nil {
+		return models.Book{}, f.err
+	}
+	book, ok := f.books[id]
+	if !ok {
+		return models.Book{}, sql.ErrNoRows
+	}
+	return book, nil
+}
+
+func (f *fakeStore) CreateBook(ctx context.Context, newBook models.Book) (models.Book, error) {
+	if f.err != nil {
+		return models.Book{}, f.err
+	}
+	newBook.ID = uuid.New()
+	f.books[newBook.ID.String()] = newBook
+	return newBook, nil
+}
+
+func (f *fakeStore) UpdateBook(ctx context.Context, id string, updatedBook models.Book, version int) (models.Book, error) {
+	if f.err != nil {
+		return models.Book{}, f.err
+	}
+	book, ok := f.books[id]
+	if !ok {
+		return models.Book{}, sql.ErrNoRows
+	}
+	if version != 0 && book.Version != version {
+		return models.Book{}, database.ErrVersionMismatch
+	}
+	updatedBook.ID = book.ID
+	updatedBook.Version = book.Version + 1
+	f.books[id] = updatedBook
+	return updatedBook, nil
+}
+
+func (f *fakeStore) DeleteBook(ctx context.Context, id string, version int) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	book, ok := f.books[id]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	if version != 0 && book.Version != version {
+		return "", database.ErrVersionMismatch
+	}
+	delete(f.books, id)
+	return "Book Deleted", nil
+}
+
+func (f *fakeStore) BookExists(ctx context.Context, id string) (bool, error) {
+	if f.err != nil {
+		return false, f.err
+	}
+	_, ok := f.books[id]
+	return ok, nil
+}
+
+// GetAuditLog returns no entries, the fake keeps no history
+func (f *fakeStore) GetAuditLog(ctx context.Context, q models.AuditQuery) ([]models.AuditEntry, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []models.AuditEntry{}, nil
+}
+
+func getMockHandler(t *testing.T, books ...models.Book) (*BooksHandler, *fakeStore) {
+	store := newFakeStore(books...)
+	handler := InitBooksHandler(context.Background(), store, WithCursorSecret([]byte("test-secret")))
+	return handler, store
+}
+
+func testBook() models.Book {
+	return models.Book{ID: uuid.MustParse(testBookID), Title: "Test Book", Author: "Test Author", PublishedYear: 2023, Genre: "Fiction"}
 }
 
 func TestGetBooks_WithData(t *testing.T) {
-	handler, mock := getMockHandler(t)
-	rows := sqlmock.NewRows([]string{"id", "title", "author", "published_year", "genre"}).
-		AddRow("123e4567-e89b-12d3-a456-426614174000", "Book One", "Author One", 2020, "Fiction").
-		AddRow("123e4567-e89b-12d3-a456-426614174001", "Book Two", "Author Two", 2021, "Non-Fiction")
-	mock.ExpectQuery("SELECT id, title, author, published_year, genre FROM books").WillReturnRows(rows)
+	handler, _ := getMockHandler(t,
+		models.Book{ID: uuid.MustParse("123e4567-e89b-12d3-a456-426614174000"), Title: "Book One", Author: "Author One", PublishedYear: 2020, Genre: "Fiction"},
+		models.Book{ID: uuid.MustParse("123e4567-e89b-12d3-a456-426614174001"), Title: "Book Two", Author: "Author Two", PublishedYear: 2021, Genre: "Non-Fiction"},
+	)
 
 	req := httptest.NewRequest("GET", "/books", nil)
 	w := httptest.NewRecorder()
@@ -48,9 +178,7 @@ func TestGetBooks_WithData(t *testing.T) {
 }
 
 func TestGetBooks_Empty(t *testing.T) {
-	handler, mock := getMockHandler(t)
-	rows := sqlmock.NewRows([]string{"id", "title", "author", "published_year", "genre"})
-	mock.ExpectQuery("SELECT id, title, author, published_year, genre FROM books").WillReturnRows(rows)
+	handler, _ := getMockHandler(t)
 
 	req := httptest.NewRequest("GET", "/books", nil)
 	w := httptest.NewRecorder()
@@ -59,11 +187,15 @@ func TestGetBooks_Empty(t *testing.T) {
 	if w.Code != http.StatusNoContent && w.Code != http.StatusOK {
 		t.Errorf("Expected status 204 or 200, got %d", w.Code)
 	}
+	// zero matches is still a total, not a missing one
+	if !strings.Contains(w.Body.String(), `"total":0`) {
+		t.Errorf("Expected a total of 0, got %s", w.Body.String())
+	}
 }
 
 func TestGetBooks_DBError(t *testing.T) {
-	handler, mock := getMockHandler(t)
-	mock.ExpectQuery("SELECT id, title, author, published_year, genre FROM books").WillReturnError(errors.New("db error"))
+	handler, store := getMockHandler(t)
+	store.err = errors.New("db error")
 
 	req := httptest.NewRequest("GET", "/books", nil)
 	w := httptest.NewRecorder()
@@ -72,24 +204,308 @@ func TestGetBooks_DBError(t *testing.T) {
 	if w.Code != http.StatusInternalServerError {
 		t.Errorf("Expected status 500, got %d", w.Code)
 	}
-	var resp models.ErrorResponse
+	var resp models.Problem
 	_ = json.Unmarshal(w.Body.Bytes(), &resp)
-	if resp.Error == "" {
-		t.Errorf("Expected error message, got empty string")
+	if resp.Detail == "" {
+		t.Errorf("Expected problem detail, got empty string")
+	}
+}
+
+func TestGetBooks_TotalsAndLinks(t *testing.T) {
+	var books []models.Book
+	for i := 0; i < 25; i++ {
+		books = append(books, models.Book{ID: uuid.New(), Title: "Book", Author: "Author"})
+	}
+	handler, _ := getMockHandler(t, books...)
+
+	req := httptest.NewRequest("GET", "/books?page=2&limit=10&genre=Fiction", nil)
+	w := httptest.NewRecorder()
+	handler.GetBooks(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var resp models.BooksResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if resp.Total != 25 || resp.TotalPages != 3 || len(resp.Data) != 10 {
+		t.Errorf("Expected total 25 over 3 pages with 10 items, got %d over %d with %d", resp.Total, resp.TotalPages, len(resp.Data))
+	}
+	want := models.PageLinks{
+		First: "/books?genre=Fiction&limit=10&page=1",
+		Prev:  "/books?genre=Fiction&limit=10&page=1",
+		Next:  "/books?genre=Fiction&limit=10&page=3",
+		Last:  "/books?genre=Fiction&limit=10&page=3",
+	}
+	if resp.Links == nil || *resp.Links != want {
+		t.Errorf("Expected links %+v, got %+v", want, resp.Links)
+	}
+	wantHeader := `</books?genre=Fiction&limit=10&page=1>; rel="first", </books?genre=Fiction&limit=10&page=1>; rel="prev", ` +
+		`</books?genre=Fiction&limit=10&page=3>; rel="next", </books?genre=Fiction&limit=10&page=3>; rel="last"`
+	if got := w.Header().Get("Link"); got != wantHeader {
+		t.Errorf("Unexpected Link header %q", got)
+	}
+}
+
+func TestGetBooks_LastPageHasNoNext(t *testing.T) {
+	handler, _ := getMockHandler(t, testBook())
+
+	req := httptest.NewRequest("GET", "/books", nil)
+	w := httptest.NewRecorder()
+	handler.GetBooks(w, req)
+
+	var resp models.BooksResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Links == nil || resp.Links.Next != "" || resp.Links.Prev != "" {
+		t.Errorf("Expected only first/last links on a single page, got %+v", resp.Links)
+	}
+}
+
+func TestGetBooks_LimitIsCapped(t *testing.T) {
+	handler, store := getMockHandler(t)
+
+	req := httptest.NewRequest("GET", "/books?limit=100000000", nil)
+	w := httptest.NewRecorder()
+	handler.GetBooks(w, req)
+
+	// the handler asks for one extra row to detect a next page
+	if store.lastQuery.Limit != maxPageLimit+1 {
+		t.Errorf("Expected limit to be capped at %d, got %d", maxPageLimit, store.lastQuery.Limit-1)
+	}
+	var resp models.BooksResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Limit != maxPageLimit {
+		t.Errorf("Expected response limit %d, got %d", maxPageLimit, resp.Limit)
+	}
+}
+
+func TestGetBooks_CursorWalk(t *testing.T) {
+	ctx := context.Background()
+	store := database.NewMemoryStore()
+	for i := 0; i < 25; i++ {
+		// repeated years make the id tiebreaker matter
+		store.CreateBook(ctx, models.Book{Title: fmt.Sprintf("Book %02d", i), Author: "Author", PublishedYear: 2000 + i%4})
+	}
+	handler := InitBooksHandler(ctx, store, WithCursorSecret([]byte("test-secret")))
+
+	seen := map[uuid.UUID]bool{}
+	var previous *models.Book
+	target := "/books?limit=10&sort=-published_year"
+	for pages := 0; target != ""; pages++ {
+		if pages > 3 {
+			t.Fatalf("cursor walk did not terminate")
+		}
+		req := httptest.NewRequest("GET", target, nil)
+		w := httptest.NewRecorder()
+		handler.GetBooks(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %s, got %d: %s", target, w.Code, w.Body.String())
+		}
+		var resp models.BooksResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+
+		for i := range resp.Data {
+			book := resp.Data[i]
+			if seen[book.ID] {
+				t.Errorf("Book %s returned twice", book.ID)
+			}
+			seen[book.ID] = true
+			if previous != nil && previous.PublishedYear < book.PublishedYear {
+				t.Errorf("Books out of order: %d before %d", previous.PublishedYear, book.PublishedYear)
+			}
+			previous = &book
+		}
+
+		target = ""
+		if resp.NextCursor != "" {
+			target = "/books?limit=10&sort=-published_year&cursor=" + resp.NextCursor
+			if pages > 0 && (resp.Links == nil || resp.Links.Next != "/books?cursor="+resp.NextCursor+"&limit=10&sort=-published_year") {
+				t.Errorf("Expected the next link to carry next_cursor, got %+v", resp.Links)
+			}
+		}
+		if pages == 0 {
+			// a book inserted mid-scan must not shift the remaining pages
+			store.CreateBook(ctx, models.Book{Title: "Late arrival", Author: "Author", PublishedYear: 2050})
+		}
+	}
+	if len(seen) != 25 {
+		t.Errorf("Expected to walk 25 books, saw %d", len(seen))
+	}
+}
+
+func TestGetBooks_InvalidCursor(t *testing.T) {
+	handler, _ := getMockHandler(t)
+	sorted := []models.SortField{{Field: "title"}}
+	cursor := handler.encodeCursor(models.Cursor{Values: []interface{}{"Dune"}, ID: testBookID}, sorted)
+
+	tests := []string{
+		"cursor=" + cursor + "x",
+		"cursor=not-a-cursor",
+		"cursor=" + cursor,
+		"cursor=" + cursor + "&sort=title&page=2",
+	}
+	for _, query := range tests {
+		req := httptest.NewRequest("GET", "/books?"+query, nil)
+		w := httptest.NewRecorder()
+		handler.GetBooks(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, w.Code)
+		}
+	}
+
+	other := InitBooksHandler(context.Background(), newFakeStore(), WithCursorSecret([]byte("other-secret")))
+	if _, err := other.decodeCursor(cursor, sorted); err == nil {
+		t.Errorf("Expected a cursor signed with another secret to be rejected")
+	}
+	if decoded, err := handler.decodeCursor(cursor, sorted); err != nil || decoded.ID != testBookID || decoded.Values[0] != "Dune" {
+		t.Errorf("Expected cursor to round trip, got %+v (err: %v)", decoded, err)
+	}
+}
+
+func TestGetBooks_SortAndTimestampFilters(t *testing.T) {
+	handler, store := getMockHandler(t)
+
+	req := httptest.NewRequest("GET", "/books?sort=-updated_at,created_at&updated_since=2025-01-02T03:04:05Z&created_before=2025-02-01T00:00:00%2B02:00", nil)
+	w := httptest.NewRecorder()
+	handler.GetBooks(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	q := store.lastQuery
+	wantSort := []models.SortField{{Field: "updated_at", Desc: true}, {Field: "created_at"}}
+	if len(q.Sort) != 2 || q.Sort[0] != wantSort[0] || q.Sort[1] != wantSort[1] {
+		t.Errorf("Expected sort %+v, got %+v", wantSort, q.Sort)
+	}
+	if !q.Filter.UpdatedSince.Equal(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("Unexpected updated_since %v", q.Filter.UpdatedSince)
+	}
+	if !q.Filter.CreatedBefore.Equal(time.Date(2025, 1, 31, 22, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected created_before %v", q.Filter.CreatedBefore)
+	}
+}
+
+func TestGetBooks_FieldFilters(t *testing.T) {
+	handler, store := getMockHandler(t)
+
+	req := httptest.NewRequest("GET", "/books?author=Frank+Herbert&genre=Sci-Fi&title=dune&published_year_min=1960&published_year_max=1970&sort=title,-published_year", nil)
+	w := httptest.NewRecorder()
+	handler.GetBooks(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	want := models.BookFilter{Author: "Frank Herbert", Genre: "Sci-Fi", Title: "dune", YearMin: 1960, YearMax: 1970}
+	if store.lastQuery.Filter != want {
+		t.Errorf("Expected filter %+v, got %+v", want, store.lastQuery.Filter)
+	}
+	wantSort := []models.SortField{{Field: "title"}, {Field: "published_year", Desc: true}}
+	if len(store.lastQuery.Sort) != 2 || store.lastQuery.Sort[0] != wantSort[0] || store.lastQuery.Sort[1] != wantSort[1] {
+		t.Errorf("Expected sort %+v, got %+v", wantSort, store.lastQuery.Sort)
+	}
+}
+
+func TestGetBooks_InvalidListParams(t *testing.T) {
+	invalid := []string{
+		"sort=password",
+		"sort=created_at,-created_at",
+		"updated_since=yesterday",
+		"published_year_min=abc",
+		"published_year_min=2000&published_year_max=1990",
+	}
+	for _, query := range invalid {
+		handler, _ := getMockHandler(t)
+		req := httptest.NewRequest("GET", "/books?"+query, nil)
+		w := httptest.NewRecorder()
+		handler.GetBooks(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, w.Code)
+		}
+		var resp models.Problem
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		if resp.Detail == "" {
+			t.Errorf("%s: expected problem detail, got empty string", query)
+		}
+	}
+}
+
+func getMemoryHandler(t *testing.T, books ...models.Book) (*BooksHandler, *database.MemoryStore) {
+	store := database.NewMemoryStore()
+	for _, book := range books {
+		if _, err := store.CreateBook(context.Background(), book); err != nil {
+			t.Fatalf("failed to seed book: %v", err)
+		}
+	}
+	return InitBooksHandler(context.Background(), store, WithCursorSecret([]byte("test-secret"))), store
+}
+
+func TestSearchBooks(t *testing.T) {
+	handler, _ := getMemoryHandler(t,
+		models.Book{Title: "Dune", Author: "Frank Herbert", Genre: "Sci-Fi"},
+		models.Book{Title: "Children of Dune", Author: "Frank Herbert", Genre: "Sci-Fi"},
+		models.Book{Title: "Emma", Author: "Jane Austen", Genre: "Romance"},
+	)
+
+	req := httptest.NewRequest("GET", "/books/search?q=dune+%22frank+herbert%22", nil)
+	w := httptest.NewRecorder()
+	handler.SearchBooks(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var resp models.SearchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(resp.Data) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(resp.Data))
+	}
+	top := resp.Data[0]
+	if top.Book.Title != "Dune" || top.Score < resp.Data[1].Score {
+		t.Errorf("Expected the shorter exact title to rank first, got %+v", resp.Data)
+	}
+	if top.Highlights["title"] != "<mark>Dune</mark>" || top.Highlights["author"] != "<mark>Frank Herbert</mark>" {
+		t.Errorf("Unexpected highlights %+v", top.Highlights)
+	}
+	if _, ok := top.Highlights["genre"]; ok {
+		t.Errorf("Expected no highlight for an unmatched field")
+	}
+}
+
+func TestSearchBooks_Prefix(t *testing.T) {
+	handler, _ := getMemoryHandler(t, models.Book{Title: "Pride and Prejudice", Author: "Jane Austen", Genre: "Romance"})
+
+	req := httptest.NewRequest("GET", "/books/search?q=prej*", nil)
+	w := httptest.NewRecorder()
+	handler.SearchBooks(w, req)
+
+	var resp models.SearchResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Data) != 1 || resp.Data[0].Highlights["title"] != "Pride and <mark>Prejudice</mark>" {
+		t.Errorf("Expected a prefix match, got %+v", resp.Data)
+	}
+}
+
+func TestSearchBooks_EmptyQuery(t *testing.T) {
+	handler, _ := getMemoryHandler(t)
+	for _, query := range []string{"", "q=", "q=%22%22+*"} {
+		req := httptest.NewRequest("GET", "/books/search?"+query, nil)
+		w := httptest.NewRecorder()
+		handler.SearchBooks(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected status 400, got %d", query, w.Code)
+		}
 	}
 }
 
 func TestGetBookByID_Valid(t *testing.T) {
-	handler, mock := getMockHandler(t)
-	rows := sqlmock.NewRows([]string{"id", "title", "author", "published_year", "genre"}).
-		AddRow("123e4567-e89b-12d3-a456-426614174000", "Test Book", "Test Author", 2023, "Fiction")
-	mock.ExpectQuery("SELECT id, title, author, published_year, genre FROM books WHERE id = \\?").
-		WithArgs("123e4567-e89b-12d3-a456-426614174000").
-		WillReturnRows(rows)
+	handler, _ := getMockHandler(t, testBook())
 
-	req := httptest.NewRequest("GET", "/books/123e4567-e89b-12d3-a456-426614174000", nil)
+	req := httptest.NewRequest("GET", "/books/"+testBookID, nil)
 	w := httptest.NewRecorder()
-	req = muxSetVars(req, map[string]string{"id": "123e4567-e89b-12d3-a456-426614174000"})
+	req = muxSetVars(req, map[string]string{"id": testBookID})
 	handler.GetBookByID(w, req)
 
 	if w.Code != http.StatusOK {
@@ -102,25 +518,62 @@ func TestGetBookByID_Valid(t *testing.T) {
 	}
 }
 
+func TestGetBookByID_NotFound(t *testing.T) {
+	handler, _ := getMockHandler(t)
+
+	req := httptest.NewRequest("GET", "/books/"+testBookID, nil)
+	w := httptest.NewRecorder()
+	req = muxSetVars(req, map[string]string{"id": testBookID})
+	handler.GetBookByID(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != problem.ContentType {
+		t.Errorf("Expected Content-Type %s, got %q", problem.ContentType, ct)
+	}
+	var resp models.Problem
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Code != "book_not_found" || resp.Status != http.StatusNotFound || resp.Instance != "/books/"+testBookID {
+		t.Errorf("Expected a book_not_found problem, got %+v", resp)
+	}
+}
+
+func TestGetBookByID_InvalidID(t *testing.T) {
+	handler, _ := getMockHandler(t)
+
+	req := httptest.NewRequest("GET", "/books/not-a-uuid", nil)
+	w := httptest.NewRecorder()
+	req = muxSetVars(req, map[string]string{"id": "not-a-uuid"})
+	handler.GetBookByID(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
 func TestCreateBook_ValidPayload(t *testing.T) {
-	handler, mock := getMockHandler(t)
+	handler, store := getMockHandler(t)
 	book := models.Book{Title: "Test Book", Author: "Test Author", PublishedYear: 2023, Genre: "Fiction"}
 	body, _ := json.Marshal(book)
-	mock.ExpectExec("INSERT INTO books").
-		WithArgs(sqlmock.AnyArg(), "Test Book", "Test Author", 2023, "Fiction").
-		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	req := httptest.NewRequest("POST", "/books", bytes.NewBuffer(body))
 	w := httptest.NewRecorder()
 	handler.CreateBook(w, req)
 
-	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status 201, got %d", w.Code)
 	}
-	var resp models.MessageResponse
+	var resp models.BookResponse
 	_ = json.Unmarshal(w.Body.Bytes(), &resp)
-	if resp.Message == "" {
-		t.Errorf("Expected message, got empty string")
+	if resp.Book.ID == uuid.Nil || resp.Book.Title != "Test Book" {
+		t.Errorf("Expected created book with an ID, got %+v", resp.Book)
+	}
+	if location := w.Header().Get("Location"); location != "/books/"+resp.Book.ID.String() {
+		t.Errorf("Expected Location header for the new book, got %q", location)
+	}
+	if len(store.books) != 1 {
+		t.Errorf("Expected 1 stored book, got %d", len(store.books))
 	}
 }
 
@@ -132,13 +585,13 @@ func TestCreateBook_MissingTitle(t *testing.T) {
 	w := httptest.NewRecorder()
 	handler.CreateBook(w, req)
 
-	if w.Code != http.StatusBadRequest {
-		t.Errorf("Expected status 400, got %d", w.Code)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", w.Code)
 	}
-	var resp models.ErrorResponse
+	var resp models.Problem
 	_ = json.Unmarshal(w.Body.Bytes(), &resp)
-	if resp.Error == "" {
-		t.Errorf("Expected error message, got empty string")
+	if len(resp.Errors) != 1 || resp.Errors[0].Field != "title" || resp.Errors[0].Code != "required" {
+		t.Errorf("Expected title to be reported as required, got %+v", resp)
 	}
 }
 
@@ -150,13 +603,13 @@ func TestCreateBook_MissingAuthor(t *testing.T) {
 	w := httptest.NewRecorder()
 	handler.CreateBook(w, req)
 
-	if w.Code != http.StatusBadRequest {
-		t.Errorf("Expected status 400, got %d", w.Code)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", w.Code)
 	}
-	var resp models.ErrorResponse
+	var resp models.Problem
 	_ = json.Unmarshal(w.Body.Bytes(), &resp)
-	if resp.Error == "" {
-		t.Errorf("Expected error message, got empty string")
+	if len(resp.Errors) != 1 || resp.Errors[0].Field != "author" || resp.Errors[0].Code != "required" {
+		t.Errorf("Expected author to be reported as required, got %+v", resp)
 	}
 }
 
@@ -169,20 +622,18 @@ func TestCreateBook_InvalidPayload(t *testing.T) {
 	if w.Code != http.StatusBadRequest {
 		t.Errorf("Expected status 400, got %d", w.Code)
 	}
-	var resp models.ErrorResponse
+	var resp models.Problem
 	_ = json.Unmarshal(w.Body.Bytes(), &resp)
-	if resp.Error == "" {
-		t.Errorf("Expected error message, got empty string")
+	if resp.Detail == "" {
+		t.Errorf("Expected problem detail, got empty string")
 	}
 }
 
 func TestCreateBook_DBError(t *testing.T) {
-	handler, mock := getMockHandler(t)
+	handler, store := getMockHandler(t)
+	store.err = errors.New("insert error")
 	book := models.Book{Title: "Test Book", Author: "Test Author"}
 	body, _ := json.Marshal(book)
-	mock.ExpectExec("INSERT INTO books").
-		WithArgs(sqlmock.AnyArg(), "Test Book", "Test Author", 0, "").
-		WillReturnError(errors.New("insert error"))
 
 	req := httptest.NewRequest("POST", "/books", bytes.NewBuffer(body))
 	w := httptest.NewRecorder()
@@ -191,85 +642,415 @@ func TestCreateBook_DBError(t *testing.T) {
 	if w.Code != http.StatusInternalServerError {
 		t.Errorf("Expected status 500, got %d", w.Code)
 	}
-	var resp models.ErrorResponse
+	var resp models.Problem
 	_ = json.Unmarshal(w.Body.Bytes(), &resp)
-	if resp.Error == "" {
-		t.Errorf("Expected error message, got empty string")
+	if resp.Detail == "" {
+		t.Errorf("Expected problem detail, got empty string")
 	}
 }
 
 func TestUpdateBook_Valid(t *testing.T) {
-	handler, mock := getMockHandler(t)
-	book := models.Book{Title: "Updated Title", Author: "Updated Author", PublishedYear: 2024, Genre: "Updated Genre"}
+	handler, store := getMockHandler(t, testBook())
+	book := models.Book{Title: "Updated Title", Author: "Updated Author", PublishedYear: 2024, Genre: "Drama"}
 	body, _ := json.Marshal(book)
-	mock.ExpectExec("UPDATE books SET title = \\?, author = \\?, published_year = \\?, genre = \\? WHERE id = \\?").
-		WithArgs("Updated Title", "Updated Author", 2024, "Updated Genre", "123e4567-e89b-12d3-a456-426614174000").
-		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	req := httptest.NewRequest("PUT", "/books/123e4567-e89b-12d3-a456-426614174000", bytes.NewBuffer(body))
+	req := httptest.NewRequest("PUT", "/books/"+testBookID, bytes.NewBuffer(body))
 	w := httptest.NewRecorder()
-	req = muxSetVars(req, map[string]string{"id": "123e4567-e89b-12d3-a456-426614174000"})
+	req = muxSetVars(req, map[string]string{"id": testBookID})
 	handler.UpdateBook(w, req)
 
 	if w.Code != http.StatusOK {
 		t.Errorf("Expected status 200, got %d", w.Code)
 	}
-	var resp models.MessageResponse
+	var resp models.BookResponse
 	_ = json.Unmarshal(w.Body.Bytes(), &resp)
-	if resp.Message == "" {
-		t.Errorf("Expected message, got empty string")
+	if resp.Book.Title != "Updated Title" || resp.Book.Version != 1 {
+		t.Errorf("Expected the updated book, got %+v", resp.Book)
+	}
+	if etag := w.Header().Get("ETag"); etag != `"v1"` {
+		t.Errorf("Expected the ETag of the new version, got %q", etag)
+	}
+	if store.books[testBookID].Title != "Updated Title" {
+		t.Errorf("Expected stored title to be updated, got %q", store.books[testBookID].Title)
 	}
 }
 
 func TestUpdateBook_NotFound(t *testing.T) {
-	handler, mock := getMockHandler(t)
+	handler, _ := getMockHandler(t)
 	book := models.Book{Title: "Updated Title", Author: "Updated Author"}
 	body, _ := json.Marshal(book)
-	mock.ExpectExec("UPDATE books SET title = \\?, author = \\?, published_year = \\?, genre = \\? WHERE id = \\?").
-		WithArgs("Updated Title", "Updated Author", 0, "", "123e4567-e89b-12d3-a456-426614174000").
-		WillReturnResult(sqlmock.NewResult(1, 0))
 
-	req := httptest.NewRequest("PUT", "/books/123e4567-e89b-12d3-a456-426614174000", bytes.NewBuffer(body))
+	req := httptest.NewRequest("PUT", "/books/"+testBookID, bytes.NewBuffer(body))
 	w := httptest.NewRecorder()
-	req = muxSetVars(req, map[string]string{"id": "123e4567-e89b-12d3-a456-426614174000"})
+	req = muxSetVars(req, map[string]string{"id": testBookID})
 	handler.UpdateBook(w, req)
 
 	if w.Code != http.StatusNotFound {
 		t.Errorf("Expected status 404, got %d", w.Code)
 	}
-	var resp models.ErrorResponse
+	var resp models.Problem
 	_ = json.Unmarshal(w.Body.Bytes(), &resp)
-	if resp.Error == "" {
-		t.Errorf("Expected error message, got empty string")
+	if resp.Detail == "" {
+		t.Errorf("Expected problem detail, got empty string")
 	}
 }
 
 func TestUpdateBook_InvalidPayload(t *testing.T) {
 	handler, _ := getMockHandler(t)
-	req := httptest.NewRequest("PUT", "/books/123e4567-e89b-12d3-a456-426614174000", bytes.NewBuffer([]byte(`invalid-json`)))
+	req := httptest.NewRequest("PUT", "/books/"+testBookID, bytes.NewBuffer([]byte(`invalid-json`)))
 	w := httptest.NewRecorder()
-	req = muxSetVars(req, map[string]string{"id": "123e4567-e89b-12d3-a456-426614174000"})
+	req = muxSetVars(req, map[string]string{"id": testBookID})
 	handler.UpdateBook(w, req)
 
 	if w.Code != http.StatusBadRequest {
 		t.Errorf("Expected status 400, got %d", w.Code)
 	}
-	var resp models.ErrorResponse
+	var resp models.Problem
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Detail == "" {
+		t.Errorf("Expected problem detail, got empty string")
+	}
+}
+
+func TestGetBookByID_ETag(t *testing.T) {
+	book := testBook()
+	book.Version = 4
+	handler, _ := getMockHandler(t, book)
+
+	req := httptest.NewRequest("GET", "/books/"+testBookID, nil)
+	req = muxSetVars(req, map[string]string{"id": testBookID})
+	w := httptest.NewRecorder()
+	handler.GetBookByID(w, req)
+
+	if got := w.Header().Get("ETag"); got != `"v4"` {
+		t.Errorf(`Expected ETag "v4", got %q`, got)
+	}
+}
+
+func TestGetBookByID_ConditionalGet(t *testing.T) {
+	book := testBook()
+	book.Version = 4
+	book.UpdatedAt = time.Date(2025, 5, 1, 12, 0, 0, 500, time.UTC)
+	handler, _ := getMockHandler(t, book)
+
+	get := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/books/"+testBookID, nil)
+		req.Header.Set(header, value)
+		req = muxSetVars(req, map[string]string{"id": testBookID})
+		w := httptest.NewRecorder()
+		handler.GetBookByID(w, req)
+		return w
+	}
+
+	w := get("If-None-Match", `"v3"`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for a stale ETag, got %d", w.Code)
+	}
+	if got := w.Header().Get("Last-Modified"); got != "Thu, 01 May 2025 12:00:00 GMT" {
+		t.Errorf("Unexpected Last-Modified %q", got)
+	}
+	if got := w.Header().Get("Cache-Control"); got != defaultCacheControl {
+		t.Errorf("Expected Cache-Control %q, got %q", defaultCacheControl, got)
+	}
+
+	tests := []struct {
+		header, value string
+		want          int
+	}{
+		{"If-None-Match", `"v4"`, http.StatusNotModified},
+		{"If-None-Match", `"v1", W/"v4"`, http.StatusNotModified},
+		{"If-None-Match", `*`, http.StatusNotModified},
+		{"If-Modified-Since", "Thu, 01 May 2025 12:00:00 GMT", http.StatusNotModified},
+		{"If-Modified-Since", "Thu, 01 May 2025 11:59:59 GMT", http.StatusOK},
+		{"If-Modified-Since", "not a date", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := get(tt.header, tt.value)
+		if w.Code != tt.want {
+			t.Errorf("%s: %s: expected status %d, got %d", tt.header, tt.value, tt.want, w.Code)
+		}
+		if w.Code == http.StatusNotModified && (w.Body.Len() != 0 || w.Header().Get("ETag") != `"v4"`) {
+			t.Errorf("%s: %s: expected an empty 304 carrying the ETag", tt.header, tt.value)
+		}
+	}
+}
+
+func TestGetBooks_ConditionalGet(t *testing.T) {
+	handler, store := getMemoryHandler(t,
+		models.Book{Title: "Dune", Author: "Frank Herbert"},
+		models.Book{Title: "Emma", Author: "Jane Austen"},
+	)
+
+	get := func(url, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", url, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		handler.GetBooks(w, req)
+		return w
+	}
+
+	first := get("/books?limit=1", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Header().Get("Last-Modified") == "" {
+		t.Fatalf("Expected status 200 with validators, got %d with %v", first.Code, first.Header())
+	}
+	if w := get("/books?limit=1", etag); w.Code != http.StatusNotModified {
+		t.Errorf("Expected status 304 for an unchanged list, got %d", w.Code)
+	}
+	if w := get("/books?limit=2", etag); w.Code != http.StatusOK {
+		t.Errorf("Expected a different query to have its own ETag, got %d", w.Code)
+	}
+
+	books, _ := store.GetBooks(context.Background(), models.BookQuery{Limit: 2})
+	store.PatchBook(context.Background(), books[1].ID.String(), map[string]interface{}{"genre": "Classic"}, 0)
+	if w := get("/books?limit=1", etag); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 once a book changed, got %d", w.Code)
+	}
+}
+
+func TestGetBooks_IfModifiedSinceAfterDelete(t *testing.T) {
+	handler, store := getMemoryHandler(t,
+		models.Book{Title: "Dune", Author: "Frank Herbert"},
+		models.Book{Title: "Emma", Author: "Jane Austen"},
+	)
+
+	get := func(ifModifiedSince string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/books", nil)
+		if ifModifiedSince != "" {
+			req.Header.Set("If-Modified-Since", ifModifiedSince)
+		}
+		w := httptest.NewRecorder()
+		handler.GetBooks(w, req)
+		return w
+	}
+
+	first := get("")
+	lastModified := first.Header().Get("Last-Modified")
+	if first.Code != http.StatusOK || lastModified == "" {
+		t.Fatalf("Expected status 200 with Last-Modified, got %d with %v", first.Code, first.Header())
+	}
+	if w := get(lastModified); w.Code != http.StatusNotModified {
+		t.Errorf("Expected status 304 for an unchanged list, got %d", w.Code)
+	}
+
+	// Last-Modified has second precision, delete in the next second
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	books, _ := store.GetBooks(context.Background(), models.BookQuery{Limit: 2})
+	store.DeleteBook(context.Background(), books[0].ID.String(), 0)
+
+	w := get(lastModified)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 once a book was deleted, got %d", w.Code)
+	}
+	var resp models.BooksResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Data) != 1 {
+		t.Errorf("Expected the deleted book to be gone, got %+v", resp.Data)
+	}
+}
+
+// sendIfMatch sends a write with an optional If-Match header to the handler
+func sendIfMatch(handler http.HandlerFunc, method, ifMatch, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/books/"+testBookID, bytes.NewBufferString(body))
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	if method == "PATCH" {
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+	}
+	req = muxSetVars(req, map[string]string{"id": testBookID})
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+func TestUpdateBook_IfMatch(t *testing.T) {
+	book := testBook()
+	book.Version = 2
+	handler, store := getMockHandler(t, book)
+	body := `{"title":"Updated Title","author":"Updated Author"}`
+
+	tests := []struct {
+		ifMatch string
+		want    int
+	}{
+		{`"v1"`, http.StatusPreconditionFailed},
+		{`W/"v2"`, http.StatusPreconditionFailed},
+		{`"v1", "v5"`, http.StatusPreconditionFailed},
+		{`"v1", "v2"`, http.StatusOK},
+		{`"v3"`, http.StatusOK},
+		{`*`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := sendIfMatch(handler.UpdateBook, "PUT", tt.ifMatch, body)
+		if w.Code != tt.want {
+			t.Errorf("If-Match %s: expected status %d, got %d", tt.ifMatch, tt.want, w.Code)
+		}
+		// the next If-Match can use the ETag of the answer
+		if want := bookETag(store.books[testBookID]); w.Code == http.StatusOK && w.Header().Get("ETag") != want {
+			t.Errorf("If-Match %s: expected ETag %s, got %q", tt.ifMatch, want, w.Header().Get("ETag"))
+		}
+	}
+	if store.books[testBookID].Version != 5 {
+		t.Errorf("Expected three successful updates, got version %d", store.books[testBookID].Version)
+	}
+}
+
+func TestWithCacheControl(t *testing.T) {
+	handler := InitBooksHandler(context.Background(), newFakeStore(testBook()), WithCursorSecret([]byte("test-secret")), WithCacheControl("private, max-age=30"))
+	req := httptest.NewRequest("GET", "/books", nil)
+	w := httptest.NewRecorder()
+	handler.GetBooks(w, req)
+	if got := w.Header().Get("Cache-Control"); got != "private, max-age=30" {
+		t.Errorf("Expected the configured Cache-Control, got %q", got)
+	}
+}
+
+func TestWrites_RequireIfMatch(t *testing.T) {
+	store := newFakeStore(testBook())
+	handler := InitBooksHandler(context.Background(), store, WithCursorSecret([]byte("test-secret")), WithRequireIfMatch(true))
+
+	if w := sendIfMatch(handler.UpdateBook, "PUT", "", `{"title":"T","author":"A"}`); w.Code != http.StatusPreconditionRequired {
+		t.Errorf("PUT: expected status 428, got %d", w.Code)
+	}
+	if w := sendIfMatch(handler.PatchBook, "PATCH", "", `{"title":"T"}`); w.Code != http.StatusPreconditionRequired {
+		t.Errorf("PATCH: expected status 428, got %d", w.Code)
+	}
+	if w := sendIfMatch(handler.DeleteBook, "DELETE", "", ""); w.Code != http.StatusPreconditionRequired {
+		t.Errorf("DELETE: expected status 428, got %d", w.Code)
+	}
+	if w := sendIfMatch(handler.DeleteBook, "DELETE", `"v0"`, ""); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("DELETE: expected status 412, got %d", w.Code)
+	}
+	if len(store.books) != 1 {
+		t.Fatal("Expected the book to survive writes without a matching If-Match")
+	}
+	if w := sendIfMatch(handler.DeleteBook, "DELETE", `"v0", *`, ""); w.Code != http.StatusOK {
+		t.Errorf("DELETE: expected status 200, got %d", w.Code)
+	}
+}
+
+func TestPatchBook_IfMatch(t *testing.T) {
+	handler, store := getMemoryHandler(t, models.Book{Title: "Dune", Author: "Frank Herbert"})
+	books, _ := store.GetBooks(context.Background(), models.BookQuery{Limit: 1})
+	id := books[0].ID.String()
+
+	send := func(ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", "/books/"+id, bytes.NewBufferString(`{"genre":"Sci-Fi"}`))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		req.Header.Set("If-Match", ifMatch)
+		req = muxSetVars(req, map[string]string{"id": id})
+		w := httptest.NewRecorder()
+		handler.PatchBook(w, req)
+		return w
+	}
+	w := send(`"v1"`)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"v2"` {
+		t.Errorf(`Expected status 200 with ETag "v2", got %d with %q`, w.Code, w.Header().Get("ETag"))
+	}
+	if w := send(`"v1"`); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected status 412 for a stale ETag, got %d", w.Code)
+	}
+}
+
+// patchBook sends a PATCH for the book to the handler
+func patchBook(handler *BooksHandler, id, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("PATCH", "/books/"+id, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", contentType)
+	req = muxSetVars(req, map[string]string{"id": id})
+	w := httptest.NewRecorder()
+	handler.PatchBook(w, req)
+	return w
+}
+
+func TestPatchBook_MergePatch(t *testing.T) {
+	handler, store := getMemoryHandler(t, models.Book{Title: "Dune", Author: "Frank Herbert", PublishedYear: 1965, Genre: "Sci-Fi"})
+	books, _ := store.GetBooks(context.Background(), models.BookQuery{Limit: 1})
+	id := books[0].ID.String()
+
+	w := patchBook(handler, id, "application/merge-patch+json", `{"title":"Dune Messiah","genre":null}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp models.BookResponse
 	_ = json.Unmarshal(w.Body.Bytes(), &resp)
-	if resp.Error == "" {
-		t.Errorf("Expected error message, got empty string")
+	if resp.Book.Title != "Dune Messiah" || resp.Book.Author != "Frank Herbert" || resp.Book.PublishedYear != 1965 || resp.Book.Genre != "" {
+		t.Errorf("Expected only title and genre to change, got %+v", resp.Book)
+	}
+}
+
+func TestPatchBook_JSONPatch(t *testing.T) {
+	handler, store := getMemoryHandler(t, models.Book{Title: "Dune", Author: "Frank Herbert", Genre: "Sci-Fi"})
+	books, _ := store.GetBooks(context.Background(), models.BookQuery{Limit: 1})
+	id := books[0].ID.String()
+
+	w := patchBook(handler, id, "application/json-patch+json", `[
+		{"op":"test","path":"/title","value":"Dune"},
+		{"op":"replace","path":"/published_year","value":1965},
+		{"op":"copy","from":"/genre","path":"/title"}
+	]`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	book, _ := store.GetBookByID(context.Background(), id)
+	if book.Title != "Sci-Fi" || book.PublishedYear != 1965 || book.Author != "Frank Herbert" || book.Genre != "Sci-Fi" {
+		t.Errorf("Unexpected stored book %+v", book)
+	}
+}
+
+func TestPatchBook_Errors(t *testing.T) {
+	handler, store := getMemoryHandler(t, models.Book{Title: "Dune", Author: "Frank Herbert"})
+	books, _ := store.GetBooks(context.Background(), models.BookQuery{Limit: 1})
+	id := books[0].ID.String()
+
+	tests := []struct {
+		name        string
+		id          string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"unsupported media type", id, "application/json", `{"title":"x"}`, http.StatusUnsupportedMediaType},
+		{"invalid id", "not-a-uuid", "application/merge-patch+json", `{}`, http.StatusBadRequest},
+		{"malformed merge patch", id, "application/merge-patch+json", `{"title":`, http.StatusBadRequest},
+		{"malformed json patch", id, "application/json-patch+json", `[{"op":"frobnicate","path":"/title"}]`, http.StatusBadRequest},
+		{"missing book", uuid.New().String(), "application/merge-patch+json", `{"title":"x"}`, http.StatusNotFound},
+		{"failed test", id, "application/json-patch+json", `[{"op":"test","path":"/title","value":"Emma"}]`, http.StatusConflict},
+		{"missing path", id, "application/json-patch+json", `[{"op":"replace","path":"/publisher","value":"x"}]`, http.StatusConflict},
+		{"required title", id, "application/merge-patch+json", `{"title":null}`, http.StatusUnprocessableEntity},
+		{"empty author", id, "application/json-patch+json", `[{"op":"replace","path":"/author","value":""}]`, http.StatusUnprocessableEntity},
+		{"read-only id", id, "application/merge-patch+json", `{"id":"` + uuid.New().String() + `"}`, http.StatusBadRequest},
+		{"unknown field", id, "application/merge-patch+json", `{"publisher":"x"}`, http.StatusBadRequest},
+		{"fractional year", id, "application/merge-patch+json", `{"published_year":1965.5}`, http.StatusBadRequest},
+		{"invalid isbn", id, "application/merge-patch+json", `{"isbn":"978-0-441-17271-8"}`, http.StatusUnprocessableEntity},
+		{"unknown genre", id, "application/merge-patch+json", `{"genre":"Gardening"}`, http.StatusUnprocessableEntity},
+		{"numeric title", id, "application/merge-patch+json", `{"title":42}`, http.StatusBadRequest},
+		{"not an object", id, "application/merge-patch+json", `["title"]`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := patchBook(handler, tt.id, tt.contentType, tt.body)
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.name, tt.want, w.Code, w.Body.String())
+		}
+	}
+	if got := patchBook(handler, id, "text/plain", "").Header().Get("Accept-Patch"); got != acceptPatch {
+		t.Errorf("Expected Accept-Patch %q, got %q", acceptPatch, got)
+	}
+
+	book, _ := store.GetBookByID(context.Background(), id)
+	if book.Title != "Dune" || book.Author != "Frank Herbert" {
+		t.Errorf("Expected rejected patches to leave the book alone, got %+v", book)
 	}
 }
 
 func TestDeleteBook_Valid(t *testing.T) {
-	handler, mock := getMockHandler(t)
-	mock.ExpectExec("DELETE FROM books WHERE id = \\?").
-		WithArgs("123e4567-e89b-12d3-a456-426614174000").
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	handler, store := getMockHandler(t, testBook())
 
-	req := httptest.NewRequest("DELETE", "/books/123e4567-e89b-12d3-a456-426614174000", nil)
+	req := httptest.NewRequest("DELETE", "/books/"+testBookID, nil)
 	w := httptest.NewRecorder()
-	req = muxSetVars(req, map[string]string{"id": "123e4567-e89b-12d3-a456-426614174000"})
+	req = muxSetVars(req, map[string]string{"id": testBookID})
 	handler.DeleteBook(w, req)
 
 	if w.Code != http.StatusOK {
@@ -280,47 +1061,103 @@ func TestDeleteBook_Valid(t *testing.T) {
 	if resp.Message == "" {
 		t.Errorf("Expected message, got empty string")
 	}
+	if len(store.books) != 0 {
+		t.Errorf("Expected book to be removed from the store")
+	}
 }
 
 func TestDeleteBook_NotFound(t *testing.T) {
-	handler, mock := getMockHandler(t)
-	mock.ExpectExec("DELETE FROM books WHERE id = \\?").
-		WithArgs("123e4567-e89b-12d3-a456-426614174000").
-		WillReturnResult(sqlmock.NewResult(1, 0))
+	handler, _ := getMockHandler(t)
 
-	req := httptest.NewRequest("DELETE", "/books/123e4567-e89b-12d3-a456-426614174000", nil)
+	req := httptest.NewRequest("DELETE", "/books/"+testBookID, nil)
 	w := httptest.NewRecorder()
-	req = muxSetVars(req, map[string]string{"id": "123e4567-e89b-12d3-a456-426614174000"})
+	req = muxSetVars(req, map[string]string{"id": testBookID})
 	handler.DeleteBook(w, req)
 
 	if w.Code != http.StatusNotFound {
 		t.Errorf("Expected status 404, got %d", w.Code)
 	}
-	var resp models.ErrorResponse
+	var resp models.Problem
 	_ = json.Unmarshal(w.Body.Bytes(), &resp)
-	if resp.Error == "" {
-		t.Errorf("Expected error message, got empty string")
+	if resp.Detail == "" {
+		t.Errorf("Expected problem detail, got empty string")
 	}
 }
 
 func TestDeleteBook_DBError(t *testing.T) {
-	handler, mock := getMockHandler(t)
-	mock.ExpectExec("DELETE FROM books WHERE id = \\?").
-		WithArgs("123e4567-e89b-12d3-a456-426614174000").
-		WillReturnError(errors.New("delete error"))
+	handler, store := getMockHandler(t, testBook())
+	store.err = errors.New("delete error")
 
-	req := httptest.NewRequest("DELETE", "/books/123e4567-e89b-12d3-a456-426614174000", nil)
+	req := httptest.NewRequest("DELETE", "/books/"+testBookID, nil)
 	w := httptest.NewRecorder()
-	req = muxSetVars(req, map[string]string{"id": "123e4567-e89b-12d3-a456-426614174000"})
+	req = muxSetVars(req, map[string]string{"id": testBookID})
 	handler.DeleteBook(w, req)
 
 	if w.Code != http.StatusInternalServerError {
 		t.Errorf("Expected status 500, got %d", w.Code)
 	}
-	var resp models.ErrorResponse
+	var resp models.Problem
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Detail == "" {
+		t.Errorf("Expected problem detail, got empty string")
+	}
+}
+
+func TestTrashAndRestore(t *testing.T) {
+	handler, store := getMemoryHandler(t,
+		models.Book{Title: "Dune", Author: "Frank Herbert"},
+		models.Book{Title: "Emma", Author: "Jane Austen"},
+	)
+	books, _ := store.GetBooks(context.Background(), models.BookQuery{Limit: 2, Sort: []models.SortField{{Field: "title"}}})
+	id := books[0].ID.String()
+
+	req := httptest.NewRequest("DELETE", "/books/"+id, nil)
+	req = muxSetVars(req, map[string]string{"id": id})
+	handler.DeleteBook(httptest.NewRecorder(), req)
+
+	list := func(url string) models.BooksResponse {
+		w := httptest.NewRecorder()
+		if url == "/books/trash" {
+			handler.GetTrash(w, httptest.NewRequest("GET", url, nil))
+		} else {
+			handler.GetBooks(w, httptest.NewRequest("GET", url, nil))
+		}
+		var resp models.BooksResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+	if live := list("/books"); live.Total != 1 || live.Data[0].Title != "Emma" {
+		t.Errorf("Expected the deleted book to leave the list, got %+v", live.Data)
+	}
+	trash := list("/books/trash")
+	if trash.Total != 1 || trash.Data[0].Title != "Dune" || trash.Data[0].DeletedAt == nil {
+		t.Fatalf("Expected the deleted book in the trash, got %+v", trash.Data)
+	}
+
+	restore := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/books/"+id+"/restore", nil)
+		req = muxSetVars(req, map[string]string{"id": id})
+		w := httptest.NewRecorder()
+		handler.RestoreBook(w, req)
+		return w
+	}
+	w := restore(id)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var resp models.BookResponse
 	_ = json.Unmarshal(w.Body.Bytes(), &resp)
-	if resp.Error == "" {
-		t.Errorf("Expected error message, got empty string")
+	if resp.Book.Title != "Dune" || resp.Book.DeletedAt != nil {
+		t.Errorf("Expected the restored book, got %+v", resp.Book)
+	}
+	if w := restore(id); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 restoring a live book, got %d", w.Code)
+	}
+	if w := restore("not-a-uuid"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+	if live := list("/books"); live.Total != 2 {
+		t.Errorf("Expected both books back in the list, got %d", live.Total)
 	}
 }
 
@@ -328,3 +1165,550 @@ func TestDeleteBook_DBError(t *testing.T) {
 func muxSetVars(r *http.Request, vars map[string]string) *http.Request {
 	return mux.SetURLVars(r, vars)
 }
+
+// TestUpdateBook_LegacyGenre checks a book filed under a genre stored before
+// genres were restricted can be edited, as long as the edit keeps its genre
+func TestUpdateBook_LegacyGenre(t *testing.T) {
+	handler, store := getMemoryHandler(t, models.Book{Title: "Dune", Author: "Frank Herbert", Genre: "Science fiction"})
+	books, _ := store.GetBooks(context.Background(), models.BookQuery{Limit: 1})
+	id := books[0].ID.String()
+
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/books/"+id, bytes.NewBufferString(body))
+		req = muxSetVars(req, map[string]string{"id": id})
+		w := httptest.NewRecorder()
+		handler.UpdateBook(w, req)
+		return w
+	}
+	if w := put(`{"title":"Dune","author":"Frank Herbert","published_year":1965,"genre":"Science fiction"}`); w.Code != http.StatusOK {
+		t.Errorf("Expected a PUT keeping the genre to pass, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := put(`{"title":"Dune","author":"Frank Herbert","genre":"Space opera"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected a PUT changing to another unknown genre to fail, got %d", w.Code)
+	}
+	if w := patchBook(handler, id, "application/merge-patch+json", `{"published_year":1966}`); w.Code != http.StatusOK {
+		t.Errorf("Expected a PATCH leaving the genre alone to pass, got %d: %s", w.Code, w.Body.String())
+	}
+
+	body := `{"operations":[{"op":"update","id":"` + id + `","book":{"title":"Dune","author":"Frank Herbert","genre":"Science fiction"}}]}`
+	w := httptest.NewRecorder()
+	handler.BatchBooks(w, httptest.NewRequest("POST", "/books:batch", bytes.NewBufferString(body)))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected a batch update keeping the genre to pass, got %d: %s", w.Code, w.Body.String())
+	}
+	book, _ := store.GetBookByID(context.Background(), id)
+	if book.Genre != "Science fiction" || book.Version != 4 {
+		t.Errorf("Expected the genre kept through 3 edits, got %+v", book)
+	}
+}
+
+func TestGetBookHistory(t *testing.T) {
+	handler, store := getMemoryHandler(t, models.Book{Title: "Dune", Author: "Frank Herbert"})
+	books, _ := store.GetBooks(context.Background(), models.BookQuery{Limit: 1})
+	id := books[0].ID.String()
+
+	req := httptest.NewRequest("PUT", "/books/"+id, bytes.NewBufferString(`{"title":"Dune","author":"Frank Herbert","published_year":1965}`))
+	req = muxSetVars(req, map[string]string{"id": id})
+	handler.UpdateBook(httptest.NewRecorder(), req)
+
+	tests := []struct {
+		name    string
+		id      string
+		code    int
+		entries int
+	}{
+		{"history", id, http.StatusOK, 2},
+		{"invalid id", "not-a-uuid", http.StatusBadRequest, 0},
+		{"unknown book", "123e4567-e89b-12d3-a456-426614174999", http.StatusNotFound, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/books/"+tt.id+"/history", nil)
+			req = muxSetVars(req, map[string]string{"id": tt.id})
+			w := httptest.NewRecorder()
+			handler.GetBookHistory(w, req)
+
+			if w.Code != tt.code {
+				t.Fatalf("Expected status %d, got %d", tt.code, w.Code)
+			}
+			var resp models.AuditResponse
+			_ = json.Unmarshal(w.Body.Bytes(), &resp)
+			if len(resp.Data) != tt.entries {
+				t.Fatalf("Expected %d entries, got %+v", tt.entries, resp.Data)
+			}
+			if tt.entries > 0 {
+				update := resp.Data[1]
+				if update.Action != models.AuditUpdate || update.Changes["published_year"].After != float64(1965) {
+					t.Errorf("Unexpected update entry %+v", update)
+				}
+			}
+		})
+	}
+}
+
+// TestGetBookHistory_BeforeAuditLog checks a book with no recorded history,
+// as books created before the audit log have, gets an empty one
+func TestGetBookHistory_BeforeAuditLog(t *testing.T) {
+	handler, _ := getMockHandler(t, models.Book{ID: uuid.MustParse(testBookID), Title: "Dune", Author: "Frank Herbert"})
+
+	for _, tt := range []struct {
+		id   string
+		code int
+	}{
+		{testBookID, http.StatusOK},
+		{"123e4567-e89b-12d3-a456-426614174999", http.StatusNotFound},
+	} {
+		req := httptest.NewRequest("GET", "/books/"+tt.id+"/history", nil)
+		req = muxSetVars(req, map[string]string{"id": tt.id})
+		w := httptest.NewRecorder()
+		handler.GetBookHistory(w, req)
+
+		if w.Code != tt.code {
+			t.Fatalf("%s: expected status %d, got %d", tt.id, tt.code, w.Code)
+		}
+		var resp models.AuditResponse
+		if tt.code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Data == nil || len(resp.Data) != 0 {
+				t.Errorf("Expected an empty history, got %s (err: %v)", w.Body.String(), err)
+			}
+		}
+	}
+}
+
+func TestBatchBooks(t *testing.T) {
+	missing := "123e4567-e89b-12d3-a456-426614174999"
+	tests := []struct {
+		name      string
+		body      string
+		code      int
+		statuses  []int
+		committed bool
+		live      int
+	}{
+		{
+			name:      "atomic success",
+			body:      `{"operations":[{"op":"create","book":{"title":"Emma","author":"Jane Austen"}},{"op":"update","id":"{id}","version":1,"book":{"title":"Dune","author":"Frank Herbert","published_year":1965}}]}`,
+			code:      http.StatusOK,
+			statuses:  []int{http.StatusCreated, http.StatusOK},
+			committed: true,
+			live:      2,
+		},
+		{
+			name:     "atomic store failure",
+			body:     `{"mode":"atomic","operations":[{"op":"create","book":{"title":"Emma","author":"Jane Austen"}},{"op":"delete","id":"` + missing + `"}]}`,
+			code:     http.StatusNotFound,
+			statuses: []int{http.StatusFailedDependency, http.StatusNotFound},
+			live:     1,
+		},
+		{
+			name:     "atomic invalid operation",
+			body:     `{"operations":[{"op":"create","book":{"title":"Emma","author":"Jane Austen"}},{"op":"create","book":{"title":"Untitled"}}]}`,
+			code:     http.StatusUnprocessableEntity,
+			statuses: []int{http.StatusFailedDependency, http.StatusUnprocessableEntity},
+			live:     1,
+		},
+		{
+			name:      "partial",
+			body:      `{"mode":"partial","operations":[{"op":"create","book":{"title":"Emma","author":"Jane Austen"}},{"op":"delete","id":"{id}","version":7},{"op":"rename"},{"op":"delete","id":"{id}"}]}`,
+			code:      http.StatusMultiStatus,
+			statuses:  []int{http.StatusCreated, http.StatusPreconditionFailed, http.StatusBadRequest, http.StatusOK},
+			committed: true,
+			live:      1,
+		},
+		{name: "unknown mode", body: `{"mode":"eventually","operations":[{"op":"delete","id":"{id}"}]}`, code: http.StatusBadRequest, live: 1},
+		{name: "empty", body: `{"operations":[]}`, code: http.StatusBadRequest, live: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, store := getMemoryHandler(t, models.Book{Title: "Dune", Author: "Frank Herbert"})
+			books, _ := store.GetBooks(context.Background(), models.BookQuery{Limit: 1})
+			body := strings.ReplaceAll(tt.body, "{id}", books[0].ID.String())
+
+			w := httptest.NewRecorder()
+			handler.BatchBooks(w, httptest.NewRequest("POST", "/books:batch", bytes.NewBufferString(body)))
+
+			if w.Code != tt.code {
+				t.Fatalf("Expected status %d, got %d: %s", tt.code, w.Code, w.Body.String())
+			}
+			var resp models.BatchResponse
+			_ = json.Unmarshal(w.Body.Bytes(), &resp)
+			if len(resp.Results) != len(tt.statuses) || resp.Committed != tt.committed {
+				t.Fatalf("Unexpected response %+v", resp)
+			}
+			for i, result := range resp.Results {
+				if result.Index != i || result.Status != tt.statuses[i] {
+					t.Errorf("Expected result %d to have status %d, got %+v", i, tt.statuses[i], result)
+				}
+			}
+			if n, _ := store.CountBooks(context.Background(), models.BookFilter{}); n != tt.live {
+				t.Errorf("Expected %d live books, got %d", tt.live, n)
+			}
+		})
+	}
+}
+
+func TestExportBooks(t *testing.T) {
+	handler, store := getMemoryHandler(t)
+	// more than one batch, so the export has to page through the store
+	for i := 0; i < exportBatchSize+2; i++ {
+		genre := "Sci-Fi"
+		if i%2 == 1 {
+			genre = "Romance"
+		}
+		store.CreateBook(context.Background(), models.Book{Title: fmt.Sprintf("Book %04d", i), Author: "Author", Genre: genre})
+	}
+
+	w := httptest.NewRecorder()
+	handler.ExportBooks(w, httptest.NewRequest("GET", "/books/export?format=csv&sort=title", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("Expected a CSV response, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != exportBatchSize+3 || !strings.HasPrefix(lines[0], "id,title,author") {
+		t.Fatalf("Expected a header and %d rows, got %d lines", exportBatchSize+2, len(lines))
+	}
+	if !strings.Contains(lines[1], ",Book 0000,") || !strings.Contains(lines[len(lines)-1], fmt.Sprintf(",Book %04d,", exportBatchSize+1)) {
+		t.Errorf("Expected every book in title order, got %s ... %s", lines[1], lines[len(lines)-1])
+	}
+
+	w = httptest.NewRecorder()
+	handler.ExportBooks(w, httptest.NewRequest("GET", "/books/export?genre=romance", nil))
+	if lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n"); len(lines) != exportBatchSize/2+2 {
+		t.Errorf("Expected the genre filter to apply, got %d lines", len(lines))
+	}
+
+	w = httptest.NewRecorder()
+	handler.ExportBooks(w, httptest.NewRequest("GET", "/books/export?format=xlsx", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown format, got %d", w.Code)
+	}
+}
+
+func TestImportBooks(t *testing.T) {
+	csv := "Book Title,Writer,Year\n" +
+		"Emma,Jane Austen,1815\n" +
+		"dune,frank herbert,1965\n" +
+		"Beloved,Toni Morrison,1987\n" +
+		"Emma,Jane Austen,1816\n" +
+		"Untitled,,\n"
+	tests := []struct {
+		name       string
+		query      string
+		body       string
+		code       int
+		imported   int
+		errors     int
+		duplicates int
+		live       int
+	}{
+		{"atomic with an invalid row", "", csv, http.StatusUnprocessableEntity, 0, 1, 2, 1},
+		{"partial", "&mode=partial", csv, http.StatusOK, 2, 1, 2, 3},
+		{"dry run", "&mode=partial&dry_run=true", csv, http.StatusOK, 2, 1, 2, 1},
+		{"atomic", "", "Book Title,Writer\nEmma,Jane Austen\n", http.StatusOK, 1, 0, 0, 2},
+		{"unmapped title", "", "Name,Writer\nEmma,Jane Austen\n", http.StatusBadRequest, 0, 0, 0, 1},
+		{"no rows", "", "Book Title,Writer\n", http.StatusBadRequest, 0, 0, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, store := getMemoryHandler(t, models.Book{Title: "Dune", Author: "Frank Herbert"})
+
+			req := httptest.NewRequest("POST", "/books/import?mapping=Book+Title:title,Writer:author,Year:published_year"+tt.query, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "text/csv")
+			w := httptest.NewRecorder()
+			handler.ImportBooks(w, req)
+
+			if w.Code != tt.code {
+				t.Fatalf("Expected status %d, got %d: %s", tt.code, w.Code, w.Body.String())
+			}
+			var resp models.ImportResponse
+			_ = json.Unmarshal(w.Body.Bytes(), &resp)
+			if resp.Imported != tt.imported || len(resp.Errors) != tt.errors || len(resp.Duplicates) != tt.duplicates {
+				t.Errorf("Unexpected report %+v", resp)
+			}
+			if n, _ := store.CountBooks(context.Background(), models.BookFilter{}); n != tt.live {
+				t.Errorf("Expected %d books after the import, got %d", tt.live, n)
+			}
+		})
+	}
+
+	handler, _ := getMemoryHandler(t)
+	w := httptest.NewRecorder()
+	handler.ImportBooks(w, httptest.NewRequest("POST", "/books/import", strings.NewReader("title,author\n")))
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status 415 without a CSV content type, got %d", w.Code)
+	}
+}
+
+func TestMARCXMLExportAndImport(t *testing.T) {
+	source, _ := getMemoryHandler(t,
+		models.Book{Title: "Emma", Author: "Austen, Jane", PublishedYear: 1815, Genre: "Romance"},
+		models.Book{Title: "Dune", Author: "Herbert, Frank", PublishedYear: 1965, Genre: "Sci-Fi"},
+	)
+	w := httptest.NewRecorder()
+	source.ExportBooks(w, httptest.NewRequest("GET", "/books/export?format=marcxml&sort=title", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != marcXMLContentType {
+		t.Fatalf("Expected a MARCXML response, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	exported := w.Body.String()
+	if !strings.HasSuffix(exported, "</collection>\n") || strings.Count(exported, "<record>") != 2 {
+		t.Fatalf("Expected a closed collection of 2 records, got %s", exported)
+	}
+
+	// a catalog holding one of the books imports only the other
+	target, store := getMemoryHandler(t, models.Book{Title: "Dune", Author: "Herbert, Frank"})
+	req := httptest.NewRequest("POST", "/books/import", strings.NewReader(exported))
+	req.Header.Set("Content-Type", "application/marcxml+xml")
+	w = httptest.NewRecorder()
+	target.ImportBooks(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp models.ImportResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Imported != 1 || len(resp.Duplicates) != 1 {
+		t.Fatalf("Unexpected report %+v", resp)
+	}
+	emma := resp.Books[0]
+	if emma.Title != "Emma" || emma.Author != "Austen, Jane" || emma.PublishedYear != 1815 || emma.Genre != "Romance" {
+		t.Errorf("Expected Emma to survive the round trip, got %+v", emma)
+	}
+	if n, _ := store.CountBooks(context.Background(), models.BookFilter{}); n != 2 {
+		t.Errorf("Expected 2 books after the import, got %d", n)
+	}
+
+	req = httptest.NewRequest("POST", "/books/import", strings.NewReader("00042nam"))
+	req.Header.Set("Content-Type", "application/marc")
+	w = httptest.NewRecorder()
+	target.ImportBooks(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Invalid MARC") {
+		t.Errorf("Expected status 400 for a truncated MARC file, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+// TestImportBooks_MARCFixtures imports the catalog fixtures, whose records
+// carry real subject headings rather than genres of the catalog
+func TestImportBooks_MARCFixtures(t *testing.T) {
+	tests := []struct {
+		file        string
+		contentType string
+		mode        string
+		genres      []string
+		// Beowulf has no author, the only thing wrong with the fixtures
+		errors int
+	}{
+		{"books.mrc", "application/marc", "atomic", []string{"Sci-Fi", "Sci-Fi"}, 0},
+		{"books.xml", "application/marcxml+xml", "partial", []string{"Fiction"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			fixture, err := os.ReadFile("../../catalog/testdata/" + tt.file)
+			if err != nil {
+				t.Fatalf("failed to read fixture: %v", err)
+			}
+			handler, store := getMemoryHandler(t)
+			req := httptest.NewRequest("POST", "/books/import?mode="+tt.mode, bytes.NewReader(fixture))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			handler.ImportBooks(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+			var resp models.ImportResponse
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if resp.Imported != len(tt.genres) || len(resp.Errors) != tt.errors {
+				t.Fatalf("Expected %d books imported and %d errors, got %+v", len(tt.genres), tt.errors, resp)
+			}
+			for _, rowErr := range resp.Errors {
+				if rowErr.Field != "author" {
+					t.Errorf("Unexpected error %+v", rowErr)
+				}
+			}
+			for i, book := range resp.Books {
+				if book.Genre != tt.genres[i] {
+					t.Errorf("Expected %s filed under %s, got %q", book.Title, tt.genres[i], book.Genre)
+				}
+			}
+			if n, _ := store.CountBooks(context.Background(), models.BookFilter{}); n != len(tt.genres) {
+				t.Errorf("Expected %d books, got %d", len(tt.genres), n)
+			}
+		})
+	}
+}
+
+func TestGetBookMARCXML(t *testing.T) {
+	handler, store := getMemoryHandler(t, models.Book{Title: "Dune", Author: "Herbert, Frank", PublishedYear: 1965})
+	books, _ := store.GetBooks(context.Background(), models.BookQuery{Limit: 1})
+	id := books[0].ID.String()
+
+	tests := []struct {
+		name string
+		id   string
+		code int
+	}{
+		{"found", id, http.StatusOK},
+		{"not found", uuid.NewString(), http.StatusNotFound},
+		{"invalid id", "nope", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.GetBookMARCXML(w, muxSetVars(httptest.NewRequest("GET", "/books/"+tt.id+"/marcxml", nil), map[string]string{"id": tt.id}))
+			if w.Code != tt.code {
+				t.Fatalf("Expected status %d, got %d", tt.code, w.Code)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+			body := w.Body.String()
+			if w.Header().Get("Content-Type") != marcXMLContentType || w.Header().Get("ETag") == "" {
+				t.Errorf("Unexpected headers %v", w.Header())
+			}
+			if !strings.Contains(body, `<controlfield tag="001">`+id+`</controlfield>`) || !strings.Contains(body, `<subfield code="a">Dune</subfield>`) {
+				t.Errorf("Expected the book as a MARC record, got %s", body)
+			}
+		})
+	}
+}
+
+func TestBookISBN(t *testing.T) {
+	handler, store := getMemoryHandler(t, models.Book{Title: "Dune", Author: "Frank Herbert", ISBN: "9780441172719"})
+	books, _ := store.GetBooks(context.Background(), models.BookQuery{Limit: 1})
+	dune := books[0]
+
+	create := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.CreateBook(w, httptest.NewRequest("POST", "/books", strings.NewReader(body)))
+		return w
+	}
+	// the ISBN-10 of the same book is normalized before the clash
+	if w := create(`{"title":"Dune","author":"Frank Herbert","isbn":"0-441-17271-7"}`); w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a duplicate ISBN, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := create(`{"title":"Emma","author":"Jane Austen","isbn":"0-441-17271-8"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a wrong check digit, got %d", w.Code)
+	}
+	w := create(`{"title":"Emma","author":"Jane Austen","isbn":"978-0-14-143958-7"}`)
+	var created models.BookResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if w.Code != http.StatusCreated || created.Book.ISBN != "9780141439587" {
+		t.Fatalf("Expected the ISBN stored without hyphens, got %d %+v", w.Code, created.Book)
+	}
+
+	patched := patchBook(handler, created.Book.ID.String(), "application/merge-patch+json", `{"isbn":"9780441172719"}`)
+	if patched.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 patching in a taken ISBN, got %d", patched.Code)
+	}
+
+	tests := []struct {
+		name string
+		isbn string
+		code int
+	}{
+		{"isbn-13", "9780441172719", http.StatusOK},
+		{"hyphenated isbn-10", "0-441-17271-7", http.StatusOK},
+		{"unknown", "9780156027601", http.StatusNotFound},
+		{"invalid", "12345", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.GetBookByISBN(w, muxSetVars(httptest.NewRequest("GET", "/books/isbn/"+tt.isbn, nil), map[string]string{"isbn": tt.isbn}))
+			if w.Code != tt.code {
+				t.Fatalf("Expected status %d, got %d", tt.code, w.Code)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+			var resp models.BookResponse
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if resp.Book.ID != dune.ID {
+				t.Errorf("Expected Dune, got %+v", resp.Book)
+			}
+		})
+	}
+}
+
+func TestImportBooks_ISBN(t *testing.T) {
+	handler, store := getMemoryHandler(t,
+		models.Book{Title: "Dune", Author: "Frank Herbert", ISBN: "9780441172719"},
+		models.Book{Title: "Solaris", Author: "Stanisław Lem", ISBN: "9780156027601"},
+	)
+	trashed, _ := store.GetBookByISBN(context.Background(), "9780156027601")
+	store.DeleteBook(context.Background(), trashed.ID.String(), 0)
+
+	importCSV := func(body string) (int, models.ImportResponse) {
+		req := httptest.NewRequest("POST", "/books/import", strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/csv")
+		w := httptest.NewRecorder()
+		handler.ImportBooks(w, req)
+		var resp models.ImportResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	// the same ISBN is a duplicate whatever the title
+	code, resp := importCSV("title,author,isbn\n" +
+		"Dune (Ace),F. Herbert,0-441-17271-7\n" +
+		"Emma,Jane Austen,9780141439587\n" +
+		"Emma: a novel,Austen,978-0-14-143958-7\n" +
+		"Beloved,Toni Morrison,12345\n")
+	if code != http.StatusUnprocessableEntity || len(resp.Errors) != 1 || resp.Errors[0].Field != "isbn" || len(resp.Duplicates) != 2 {
+		t.Fatalf("Unexpected report %d %+v", code, resp)
+	}
+
+	// a book in the trash still holds its ISBN
+	code, resp = importCSV("title,author,isbn\nEmma,Jane Austen,9780141439587\nSolaris,Stanisław Lem,9780156027601\n")
+	if code != http.StatusConflict || resp.Imported != 0 || len(resp.Errors) != 1 || resp.Errors[0].Row != 3 {
+		t.Fatalf("Expected the atomic import to clash on row 3, got %d %+v", code, resp)
+	}
+	if n, _ := store.CountBooks(context.Background(), models.BookFilter{}); n != 1 {
+		t.Errorf("Expected nothing imported, got %d books", n)
+	}
+}
+
+func TestBookValidation(t *testing.T) {
+	handler, store := getMemoryHandler(t)
+	// stored before genres were restricted
+	legacy, _ := store.CreateBook(context.Background(), models.Book{Title: "Dune", Author: "Frank Herbert", Genre: "Science fiction"})
+
+	w := httptest.NewRecorder()
+	handler.CreateBook(w, httptest.NewRequest("POST", "/books", strings.NewReader(`{"title":"","author":"Frank Herbert","published_year":99999,"genre":"Gardening"}`)))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422, got %d", w.Code)
+	}
+	var resp models.Problem
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	var fields []string
+	for _, fieldErr := range resp.Errors {
+		fields = append(fields, fieldErr.Field+":"+fieldErr.Code)
+	}
+	if strings.Join(fields, ",") != "title:required,published_year:out_of_range,genre:not_allowed" {
+		t.Errorf("Expected every invalid field to be reported, got %+v", resp)
+	}
+
+	w = httptest.NewRecorder()
+	handler.CreateBook(w, httptest.NewRequest("POST", "/books", strings.NewReader(`{"title":"Emma","author":"Jane Austen","genre":"romance"}`)))
+	var created models.BookResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if w.Code != http.StatusCreated || created.Book.Genre != "Romance" {
+		t.Errorf("Expected the genre to be stored as Romance, got %d %+v", w.Code, created.Book)
+	}
+
+	// a patch is only held to the rules for the fields it changes
+	if w := patchBook(handler, legacy.ID.String(), "application/merge-patch+json", `{"published_year":1965}`); w.Code != http.StatusOK {
+		t.Errorf("Expected the legacy book to be patchable, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// imports report the same rules per row, next to the problems found
+	// reading the file
+	req := httptest.NewRequest("POST", "/books/import?mode=partial", strings.NewReader("title,author,genre,published_year\nBeloved,Toni Morrison,Gardening,19x7\n"))
+	req.Header.Set("Content-Type", "text/csv")
+	w = httptest.NewRecorder()
+	handler.ImportBooks(w, req)
+	var imported models.ImportResponse
+	json.Unmarshal(w.Body.Bytes(), &imported)
+	if len(imported.Errors) != 2 || imported.Errors[0].Field != "published_year" || imported.Errors[1].Code != "not_allowed" {
+		t.Errorf("Expected the year and genre of the row to be reported, got %+v", imported.Errors)
+	}
+}
@@ -0,0 +1,64 @@
+package books
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"digicert-library-app/internal/models"
+)
+
+// defaultCacheControl lets clients keep responses but makes them revalidate
+// every time, which is cheap with the ETags below. Responses depend on the
+// Authorization header, so shared caches must not store them.
+const defaultCacheControl = "private, no-cache"
+
+// listETag derives a weak entity tag for a page of the book list from the
+// stats of the books matching its filter and the query that selected it.
+// The page embeds cursors signed with the cursor secret, so the tag is keyed
+// with it too and changes whenever cursors would.
+func (b *BooksHandler) listETag(r *http.Request, stats models.BookStats) string {
+	mac := hmac.New(sha256.New, b.cursorSecret)
+	fmt.Fprintf(mac, "%s?%s|%d|%d|%s", r.URL.Path, r.URL.Query().Encode(), stats.Count, stats.VersionSum, stats.LastModified.UTC().Format(time.RFC3339Nano))
+	return `W/"` + hex.EncodeToString(mac.Sum(nil)[:16]) + `"`
+}
+
+// setCacheHeaders sets the validators and caching policy of a GET response
+func (b *BooksHandler) setCacheHeaders(w http.ResponseWriter, etag string, lastModified time.Time) {
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Set("Cache-Control", b.cacheControl)
+}
+
+// notModified evaluates the conditional headers of a GET against the current
+// validators. If-None-Match takes precedence over If-Modified-Since, as RFC
+// 9110 requires.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if header := strings.Join(r.Header.Values("If-None-Match"), ","); strings.TrimSpace(header) != "" {
+		for _, tag := range strings.Split(header, ",") {
+			tag = strings.TrimSpace(tag)
+			// weak comparison, W/"x" matches "x"
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	if header := r.Header.Get("If-Modified-Since"); header != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(header)
+		// Last-Modified only has second precision
+		return err == nil && !lastModified.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+func writeNotModified(w http.ResponseWriter) {
+	w.Header().Del("Content-Type")
+	w.WriteHeader(http.StatusNotModified)
+}
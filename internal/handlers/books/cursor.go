@@ -0,0 +1,93 @@
+package books
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"digicert-library-app/internal/database"
+	"digicert-library-app/internal/models"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// cursorPayload is the signed content of an opaque cursor. The sort it was
+// issued for is included so it can't be replayed against another ordering.
+type cursorPayload struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v,omitempty"`
+	ID     string   `json:"id"`
+}
+
+// encodeCursor serializes a cursor as base64url(payload) "." base64url(hmac)
+func (b *BooksHandler) encodeCursor(cursor models.Cursor, sortFields []models.SortField) string {
+	payload := cursorPayload{Sort: formatSort(sortFields), ID: cursor.ID}
+	for _, value := range cursor.Values {
+		payload.Values = append(payload.Values, database.FormatSortValue(value))
+	}
+	data, _ := json.Marshal(payload)
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(b.signCursor(encoded))
+}
+
+// decodeCursor verifies and parses a cursor issued for sortFields
+func (b *BooksHandler) decodeCursor(token string, sortFields []models.SortField) (models.Cursor, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return models.Cursor{}, errInvalidCursor
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, b.signCursor(encoded)) {
+		return models.Cursor{}, errInvalidCursor
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return models.Cursor{}, errInvalidCursor
+	}
+	var payload cursorPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return models.Cursor{}, errInvalidCursor
+	}
+	if payload.Sort != formatSort(sortFields) {
+		return models.Cursor{}, errors.New("cursor was issued for a different sort order")
+	}
+
+	fields := database.CursorFields(sortFields)
+	if len(payload.Values) != len(fields) {
+		return models.Cursor{}, errInvalidCursor
+	}
+	if _, err := uuid.Parse(payload.ID); err != nil {
+		return models.Cursor{}, errInvalidCursor
+	}
+	cursor := models.Cursor{ID: payload.ID}
+	for i, field := range fields {
+		value, err := database.ParseSortValue(field, payload.Values[i])
+		if err != nil {
+			return models.Cursor{}, errInvalidCursor
+		}
+		cursor.Values = append(cursor.Values, value)
+	}
+	return cursor, nil
+}
+
+func (b *BooksHandler) signCursor(encoded string) []byte {
+	mac := hmac.New(sha256.New, b.cursorSecret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+// formatSort renders a parsed sort back into its query string form
+func formatSort(sortFields []models.SortField) string {
+	parts := make([]string, len(sortFields))
+	for i, field := range sortFields {
+		parts[i] = field.Field
+		if field.Desc {
+			parts[i] = "-" + field.Field
+		}
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,81 @@
+package books
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/problem"
+)
+
+// bookETag is the strong entity tag of a book, derived from its version
+func bookETag(book models.Book) string {
+	return `"v` + strconv.Itoa(book.Version) + `"`
+}
+
+// parseETag returns the version of a strong book entity tag. Weak tags never
+// match under the strong comparison If-Match requires.
+func parseETag(tag string) (int, bool) {
+	if !strings.HasPrefix(tag, `"v`) || !strings.HasSuffix(tag, `"`) || len(tag) < 4 {
+		return 0, false
+	}
+	version, err := strconv.Atoi(tag[2 : len(tag)-1])
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// expectedVersion resolves the If-Match header of a write into the version
+// the store must find the book at, 0 meaning any. When the write can't go
+// ahead it writes the error response and returns false.
+func (b *BooksHandler) expectedVersion(ctx context.Context, w http.ResponseWriter, r *http.Request, id string) (int, bool) {
+	header := strings.Join(r.Header.Values("If-Match"), ",")
+	if strings.TrimSpace(header) == "" {
+		if b.requireIfMatch {
+			problem.Write(w, r, problem.PreconditionRequired, "If-Match header is required, send the ETag of the book you are changing")
+			return 0, false
+		}
+		return 0, true
+	}
+
+	var versions []int
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			// any current version, a missing book still fails with 404
+			return 0, true
+		}
+		if version, ok := parseETag(tag); ok {
+			versions = append(versions, version)
+		}
+	}
+	if len(versions) == 1 {
+		return versions[0], true
+	}
+	if len(versions) > 1 {
+		// the store checks a single version, pick the current one if listed
+		book, err := b.store.GetBookByID(ctx, id)
+		if err == sql.ErrNoRows {
+			problem.Write(w, r, problem.BookNotFound, "Book not found")
+			return 0, false
+		}
+		if err != nil {
+			problem.Write(w, r, problem.InternalError, "Error in fetching books from library")
+			return 0, false
+		}
+		if slices.Contains(versions, book.Version) {
+			return book.Version, true
+		}
+	}
+	writePreconditionFailed(w, r)
+	return 0, false
+}
+
+func writePreconditionFailed(w http.ResponseWriter, r *http.Request) {
+	problem.Write(w, r, problem.PreconditionFailed, "Book has been modified, fetch it again and retry with its current ETag")
+}
@@ -0,0 +1,124 @@
+package books
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"digicert-library-app/internal/catalog"
+	"digicert-library-app/internal/database"
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/problem"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// exportBatchSize is the number of books an export holds in memory at once
+const exportBatchSize = 500
+
+const marcXMLContentType = "application/marcxml+xml"
+
+// bookWriter is an export format, CSVWriter or MARCXMLWriter
+type bookWriter interface {
+	WriteHeader() error
+	Write(book models.Book) error
+	Flush() error
+}
+
+// ExportBooks handles GET /books/export?format=csv|marcxml, streaming every
+// book matching the list filters. The catalog is read in keyset pages, so
+// memory use doesn't grow with its size.
+func (b *BooksHandler) ExportBooks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "csv" && format != "marcxml" {
+		problem.Write(w, r, problem.BadRequest, "format must be csv or marcxml")
+		return
+	}
+	filter, err := parseBookFilter(r.URL.Query())
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest, err.Error())
+		return
+	}
+	sortFields, err := parseSort(r.URL.Query().Get("sort"))
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest, err.Error())
+		return
+	}
+
+	q := models.BookQuery{Filter: filter, Sort: sortFields, Limit: exportBatchSize}
+	books, err := b.store.GetBooks(ctx, q)
+	if err != nil {
+		problem.Write(w, r, problem.InternalError, "Failed to fetch books")
+		return
+	}
+
+	var out bookWriter
+	if format == "marcxml" {
+		xmlOut := catalog.NewMARCXMLWriter(w)
+		// the collection is only well formed once closed
+		defer xmlOut.Close()
+		w.Header().Set("Content-Type", marcXMLContentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="books.xml"`)
+		out = xmlOut
+	} else {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="books.csv"`)
+		out = catalog.NewCSVWriter(w)
+	}
+	out.WriteHeader()
+	for {
+		for _, book := range books {
+			out.Write(book)
+		}
+		if err := out.Flush(); err != nil {
+			// the client went away
+			return
+		}
+		if len(books) < exportBatchSize {
+			return
+		}
+		cursor := database.CursorFor(books[len(books)-1], sortFields)
+		q.After = &cursor
+		if books, err = b.store.GetBooks(ctx, q); err != nil {
+			// the status is long sent, a truncated file is all we can signal
+			log.Printf("Export aborted: %v", err)
+			return
+		}
+	}
+}
+
+// GetBookMARCXML handles GET /books/{id}/marcxml, returning a single book as
+// a MARCXML collection of one record
+func (b *BooksHandler) GetBookMARCXML(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id := mux.Vars(r)["id"]
+	if _, err := uuid.Parse(id); err != nil {
+		problem.Write(w, r, problem.InvalidID, "Invalid book ID format")
+		return
+	}
+	book, err := b.store.GetBookByID(ctx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			problem.Write(w, r, problem.BookNotFound, "Book not found")
+			return
+		}
+		problem.Write(w, r, problem.InternalError, "Error in fetching books from library")
+		return
+	}
+	etag := bookETag(book)
+	b.setCacheHeaders(w, etag, book.UpdatedAt)
+	if notModified(r, etag, book.UpdatedAt) {
+		writeNotModified(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", marcXMLContentType)
+	out := catalog.NewMARCXMLWriter(w)
+	out.WriteHeader()
+	out.Write(book)
+	out.Close()
+}
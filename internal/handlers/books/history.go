@@ -0,0 +1,67 @@
+package books
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/problem"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// GetBookHistory handles GET /books/{id}/history, listing the audit entries
+// of a book oldest first. The history of deleted and purged books remains
+// available. Books created before the audit log have an empty history until
+// they change.
+func (b *BooksHandler) GetBookHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx := r.Context()
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+	if _, err := uuid.Parse(id); err != nil {
+		problem.Write(w, r, problem.InvalidID, "Invalid book ID format")
+		return
+	}
+
+	page := 1
+	limit := 10
+	if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = min(l, maxPageLimit)
+	}
+
+	entries, err := b.store.GetAuditLog(ctx, models.AuditQuery{
+		Filter: models.AuditFilter{BookID: id},
+		Limit:  limit,
+		Offset: (page - 1) * limit,
+	})
+	if err != nil {
+		problem.Write(w, r, problem.InternalError, "Error in fetching book history")
+		return
+	}
+	// no history at all is only a 404 when there's no book either
+	if len(entries) == 0 && page == 1 {
+		exists, err := b.store.BookExists(ctx, id)
+		if err != nil {
+			problem.Write(w, r, problem.InternalError, "Error in fetching book history")
+			return
+		}
+		if !exists {
+			problem.Write(w, r, problem.BookNotFound, "Book not found")
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(models.AuditResponse{
+		Data:  entries,
+		Page:  page,
+		Limit: limit,
+	})
+}
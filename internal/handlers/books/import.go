@@ -0,0 +1,230 @@
+package books
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"digicert-library-app/internal/catalog"
+	"digicert-library-app/internal/database"
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/problem"
+	"digicert-library-app/internal/validation"
+)
+
+// maxImportRows caps the number of rows of a single import
+const maxImportRows = 5000
+
+// ImportBooks handles POST /books/import, creating a book per row of a CSV
+// file or per record of a MARC 21 (application/marc) or MARCXML
+// (application/marcxml+xml) file. CSV columns are matched to fields by name,
+// or through the mapping parameter ("Writer:author,Year:published_year").
+// Rows describing a book already in the catalog, or repeating an earlier
+// row, by ISBN or by title and author, are skipped and reported. In atomic
+// mode (the default) nothing is imported when a row is invalid, in partial
+// mode the valid rows are. With dry_run=true the file is only checked.
+func (b *BooksHandler) ImportBooks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx := r.Context()
+	values := r.URL.Query()
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var read func() ([]catalog.Record, error)
+	var format string
+	switch mediaType {
+	case "text/csv":
+		mapping, err := catalog.ParseMapping(values.Get("mapping"))
+		if err != nil {
+			problem.Write(w, r, problem.BadRequest, err.Error())
+			return
+		}
+		read = func() ([]catalog.Record, error) { return catalog.ReadCSV(r.Body, mapping) }
+		format = "CSV"
+	case "application/marc":
+		read = func() ([]catalog.Record, error) { return catalog.ReadMARC(r.Body) }
+		format = "MARC"
+	case marcXMLContentType, "application/xml", "text/xml":
+		read = func() ([]catalog.Record, error) { return catalog.ReadMARCXML(r.Body) }
+		format = "MARCXML"
+	default:
+		problem.Write(w, r, problem.UnsupportedMediaType, "Content-Type must be text/csv, application/marc or application/marcxml+xml")
+		return
+	}
+	mode := values.Get("mode")
+	if mode == "" {
+		mode = models.BatchAtomic
+	}
+	if mode != models.BatchAtomic && mode != models.BatchPartial {
+		problem.Write(w, r, problem.BadRequest, "mode must be atomic or partial")
+		return
+	}
+	dryRun := false
+	if value := values.Get("dry_run"); value != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			problem.Write(w, r, problem.BadRequest, "dry_run must be true or false")
+			return
+		}
+	}
+
+	records, err := read()
+	if err != nil {
+		problem.Write(w, r, problem.InvalidPayload, "Invalid "+format+": "+err.Error())
+		return
+	}
+	if len(records) == 0 || len(records) > maxImportRows {
+		problem.Write(w, r, problem.BadRequest, fmt.Sprintf("An import needs between 1 and %d rows", maxImportRows))
+		return
+	}
+
+	resp := models.ImportResponse{DryRun: dryRun, Rows: len(records)}
+	seen := map[string]int{}
+	var candidates []catalog.Record
+	for _, record := range records {
+		if rowErrors := importErrors(&record); len(rowErrors) > 0 {
+			resp.Errors = append(resp.Errors, rowErrors...)
+			continue
+		}
+		keys := []string{duplicateKey(record.Book)}
+		if record.Book.ISBN != "" {
+			keys = append(keys, record.Book.ISBN)
+		}
+		if row := earlierRow(seen, keys); row != 0 {
+			resp.Duplicates = append(resp.Duplicates, models.ImportDuplicate{Row: record.Line, DuplicateOfRow: row})
+			continue
+		}
+		for _, key := range keys {
+			seen[key] = record.Line
+		}
+		candidates = append(candidates, record)
+	}
+
+	existing, err := b.findDuplicates(ctx, candidates)
+	if err != nil {
+		problem.Write(w, r, problem.InternalError, "Failed to check for duplicates")
+		return
+	}
+	var ops []models.BatchOperation
+	var rows []int
+	for _, record := range candidates {
+		if id := existing(record.Book); id != "" {
+			resp.Duplicates = append(resp.Duplicates, models.ImportDuplicate{Row: record.Line, BookID: id})
+			continue
+		}
+		book := record.Book
+		ops = append(ops, models.BatchOperation{Op: models.BatchCreate, Book: &book})
+		rows = append(rows, record.Line)
+	}
+	slices.SortStableFunc(resp.Duplicates, func(a, b models.ImportDuplicate) int { return a.Row - b.Row })
+
+	atomic := mode == models.BatchAtomic
+	if atomic && len(resp.Errors) > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	if dryRun || len(ops) == 0 {
+		if dryRun {
+			resp.Imported = len(ops)
+		}
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	results, err := b.store.ApplyBatch(ctx, ops, atomic)
+	if err != nil {
+		problem.Write(w, r, problem.InternalError, "Couldn't import books")
+		return
+	}
+	for i, result := range results {
+		switch {
+		case result.Err == nil:
+			resp.Imported++
+			resp.Books = append(resp.Books, result.Book)
+		case errors.Is(result.Err, database.ErrBatchAborted):
+		case errors.Is(result.Err, database.ErrDuplicateISBN):
+			// a book in the trash still holds its ISBN
+			resp.Errors = append(resp.Errors, models.ImportError{Row: rows[i], Field: "isbn", Error: duplicateISBNMessage})
+		case atomic:
+			problem.Write(w, r, problem.InternalError, "Couldn't import books")
+			return
+		default:
+			resp.Errors = append(resp.Errors, models.ImportError{Row: rows[i], Error: "Couldn't create book"})
+		}
+	}
+	if atomic && len(resp.Errors) > 0 {
+		w.WriteHeader(http.StatusConflict)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// importErrors returns the problems of a record: those found reading it and
+// the rules its book breaks, a field being reported once. The valid fields
+// of the book are normalized as for the other write endpoints.
+func importErrors(record *catalog.Record) []models.ImportError {
+	var rowErrors []models.ImportError
+	reported := map[string]bool{}
+	for _, fieldErr := range record.Errors {
+		rowErrors = append(rowErrors, models.ImportError{Row: record.Line, Field: fieldErr.Field, Error: fieldErr.Message})
+		reported[fieldErr.Field] = true
+	}
+	for _, fieldErr := range validation.Book(&record.Book) {
+		if !reported[fieldErr.Field] {
+			rowErrors = append(rowErrors, models.ImportError{Row: record.Line, Field: fieldErr.Field, Code: fieldErr.Code, Error: fieldErr.Message})
+		}
+	}
+	return rowErrors
+}
+
+// duplicateKey identifies a book by its title and author, ignoring case and
+// surrounding space
+func duplicateKey(book models.Book) string {
+	return strings.ToLower(strings.TrimSpace(book.Title)) + "\x00" + strings.ToLower(strings.TrimSpace(book.Author))
+}
+
+// earlierRow returns the row an earlier record with any of keys came from,
+// or 0
+func earlierRow(seen map[string]int, keys []string) int {
+	for _, key := range keys {
+		if row, ok := seen[key]; ok {
+			return row
+		}
+	}
+	return 0
+}
+
+// findDuplicates looks up the live books the records describe, by ISBN or
+// by title and author, in one query per few hundred records. The returned
+// function gives the id of the book duplicating a book, or "".
+func (b *BooksHandler) findDuplicates(ctx context.Context, records []catalog.Record) (func(models.Book) string, error) {
+	books := make([]models.Book, len(records))
+	for i, record := range records {
+		books[i] = record.Book
+	}
+	found, err := b.store.FindDuplicates(ctx, books)
+	if err != nil {
+		return nil, err
+	}
+	byISBN, byKey := map[string]string{}, map[string]string{}
+	for _, book := range found {
+		if book.ISBN != "" {
+			byISBN[book.ISBN] = book.ID.String()
+		}
+		if _, ok := byKey[duplicateKey(book)]; !ok {
+			byKey[duplicateKey(book)] = book.ID.String()
+		}
+	}
+	return func(book models.Book) string {
+		if id, ok := byISBN[book.ISBN]; ok && book.ISBN != "" {
+			return id
+		}
+		return byKey[duplicateKey(book)]
+	}, nil
+}
@@ -0,0 +1,51 @@
+package books
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"digicert-library-app/internal/catalog"
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/problem"
+
+	"github.com/gorilla/mux"
+)
+
+// duplicateISBNMessage answers writes clashing with the ISBN of another book
+const duplicateISBNMessage = "A book with this ISBN already exists"
+
+// GetBookByISBN handles GET /books/isbn/{isbn}. The ISBN may be given in its
+// ISBN-10 or ISBN-13 form, with or without hyphens.
+func (b *BooksHandler) GetBookByISBN(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx := r.Context()
+
+	isbn, err := catalog.NormalizeISBN(mux.Vars(r)["isbn"])
+	if err != nil {
+		problem.Write(w, r, problem.InvalidISBN, err.Error())
+		return
+	}
+
+	book, err := b.store.GetBookByISBN(ctx, isbn)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			problem.Write(w, r, problem.BookNotFound, "Book not found")
+			return
+		}
+		problem.Write(w, r, problem.InternalError, "Error in fetching books from library")
+		return
+	}
+	etag := bookETag(book)
+	b.setCacheHeaders(w, etag, book.UpdatedAt)
+	if notModified(r, etag, book.UpdatedAt) {
+		writeNotModified(w)
+		return
+	}
+	json.NewEncoder(w).Encode(models.BookResponse{Book: book})
+}
+
+func writeDuplicateISBN(w http.ResponseWriter, r *http.Request) {
+	problem.Write(w, r, problem.DuplicateISBN, duplicateISBNMessage)
+}
@@ -0,0 +1,46 @@
+package books
+
+import (
+	"crypto/rand"
+	"log"
+)
+
+// Option customizes a BooksHandler
+type Option func(*BooksHandler)
+
+// WithCursorSecret sets the key used to sign pagination cursors. Instances
+// behind the same load balancer must share it for cursors to stay valid.
+func WithCursorSecret(secret []byte) Option {
+	return func(b *BooksHandler) {
+		b.cursorSecret = secret
+	}
+}
+
+// WithRequireIfMatch makes PUT, PATCH and DELETE fail with 428 Precondition
+// Required unless they carry an If-Match header, so clients can't overwrite
+// changes they haven't seen
+func WithRequireIfMatch(require bool) Option {
+	return func(b *BooksHandler) {
+		b.requireIfMatch = require
+	}
+}
+
+// WithCacheControl sets the Cache-Control header of book reads, instead of
+// revalidating on every use. For example "private, max-age=30" lets kiosks
+// skip the request entirely for 30 seconds.
+func WithCacheControl(value string) Option {
+	return func(b *BooksHandler) {
+		b.cacheControl = value
+	}
+}
+
+// randomSecret generates a per-process cursor signing key, used when none is
+// configured
+func randomSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatalf("failed to generate cursor secret: %v", err)
+	}
+	log.Println("No cursor secret configured, cursors will not survive a restart")
+	return secret
+}
@@ -0,0 +1,245 @@
+package books
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"digicert-library-app/internal/database"
+	"digicert-library-app/internal/jsonpatch"
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/problem"
+	"digicert-library-app/internal/validation"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// acceptPatch lists the patch formats PatchBook understands
+const acceptPatch = jsonpatch.MergePatchType + ", " + jsonpatch.JSONPatchType
+
+// readOnlyFields are book document fields a patch may not change
+var readOnlyFields = []string{"id", "created_at", "updated_at", "version"}
+
+// PatchBook handles PATCH /books/{id}, applying a JSON Merge Patch or a JSON
+// Patch to the book and storing only the fields that changed
+func (b *BooksHandler) PatchBook(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx := r.Context()
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+	if _, err := uuid.Parse(id); err != nil {
+		problem.Write(w, r, problem.InvalidID, "Invalid book ID format")
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != jsonpatch.MergePatchType && mediaType != jsonpatch.JSONPatchType {
+		w.Header().Set("Accept-Patch", acceptPatch)
+		problem.Write(w, r, problem.UnsupportedMediaType, "Content-Type must be one of "+acceptPatch)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidPayload, "Invalid request payload")
+		return
+	}
+
+	// parse the patch before loading the book, malformed patches are the
+	// client's fault whatever the book looks like
+	var apply func(doc interface{}) (interface{}, error)
+	if mediaType == jsonpatch.MergePatchType {
+		patch, err := jsonpatch.Decode(body)
+		if err != nil {
+			problem.Write(w, r, problem.InvalidPayload, "Invalid request payload")
+			return
+		}
+		apply = func(doc interface{}) (interface{}, error) {
+			return jsonpatch.MergePatch(doc, patch), nil
+		}
+	} else {
+		patch, err := jsonpatch.ParsePatch(body)
+		if err != nil {
+			problem.Write(w, r, problem.InvalidPayload, "Invalid JSON Patch: "+err.Error())
+			return
+		}
+		apply = patch.Apply
+	}
+
+	version, ok := b.expectedVersion(ctx, w, r, id)
+	if !ok {
+		return
+	}
+
+	book, err := b.store.GetBookByID(ctx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			problem.Write(w, r, problem.BookNotFound, "Book not found")
+			return
+		}
+		problem.Write(w, r, problem.InternalError, "Error in fetching books from library")
+		return
+	}
+
+	if version != 0 && book.Version != version {
+		writePreconditionFailed(w, r)
+		return
+	}
+
+	doc := bookDocument(book)
+	patched, err := apply(doc)
+	if err != nil {
+		// the patch is well formed but doesn't fit the book's current state
+		problem.Write(w, r, problem.PatchFailed, "Couldn't apply patch: "+err.Error())
+		return
+	}
+	updated, err := patchedBook(book, doc, patched)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidPayload, err.Error())
+		return
+	}
+	// only the fields the patch changes are checked
+	fields := changedFields(book, updated)
+	if invalid := changedFieldErrors(validation.Book(&updated), book, updated); invalid != nil {
+		writeValidationErrors(w, r, invalid)
+		return
+	}
+
+	// the patch was computed against this version of the book, a write
+	// landing in between must not be silently overwritten
+	book, err = b.store.PatchBook(ctx, id, fields, book.Version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			problem.Write(w, r, problem.BookNotFound, "Book not found")
+			return
+		}
+		if err == database.ErrVersionMismatch {
+			if version != 0 {
+				writePreconditionFailed(w, r)
+				return
+			}
+			problem.Write(w, r, problem.EditConflict, "Book was modified while applying the patch, retry")
+			return
+		}
+		if err == database.ErrDuplicateISBN {
+			writeDuplicateISBN(w, r)
+			return
+		}
+		problem.Write(w, r, problem.InternalError, "Failed to update book")
+		return
+	}
+	w.Header().Set("ETag", bookETag(book))
+	json.NewEncoder(w).Encode(models.BookResponse{Book: book})
+}
+
+// bookDocument renders a book as the JSON document patches apply to. Unlike
+// the API response every field is present, with null for an unset year,
+// genre or ISBN, so JSON Patch paths to them always resolve.
+func bookDocument(book models.Book) map[string]interface{} {
+	doc := map[string]interface{}{
+		"id":             book.ID.String(),
+		"title":          book.Title,
+		"author":         book.Author,
+		"published_year": nil,
+		"genre":          nil,
+		"isbn":           nil,
+		"created_at":     book.CreatedAt.Format(time.RFC3339Nano),
+		"updated_at":     book.UpdatedAt.Format(time.RFC3339Nano),
+		"version":        json.Number(strconv.Itoa(book.Version)),
+	}
+	if book.PublishedYear != 0 {
+		doc["published_year"] = json.Number(strconv.Itoa(book.PublishedYear))
+	}
+	if book.Genre != "" {
+		doc["genre"] = book.Genre
+	}
+	if book.ISBN != "" {
+		doc["isbn"] = book.ISBN
+	}
+	return doc
+}
+
+// patchedBook reads a patched book document back into the book it was
+// rendered from, checking its shape and the types of its fields. A removed
+// or null year, genre or ISBN clears it.
+func patchedBook(book models.Book, original map[string]interface{}, patched interface{}) (models.Book, error) {
+	doc, ok := patched.(map[string]interface{})
+	if !ok {
+		return book, errors.New("patched book must be a JSON object")
+	}
+	for field := range doc {
+		if _, ok := original[field]; !ok {
+			return book, fmt.Errorf("unknown field %q", field)
+		}
+	}
+	for _, field := range readOnlyFields {
+		if !jsonpatch.Equal(original[field], doc[field]) {
+			return book, fmt.Errorf("%s is read-only", field)
+		}
+	}
+
+	text := func(field string) (string, error) {
+		value := doc[field]
+		if value == nil {
+			return "", nil
+		}
+		s, ok := value.(string)
+		if !ok {
+			return "", fmt.Errorf("%s must be a string", field)
+		}
+		return s, nil
+	}
+	var err error
+	if book.Title, err = text("title"); err != nil {
+		return book, err
+	}
+	if book.Author, err = text("author"); err != nil {
+		return book, err
+	}
+	if book.Genre, err = text("genre"); err != nil {
+		return book, err
+	}
+	if book.ISBN, err = text("isbn"); err != nil {
+		return book, err
+	}
+	book.PublishedYear = 0
+	if value := doc["published_year"]; value != nil {
+		n, ok := value.(json.Number)
+		year, err := strconv.Atoi(string(n))
+		if !ok || err != nil {
+			return book, errors.New("published_year must be an integer")
+		}
+		book.PublishedYear = year
+	}
+	return book, nil
+}
+
+// changedFields returns the column values of the fields that differ between
+// two states of a book
+func changedFields(before, after models.Book) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if after.Title != before.Title {
+		fields["title"] = after.Title
+	}
+	if after.Author != before.Author {
+		fields["author"] = after.Author
+	}
+	if after.PublishedYear != before.PublishedYear {
+		fields["published_year"] = after.PublishedYear
+	}
+	if after.Genre != before.Genre {
+		fields["genre"] = after.Genre
+	}
+	if after.ISBN != before.ISBN {
+		fields["isbn"] = after.ISBN
+	}
+	return fields
+}
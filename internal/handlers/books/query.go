@@ -0,0 +1,144 @@
+package books
+
+import (
+	"digicert-library-app/internal/database"
+	"digicert-library-app/internal/models"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPageLimit caps the page size a client can request
+const maxPageLimit = 100
+
+// buildPageLinks returns the first/prev/next/last links for a page, keeping
+// every other query parameter of the current request
+func buildPageLinks(current *url.URL, page, limit, totalPages int) *models.PageLinks {
+	pageURL := func(p int) string {
+		values := current.Query()
+		values.Set("page", strconv.Itoa(p))
+		values.Set("limit", strconv.Itoa(limit))
+		return (&url.URL{Path: current.Path, RawQuery: values.Encode()}).String()
+	}
+
+	lastPage := max(totalPages, 1)
+	links := &models.PageLinks{
+		First: pageURL(1),
+		Last:  pageURL(lastPage),
+	}
+	if page > 1 {
+		links.Prev = pageURL(min(page-1, lastPage))
+	}
+	if page < totalPages {
+		links.Next = pageURL(page + 1)
+	}
+	return links
+}
+
+// buildCursorLinks returns the links for a cursor paginated page. Keyset
+// pagination can only move forward, so there is no prev or last link.
+func buildCursorLinks(current *url.URL, limit int, nextCursor string) *models.PageLinks {
+	cursorURL := func(cursor string) string {
+		values := current.Query()
+		values.Del("page")
+		values.Del("cursor")
+		if cursor != "" {
+			values.Set("cursor", cursor)
+		}
+		values.Set("limit", strconv.Itoa(limit))
+		return (&url.URL{Path: current.Path, RawQuery: values.Encode()}).String()
+	}
+
+	links := &models.PageLinks{First: cursorURL("")}
+	if nextCursor != "" {
+		links.Next = cursorURL(nextCursor)
+	}
+	return links
+}
+
+// parseBookFilter reads the list filters from the query string. Timestamps
+// must be RFC 3339.
+func parseBookFilter(values url.Values) (models.BookFilter, error) {
+	filter := models.BookFilter{
+		Author: strings.TrimSpace(values.Get("author")),
+		Genre:  strings.TrimSpace(values.Get("genre")),
+		Title:  strings.TrimSpace(values.Get("title")),
+	}
+
+	yearParams := []struct {
+		name   string
+		target *int
+	}{
+		{"published_year_min", &filter.YearMin},
+		{"published_year_max", &filter.YearMax},
+	}
+	for _, param := range yearParams {
+		value := values.Get(param.name)
+		if value == "" {
+			continue
+		}
+		year, err := strconv.Atoi(value)
+		if err != nil || year <= 0 {
+			return filter, fmt.Errorf("%s must be a positive year", param.name)
+		}
+		*param.target = year
+	}
+	// published_year is shorthand for an exact year
+	if value := values.Get("published_year"); value != "" {
+		year, err := strconv.Atoi(value)
+		if err != nil || year <= 0 {
+			return filter, fmt.Errorf("published_year must be a positive year")
+		}
+		filter.YearMin, filter.YearMax = year, year
+	}
+	if filter.YearMin != 0 && filter.YearMax != 0 && filter.YearMin > filter.YearMax {
+		return filter, fmt.Errorf("published_year_min must not be greater than published_year_max")
+	}
+
+	timeParams := []struct {
+		name   string
+		target *time.Time
+	}{
+		{"created_since", &filter.CreatedSince},
+		{"created_before", &filter.CreatedBefore},
+		{"updated_since", &filter.UpdatedSince},
+		{"updated_before", &filter.UpdatedBefore},
+	}
+	for _, param := range timeParams {
+		value := values.Get(param.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, fmt.Errorf("%s must be an RFC 3339 timestamp", param.name)
+		}
+		*param.target = t
+	}
+	return filter, nil
+}
+
+// parseSort parses a comma separated sort list such as "title,-published_year",
+// where a leading "-" sorts descending
+func parseSort(value string) ([]models.SortField, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var fields []models.SortField
+	seen := map[string]bool{}
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		field := models.SortField{Field: strings.TrimPrefix(part, "-"), Desc: strings.HasPrefix(part, "-")}
+		if !database.IsSortableField(field.Field) {
+			return nil, fmt.Errorf("cannot sort by %q, sortable fields are %s", field.Field, strings.Join(database.SortableFields(), ", "))
+		}
+		if seen[field.Field] {
+			return nil, fmt.Errorf("sort field %q is repeated", field.Field)
+		}
+		seen[field.Field] = true
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
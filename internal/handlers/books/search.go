@@ -0,0 +1,64 @@
+package books
+
+import (
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/problem"
+	"digicert-library-app/internal/search"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// snippetLength is the maximum length, in characters, of a highlight snippet
+const snippetLength = 120
+
+// SearchBooks handles GET /books/search?q=... with relevance ranked results.
+// Quoted text matches a phrase and a trailing * matches a word prefix.
+func (b *BooksHandler) SearchBooks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx := r.Context()
+
+	raw := r.URL.Query().Get("q")
+	q, err := search.Parse(raw)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest, "Query parameter q must contain at least one word")
+		return
+	}
+
+	page := 1
+	limit := 10
+	if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = min(l, maxPageLimit)
+	}
+
+	results, err := b.store.SearchBooks(ctx, q, limit, (page-1)*limit)
+	if err != nil {
+		problem.Write(w, r, problem.InternalError, "Failed to search books")
+		return
+	}
+	for i := range results {
+		results[i].Highlights = highlightBook(q, results[i].Book)
+	}
+
+	json.NewEncoder(w).Encode(models.SearchResponse{
+		Data:  results,
+		Query: raw,
+		Page:  page,
+		Limit: limit,
+	})
+}
+
+// highlightBook returns the highlighted snippets of the fields matching q
+func highlightBook(q search.Query, book models.Book) map[string]string {
+	highlights := map[string]string{}
+	for field, value := range map[string]string{"title": book.Title, "author": book.Author, "genre": book.Genre} {
+		if snippet := q.Highlight(value, snippetLength); snippet != "" {
+			highlights[field] = snippet
+		}
+	}
+	return highlights
+}
@@ -0,0 +1,45 @@
+package books
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/problem"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// GetTrash handles GET /books/trash, listing deleted books that haven't been
+// purged yet. It takes the same parameters as GetBooks.
+func (b *BooksHandler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	b.listBooks(w, r, true)
+}
+
+// RestoreBook handles POST /books/{id}/restore, taking a book out of the trash
+func (b *BooksHandler) RestoreBook(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx := r.Context()
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+	if _, err := uuid.Parse(id); err != nil {
+		problem.Write(w, r, problem.InvalidID, "Invalid book ID format")
+		return
+	}
+
+	book, err := b.store.RestoreBook(ctx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			problem.Write(w, r, problem.BookNotFound, "Book not found in trash")
+			return
+		}
+		problem.Write(w, r, problem.InternalError, "Failed to restore book")
+		return
+	}
+	w.Header().Set("ETag", bookETag(book))
+	json.NewEncoder(w).Encode(models.BookResponse{Book: book})
+}
@@ -0,0 +1,32 @@
+package books
+
+import (
+	"net/http"
+
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/problem"
+	"digicert-library-app/internal/validation"
+)
+
+// validationFailed is the detail of a problem listing invalid fields
+const validationFailed = "Validation failed"
+
+// writeValidationErrors answers a request whose book breaks the rules
+// declared on models.Book with a 422 listing every invalid field
+func writeValidationErrors(w http.ResponseWriter, r *http.Request, errs validation.Errors) {
+	problem.WriteErrors(w, r, problem.ValidationFailed, validationFailed, errs)
+}
+
+// changedFieldErrors keeps the errors of the fields book changes from current,
+// so books stored before a rule existed, such as one filed under a genre
+// that's no longer allowed, can still be edited
+func changedFieldErrors(errs validation.Errors, current, book models.Book) validation.Errors {
+	fields := changedFields(current, book)
+	var invalid validation.Errors
+	for _, fieldErr := range errs {
+		if _, ok := fields[fieldErr.Field]; ok {
+			invalid = append(invalid, fieldErr)
+		}
+	}
+	return invalid
+}
@@ -0,0 +1,140 @@
+// Package login serves the OpenID Connect login of staff, who get a session
+// cookie the auth middleware accepts in place of a token.
+package login
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"digicert-library-app/internal/auth"
+	"digicert-library-app/internal/problem"
+)
+
+type LoginHandler struct {
+	oidc          *auth.OIDC
+	sessions      *auth.Sessions
+	secureCookies bool
+}
+
+// Option customizes a LoginHandler
+type Option func(*LoginHandler)
+
+// WithSecureCookies sets the Secure attribute of the cookies, on by default.
+// Turn it off only to log in over plain HTTP during development.
+func WithSecureCookies(secure bool) Option {
+	return func(l *LoginHandler) {
+		l.secureCookies = secure
+	}
+}
+
+func InitLoginHandler(ctx context.Context, oidc *auth.OIDC, sessions *auth.Sessions, opts ...Option) *LoginHandler {
+	l := &LoginHandler{oidc: oidc, sessions: sessions, secureCookies: true}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Login handles GET /auth/login, sending the browser to the identity
+// provider. The optional next parameter is the local path to return to once
+// logged in.
+func (l *LoginHandler) Login(w http.ResponseWriter, r *http.Request) {
+	next := r.URL.Query().Get("next")
+	if !isLocalPath(next) {
+		next = "/"
+	}
+	st, err := auth.NewLoginState(next)
+	if err != nil {
+		problem.Write(w, r, problem.InternalError, "Couldn't start the login")
+		return
+	}
+	value, err := l.sessions.IssueLoginState(st)
+	if err != nil {
+		problem.Write(w, r, problem.InternalError, "Couldn't start the login")
+		return
+	}
+	http.SetCookie(w, l.cookie(auth.LoginCookie, "/auth", value, int(auth.LoginTimeout.Seconds())))
+	http.Redirect(w, r, l.oidc.AuthCodeURL(st), http.StatusFound)
+}
+
+// Callback handles GET /auth/callback, where the identity provider returns
+// the browser with a code. The code is exchanged for an ID token, and the
+// staff member gets a session holding the roles of their groups.
+func (l *LoginHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	// the login state is good for one attempt
+	http.SetCookie(w, l.cookie(auth.LoginCookie, "/auth", "", -1))
+
+	cookie, err := r.Cookie(auth.LoginCookie)
+	if err != nil {
+		problem.Write(w, r, problem.LoginFailed, "No login in progress, start again")
+		return
+	}
+	st, err := l.sessions.VerifyLoginState(cookie.Value)
+	if err != nil {
+		problem.Write(w, r, problem.LoginFailed, "The login timed out, start again")
+		return
+	}
+	query := r.URL.Query()
+	if query.Get("state") != st.State {
+		problem.Write(w, r, problem.LoginFailed, "The login state doesn't match, start again")
+		return
+	}
+	if reason := query.Get("error"); reason != "" {
+		problem.Write(w, r, problem.LoginFailed, "The identity provider refused the login: "+reason)
+		return
+	}
+
+	identity, err := l.oidc.Exchange(r.Context(), query.Get("code"), st)
+	if errors.Is(err, auth.ErrNoRole) {
+		problem.Write(w, r, problem.Forbidden, "None of your groups grants a role in the library")
+		return
+	}
+	if err != nil {
+		log.Printf("Login failed: %v", err)
+		problem.Write(w, r, problem.LoginFailed, "Couldn't verify the login with the identity provider")
+		return
+	}
+	session, err := l.sessions.Issue(identity.Subject, identity.Roles)
+	if err != nil {
+		problem.Write(w, r, problem.InternalError, "Couldn't start the session")
+		return
+	}
+	http.SetCookie(w, l.cookie(auth.SessionCookie, "/", session, int(l.sessions.TTL().Seconds())))
+	http.Redirect(w, r, st.Next, http.StatusFound)
+}
+
+// Logout handles POST /auth/logout, removing the session cookie. Sessions
+// aren't stored, a copy of the cookie stays valid until it expires.
+func (l *LoginHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, l.cookie(auth.SessionCookie, "/", "", -1))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// cookie returns a cookie scripts can't read, sent on top level navigations
+// from other sites, as the return from the identity provider is, but not on
+// their other requests. A negative maxAge deletes it.
+func (l *LoginHandler) cookie(name, path, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   l.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// isLocalPath reports whether next is a path of this server, so a login
+// link can't send the browser to another site
+func isLocalPath(next string) bool {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.Contains(next, `\`) {
+		return false
+	}
+	u, err := url.Parse(next)
+	return err == nil && u.Scheme == "" && u.Host == ""
+}
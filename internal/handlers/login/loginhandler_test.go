@@ -0,0 +1,350 @@
+package login
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"digicert-library-app/internal/auth"
+	"digicert-library-app/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID     = "library"
+	testClientSecret = "client-secret"
+	testRedirectURL  = "https://library.example.com/auth/callback"
+	testSessionKey   = "0123456789abcdef0123456789abcdef"
+)
+
+// fakeProvider is an in-process OpenID Connect provider. Its authorization
+// endpoint logs in the staff member set on it at once, and its token
+// endpoint checks the PKCE verifier of the code.
+type fakeProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu sync.Mutex
+	// subject and groups of the next login
+	subject string
+	groups  interface{}
+	// nonce, when set, replaces the nonce of the ID tokens
+	nonce string
+	// signingKey, when set, signs the ID tokens instead of the published key
+	signingKey *rsa.PrivateKey
+	codes      map[string]url.Values
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProvider{key: key, subject: "alice", groups: []string{"library-staff"}, codes: map[string]url.Values{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/jwks", p.jwks)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *fakeProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                p.URL,
+		"authorization_endpoint":                p.URL + "/authorize",
+		"token_endpoint":                        p.URL + "/token",
+		"jwks_uri":                              p.URL + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (p *fakeProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA", "kid": "test", "alg": "RS256", "use": "sig",
+		"n": b64(p.key.N.Bytes()), "e": b64(big.NewInt(int64(p.key.E)).Bytes()),
+	}}})
+}
+
+func (p *fakeProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != testClientID || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	p.mu.Lock()
+	code := rand.Text()
+	p.codes[code] = q
+	p.mu.Unlock()
+	http.Redirect(w, r, q.Get("redirect_uri")+"?"+url.Values{"code": {code}, "state": {q.Get("state")}}.Encode(), http.StatusFound)
+}
+
+func (p *fakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	authorization, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	clientID, secret, _ := r.BasicAuth()
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || clientID != testClientID || secret != testClientSecret ||
+		base64.RawURLEncoding.EncodeToString(challenge[:]) != authorization.Get("code_challenge") ||
+		r.PostForm.Get("redirect_uri") != authorization.Get("redirect_uri") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	nonce := authorization.Get("nonce")
+	if p.nonce != "" {
+		nonce = p.nonce
+	}
+	key := p.key
+	if p.signingKey != nil {
+		key = p.signingKey
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": p.URL, "aud": testClientID, "sub": p.subject, "nonce": nonce, "groups": p.groups,
+		"iat": time.Now().Unix(), "exp": time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = "test"
+	idToken, _ := token.SignedString(key)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access", "token_type": "Bearer", "expires_in": 3600, "id_token": idToken,
+	})
+}
+
+func newTestHandler(t *testing.T, provider *fakeProvider) (*LoginHandler, *auth.Sessions) {
+	t.Helper()
+	client, err := auth.NewOIDC(context.Background(), auth.OIDCConfig{
+		IssuerURL:    provider.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+		GroupRoles:   map[string]auth.Role{"library-staff": auth.RoleLibrarian, "it-admins": auth.RoleAdmin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := auth.NewSessions([]byte(testSessionKey), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return InitLoginHandler(context.Background(), client, sessions), sessions
+}
+
+// login goes through the login flow, from the login link to the answer of
+// the callback
+func login(t *testing.T, handler *LoginHandler, next string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler.Login(w, httptest.NewRequest("GET", "/auth/login?next="+url.QueryEscape(next), nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected a redirect to the identity provider, got %d: %s", w.Code, w.Body)
+	}
+	loginCookie := cookie(w, auth.LoginCookie)
+	if loginCookie == nil || !loginCookie.HttpOnly || !loginCookie.Secure {
+		t.Fatalf("Expected a secure login cookie, got %+v", loginCookie)
+	}
+
+	// the browser logs in at the identity provider, which sends it back
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback := resp.Header.Get("Location")
+	if !strings.HasPrefix(callback, testRedirectURL+"?") {
+		t.Fatalf("Expected a redirect to the callback, got %d %q", resp.StatusCode, callback)
+	}
+
+	req := httptest.NewRequest("GET", callback, nil)
+	req.AddCookie(loginCookie)
+	w = httptest.NewRecorder()
+	handler.Callback(w, req)
+	return w
+}
+
+func cookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func problemCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var p models.Problem
+	json.Unmarshal(w.Body.Bytes(), &p)
+	return p.Code
+}
+
+func TestLogin(t *testing.T) {
+	provider := newFakeProvider(t)
+	handler, sessions := newTestHandler(t, provider)
+
+	w := login(t, handler, "/books?limit=5")
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/books?limit=5" {
+		t.Fatalf("Expected a redirect to the next page, got %d %q: %s", w.Code, w.Header().Get("Location"), w.Body)
+	}
+	session := cookie(w, auth.SessionCookie)
+	if session == nil || !session.HttpOnly || !session.Secure || session.SameSite != http.SameSiteLaxMode || session.MaxAge != 3600 {
+		t.Fatalf("Expected a secure session cookie, got %+v", session)
+	}
+	if c := cookie(w, auth.LoginCookie); c == nil || c.MaxAge >= 0 {
+		t.Errorf("Expected the login cookie to be deleted, got %+v", c)
+	}
+
+	principal, err := auth.NewAuthenticator(nil, nil, auth.WithSessions(sessions)).AuthenticateSession(session.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.Subject != "alice" || !principal.HasRole(auth.RoleLibrarian) || principal.HasRole(auth.RoleAdmin) {
+		t.Errorf("Expected alice as a librarian, got %+v", principal)
+	}
+}
+
+func TestLogin_Groups(t *testing.T) {
+	provider := newFakeProvider(t)
+	handler, sessions := newTestHandler(t, provider)
+
+	tests := []struct {
+		name   string
+		groups interface{}
+		roles  []string
+	}{
+		{"several groups", []string{"everyone", "library-staff", "it-admins"}, []string{"librarian", "admin"}},
+		{"a single group", "it-admins", []string{"admin"}},
+		{"no mapped group", []string{"everyone"}, nil},
+		{"no groups", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider.groups = tt.groups
+			w := login(t, handler, "/")
+			if tt.roles == nil {
+				if w.Code != http.StatusForbidden || problemCode(t, w) != "forbidden" || cookie(w, auth.SessionCookie) != nil {
+					t.Fatalf("Expected a forbidden problem, got %d: %s", w.Code, w.Body)
+				}
+				return
+			}
+			session := cookie(w, auth.SessionCookie)
+			if session == nil {
+				t.Fatalf("Expected a session, got %d: %s", w.Code, w.Body)
+			}
+			claims, err := sessions.Verify(session.Value)
+			if err != nil || !slices.Equal(claims.Roles, tt.roles) {
+				t.Errorf("Expected the roles %v, got %+v (err: %v)", tt.roles, claims, err)
+			}
+		})
+	}
+}
+
+func TestLogin_Failures(t *testing.T) {
+	provider := newFakeProvider(t)
+	handler, _ := newTestHandler(t, provider)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		setup func(p *fakeProvider)
+	}{
+		{"ID token of another login", func(p *fakeProvider) { p.nonce = "another-nonce" }},
+		{"ID token signed with an unknown key", func(p *fakeProvider) { p.signingKey = otherKey }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider.nonce, provider.signingKey = "", nil
+			tt.setup(provider)
+			w := login(t, handler, "/")
+			if w.Code != http.StatusUnauthorized || problemCode(t, w) != "login_failed" || cookie(w, auth.SessionCookie) != nil {
+				t.Errorf("Expected a login_failed problem, got %d: %s", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestCallback_InvalidState(t *testing.T) {
+	provider := newFakeProvider(t)
+	handler, sessions := newTestHandler(t, provider)
+	st, _ := auth.NewLoginState("/")
+	value, _ := sessions.IssueLoginState(st)
+	otherSessions, _ := auth.NewSessions([]byte(strings.Repeat("x", 32)), time.Hour)
+	forged, _ := otherSessions.IssueLoginState(st)
+
+	tests := []struct {
+		name, query, cookie string
+	}{
+		{"no login cookie", "?code=abc&state=" + st.State, ""},
+		{"forged login cookie", "?code=abc&state=" + st.State, forged},
+		{"another state", "?code=abc&state=other", value},
+		{"refused", "?error=access_denied&state=" + st.State, value},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/auth/callback"+tt.query, nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: auth.LoginCookie, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			handler.Callback(w, req)
+			if w.Code != http.StatusUnauthorized || problemCode(t, w) != "login_failed" {
+				t.Errorf("Expected a login_failed problem, got %d: %s", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestLogin_Next(t *testing.T) {
+	handler, sessions := newTestHandler(t, newFakeProvider(t))
+
+	for next, want := range map[string]string{
+		"":                      "/",
+		"/books/trash":          "/books/trash",
+		"https://evil.example/": "/",
+		"//evil.example/":       "/",
+		`/\evil.example/`:       "/",
+		"books":                 "/",
+	} {
+		w := httptest.NewRecorder()
+		handler.Login(w, httptest.NewRequest("GET", "/auth/login?next="+url.QueryEscape(next), nil))
+		st, err := sessions.VerifyLoginState(cookie(w, auth.LoginCookie).Value)
+		if err != nil || st.Next != want {
+			t.Errorf("%q: expected to return to %q, got %q (err: %v)", next, want, st.Next, err)
+		}
+	}
+}
+
+func TestLogout(t *testing.T) {
+	handler, _ := newTestHandler(t, newFakeProvider(t))
+	w := httptest.NewRecorder()
+	handler.Logout(w, httptest.NewRequest("POST", "/auth/logout", nil))
+	if c := cookie(w, auth.SessionCookie); w.Code != http.StatusNoContent || c == nil || c.MaxAge >= 0 {
+		t.Errorf("Expected the session cookie to be deleted, got %d %+v", w.Code, c)
+	}
+}
@@ -0,0 +1,154 @@
+package jsonpatch
+
+import (
+	"errors"
+	"testing"
+)
+
+func mustDecode(t *testing.T, s string) interface{} {
+	t.Helper()
+	v, err := Decode([]byte(s))
+	if err != nil {
+		t.Fatalf("failed to decode %s: %v", s, err)
+	}
+	return v
+}
+
+func TestMergePatch(t *testing.T) {
+	// examples from RFC 7396 appendix A
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		target := mustDecode(t, tt.target)
+		got := MergePatch(target, mustDecode(t, tt.patch))
+		if !Equal(got, mustDecode(t, tt.want)) {
+			t.Errorf("MergePatch(%s, %s) = %v, want %s", tt.target, tt.patch, got, tt.want)
+		}
+		if !Equal(target, mustDecode(t, tt.target)) {
+			t.Errorf("MergePatch modified its target %s", tt.target)
+		}
+	}
+}
+
+func TestPatchApply(t *testing.T) {
+	// examples from RFC 6902 appendix A
+	tests := []struct {
+		name, doc, patch, want string
+	}{
+		{"add member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{"add array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{"remove member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{"remove array element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{"replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{"move member", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{"move array element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{"test", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`},
+		{"add nested member", `{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"foo":"bar","child":{"grandchild":{}}}`},
+		{"escaped pointer", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10}]`, `{"/":9,"~1":10}`},
+		{"append to array", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`},
+		{"copy", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`},
+		{"add null", `{"a":1}`, `[{"op":"add","path":"/a","value":null}]`, `{"a":null}`},
+		{"replace document", `{"a":1}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`},
+	}
+	for _, tt := range tests {
+		p, err := ParsePatch([]byte(tt.patch))
+		if err != nil {
+			t.Fatalf("%s: failed to parse patch: %v", tt.name, err)
+		}
+		doc := mustDecode(t, tt.doc)
+		got, err := p.Apply(doc)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if !Equal(got, mustDecode(t, tt.want)) {
+			t.Errorf("%s: got %v, want %s", tt.name, got, tt.want)
+		}
+		if !Equal(doc, mustDecode(t, tt.doc)) {
+			t.Errorf("%s: Apply modified its document", tt.name)
+		}
+	}
+}
+
+func TestPatchApply_Errors(t *testing.T) {
+	tests := []struct {
+		name, doc, patch string
+	}{
+		{"missing member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`},
+		{"remove missing", `{"foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`},
+		{"replace missing", `{"foo":"bar"}`, `[{"op":"replace","path":"/baz","value":1}]`},
+		{"index out of bounds", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/2","value":1}]`},
+		{"leading zero index", `{"foo":["bar","baz"]}`, `[{"op":"remove","path":"/foo/01"}]`},
+		{"move into child", `{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a/c"}]`},
+		{"remove document", `{"a":1}`, `[{"op":"remove","path":""}]`},
+		{"invalid pointer", `{"a":1}`, `[{"op":"remove","path":"a"}]`},
+	}
+	for _, tt := range tests {
+		p, err := ParsePatch([]byte(tt.patch))
+		if err != nil {
+			t.Fatalf("%s: failed to parse patch: %v", tt.name, err)
+		}
+		if _, err := p.Apply(mustDecode(t, tt.doc)); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+
+	p, _ := ParsePatch([]byte(`[{"op":"test","path":"/baz","value":"bar"}]`))
+	if _, err := p.Apply(mustDecode(t, `{"baz":"qux"}`)); !errors.Is(err, ErrTestFailed) {
+		t.Errorf("Expected ErrTestFailed, got %v", err)
+	}
+
+	// the whole patch fails when one operation does
+	p, _ = ParsePatch([]byte(`[{"op":"add","path":"/a","value":1},{"op":"remove","path":"/missing"}]`))
+	doc := mustDecode(t, `{}`)
+	if _, err := p.Apply(doc); err == nil {
+		t.Error("Expected an error")
+	}
+	if !Equal(doc, mustDecode(t, `{}`)) {
+		t.Errorf("Expected a failed patch to leave the document alone, got %v", doc)
+	}
+}
+
+func TestParsePatch_Invalid(t *testing.T) {
+	for _, patch := range []string{
+		`{"op":"add","path":"/a","value":1}`,
+		`null`,
+		`[{"op":"add","path":"/a"}]`,
+		`[{"op":"move","path":"/a"}]`,
+		`[{"op":"frobnicate","path":"/a"}]`,
+		`[{"path":"/a"}]`,
+		`[{"op":"remove","path":1}]`,
+	} {
+		if _, err := ParsePatch([]byte(patch)); err == nil {
+			t.Errorf("ParsePatch(%s): expected an error", patch)
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	if !Equal(mustDecode(t, `{"a":[1,{"b":null}]}`), mustDecode(t, `{"a":[1.0,{"b":null}]}`)) {
+		t.Error("Expected numerically equal documents to be equal")
+	}
+	if Equal(mustDecode(t, `{"a":1}`), mustDecode(t, `{"a":1,"b":null}`)) {
+		t.Error("Expected a null member to differ from a missing one")
+	}
+	if Equal(mustDecode(t, `"1"`), mustDecode(t, `1`)) {
+		t.Error("Expected a string to differ from a number")
+	}
+}
@@ -1,8 +1,19 @@
 package middleware
 
 import (
+	"digicert-library-app/internal/auth"
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/problem"
+	"digicert-library-app/internal/requestctx"
+	"errors"
 	"log"
 	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
 )
 
 // Middleware to print the current URL into console
@@ -33,13 +44,137 @@ func LimitBodySizeMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func AuthMiddleware(next http.Handler) http.Handler {
+// AuthMiddleware lets through the requests carrying a credential the
+// authenticator accepts: a bearer token or an API key, in the Authorization
+// header or, for keys, X-API-Key, or else the session cookie of a staff
+// member who logged in. The caller goes in the request context and is the
+// actor of the changes the request makes. A session only sends the cookie on
+// unsafe requests from this origin, see sameOrigin.
+func AuthMiddleware(authenticator *auth.Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var principal *auth.Principal
+			var err error
+			if credential, ok := requestCredential(r); ok {
+				principal, err = authenticator.Authenticate(r.Context(), credential)
+			} else if cookie, cookieErr := r.Cookie(auth.SessionCookie); cookieErr == nil {
+				if !isSafeMethod(r.Method) && !sameOrigin(r) {
+					problem.Write(w, r, problem.Forbidden, "A session can't be used from another site")
+					return
+				}
+				principal, err = authenticator.AuthenticateSession(cookie.Value)
+			} else {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				problem.Write(w, r, problem.Unauthorized, "A bearer token, an API key or a session is required")
+				return
+			}
+			if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrInvalidAPIKey) || errors.Is(err, auth.ErrInvalidSession) {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				problem.Write(w, r, problem.Unauthorized, err.Error())
+				return
+			}
+			if err != nil {
+				log.Printf("Authentication failed: %v", err)
+				problem.Write(w, r, problem.InternalError, "Couldn't check credentials")
+				return
+			}
+			ctx := auth.WithPrincipal(r.Context(), principal)
+			ctx = requestctx.WithActor(ctx, principal.Subject)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// requestCredential returns the token of an "Authorization: Bearer" header,
+// or the key of an X-API-Key header
+func requestCredential(r *http.Request) (string, bool) {
+	if key := strings.TrimSpace(r.Header.Get("X-API-Key")); key != "" {
+		return key, true
+	}
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// SameOriginMiddleware refuses unsafe requests from another site with a 403,
+// see sameOrigin. It guards the routes using the session cookie that are
+// reached without AuthMiddleware, such as the logout.
+func SameOriginMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("Authorization")
-		if token != "Bearer this-is-a-secret-token" {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		if !isSafeMethod(r.Method) && !sameOrigin(r) {
+			problem.Write(w, r, problem.Forbidden, "A session can't be used from another site")
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// sameOrigin reports whether a request comes from a page of this server,
+// which SameSite=Lax alone doesn't guarantee: another site's form can still
+// be submitted to a sibling subdomain, and older browsers send the cookie
+// with cross-site POSTs. Browsers say where the request comes from in
+// Sec-Fetch-Site or, before that, Origin. Clients sending neither aren't
+// browsers and can't be tricked into using the cookie.
+func sameOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return true
+	case "":
+	default:
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// RequireRole wraps a handler so it's only reached by callers holding role,
+// or an API key with its scope, others get a 403. It runs after
+// AuthMiddleware.
+func RequireRole(role auth.Role) func(http.HandlerFunc) http.Handler {
+	return func(next http.HandlerFunc) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal := auth.FromContext(r.Context())
+			if principal != nil && principal.HasRole(role) {
+				next(w, r)
+				return
+			}
+			// keys can't be granted the scope of every role
+			if principal != nil && principal.APIKey != nil {
+				if slices.Contains(models.APIKeyScopes, role.Scope()) {
+					problem.Write(w, r, problem.Forbidden, "This request needs an API key with the "+role.Scope()+" scope")
+				} else {
+					problem.Write(w, r, problem.Forbidden, "This request needs a staff token or session with the "+string(role)+" role")
+				}
+				return
+			}
+			problem.Write(w, r, problem.Forbidden, "This request needs the "+string(role)+" role")
+		})
+	}
+}
+
+// validRequestID accepts the request ids clients and proxies commonly send,
+// anything else is replaced rather than copied into logs and the audit log
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestIDMiddleware tags every request with an id, the client's X-Request-ID
+// when it sent a valid one or a new UUID, and echoes it in the response
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID.MatchString(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(requestctx.WithRequestID(r.Context(), id)))
+	})
+}
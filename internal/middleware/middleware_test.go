@@ -0,0 +1,267 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"digicert-library-app/internal/auth"
+	"digicert-library-app/internal/database"
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/problem"
+	"digicert-library-app/internal/requestctx"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func mintToken(t *testing.T, subject string, expiresIn time.Duration, roles ...string) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+		},
+		Roles: roles,
+	}).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// createKey stores a new API key with scopes and returns it and its plaintext
+func createKey(t *testing.T, store *database.MemoryStore, scopes ...string) (models.APIKey, string) {
+	t.Helper()
+	plaintext, creds, err := auth.GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := store.CreateAPIKey(context.Background(), models.APIKey{
+		Name: "Kiosk", Scopes: scopes, Prefix: creds.Prefix, Salt: creds.Salt, Hash: creds.Hash,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, plaintext
+}
+
+func newTestAuthenticator(t *testing.T, store *database.MemoryStore) *auth.Authenticator {
+	t.Helper()
+	verifier, err := auth.NewVerifier(auth.Config{Keys: []auth.Key{auth.HMACKey([]byte(testSecret))}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return auth.NewAuthenticator(verifier, store)
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	store := database.NewMemoryStore()
+	key, plaintext := createKey(t, store, models.ScopeBooksRead)
+	revoked, revokedPlaintext := createKey(t, store, models.ScopeBooksRead)
+	store.RevokeAPIKey(context.Background(), revoked.ID.String())
+
+	var actor string
+	var principal *auth.Principal
+	handler := AuthMiddleware(newTestAuthenticator(t, store))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor = requestctx.Actor(r.Context())
+		principal = auth.FromContext(r.Context())
+	}))
+
+	for _, tt := range []struct {
+		name, header, value, actor string
+	}{
+		{"token", "Authorization", "Bearer " + mintToken(t, "librarian-7", time.Hour), "librarian-7"},
+		{"API key as bearer", "Authorization", "Bearer " + plaintext, "api-key:" + key.ID.String()},
+		{"API key header", "X-API-Key", plaintext, "api-key:" + key.ID.String()},
+	} {
+		req := httptest.NewRequest("GET", "/books", nil)
+		req.Header.Set(tt.header, tt.value)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK || actor != tt.actor || principal == nil || principal.Subject != tt.actor {
+			t.Errorf("%s: expected the request through as %s, got status %d, actor %q", tt.name, tt.actor, w.Code, actor)
+		}
+	}
+	if principal.APIKey == nil || !principal.HasScope(models.ScopeBooksRead) || principal.HasScope(models.ScopeBooksWrite) {
+		t.Errorf("Expected the key's scopes only, got %+v", principal)
+	}
+	if keys, _ := store.ListAPIKeys(context.Background()); keys[0].LastUsedAt == nil {
+		t.Error("Expected the use of the key to be recorded")
+	}
+
+	for _, header := range []string{
+		"",
+		"Basic YWxpY2U6c2VjcmV0",
+		"Bearer ",
+		"Bearer this-is-a-secret-token",
+		"Bearer " + mintToken(t, "librarian-7", -time.Minute),
+		"Bearer " + revokedPlaintext,
+		"Bearer " + plaintext + "x",
+		"Bearer lib_unknown_secret",
+	} {
+		req := httptest.NewRequest("GET", "/books", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%q: expected status 401, got %d", header, w.Code)
+		}
+		if w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%q: expected a WWW-Authenticate challenge", header)
+		}
+		var p models.Problem
+		json.Unmarshal(w.Body.Bytes(), &p)
+		if w.Header().Get("Content-Type") != problem.ContentType || p.Code != "unauthorized" {
+			t.Errorf("%q: expected an unauthorized problem, got %+v", header, p)
+		}
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	store := database.NewMemoryStore()
+	_, reader := createKey(t, store, models.ScopeBooksRead)
+	_, writer := createKey(t, store, models.ScopeBooksRead, models.ScopeBooksWrite)
+	patron := mintToken(t, "patron-1", time.Hour, "patron")
+	librarian := mintToken(t, "librarian-7", time.Hour, "librarian")
+	admin := mintToken(t, "admin-1", time.Hour, "admin")
+	noRole := mintToken(t, "someone", time.Hour)
+	unknownRole := mintToken(t, "someone", time.Hour, "janitor")
+
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	authenticate := AuthMiddleware(newTestAuthenticator(t, store))
+	for _, tt := range []struct {
+		name, credential string
+		role             auth.Role
+		status           int
+		detail           string
+	}{
+		{"patron reads", patron, auth.RolePatron, http.StatusOK, ""},
+		{"patron writes", patron, auth.RoleLibrarian, http.StatusForbidden, "This request needs the librarian role"},
+		{"librarian reads", librarian, auth.RolePatron, http.StatusOK, ""},
+		{"librarian writes", librarian, auth.RoleLibrarian, http.StatusOK, ""},
+		{"librarian manages keys", librarian, auth.RoleAdmin, http.StatusForbidden, "This request needs the admin role"},
+		{"admin writes", admin, auth.RoleLibrarian, http.StatusOK, ""},
+		{"admin manages keys", admin, auth.RoleAdmin, http.StatusOK, ""},
+		{"no role", noRole, auth.RolePatron, http.StatusForbidden, "This request needs the patron role"},
+		{"unknown role", unknownRole, auth.RolePatron, http.StatusForbidden, "This request needs the patron role"},
+		{"read key reads", reader, auth.RolePatron, http.StatusOK, ""},
+		{"read key writes", reader, auth.RoleLibrarian, http.StatusForbidden, "This request needs an API key with the books:write scope"},
+		{"write key writes", writer, auth.RoleLibrarian, http.StatusOK, ""},
+		{"write key manages keys", writer, auth.RoleAdmin, http.StatusForbidden, "This request needs a staff token or session with the admin role"},
+	} {
+		req := httptest.NewRequest("POST", "/books", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.credential)
+		w := httptest.NewRecorder()
+		authenticate(RequireRole(tt.role)(ok)).ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, w.Code)
+		}
+		var p models.Problem
+		if tt.status == http.StatusForbidden {
+			json.Unmarshal(w.Body.Bytes(), &p)
+			if p.Code != "forbidden" || p.Detail != tt.detail || w.Header().Get("Content-Type") != problem.ContentType {
+				t.Errorf("%s: expected a forbidden problem with %q, got %+v", tt.name, tt.detail, p)
+			}
+		}
+	}
+}
+
+func TestAuthMiddleware_Session(t *testing.T) {
+	sessions, err := auth.NewSessions([]byte(testSecret), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := auth.NewVerifier(auth.Config{Keys: []auth.Key{auth.HMACKey([]byte(testSecret))}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := database.NewMemoryStore()
+	session, _ := sessions.Issue("alice", []string{"librarian"})
+
+	var actor string
+	ok := func(w http.ResponseWriter, r *http.Request) { actor = requestctx.Actor(r.Context()) }
+	for _, tt := range []struct {
+		name          string
+		authenticator *auth.Authenticator
+		session       string
+		header        string
+		status        int
+		actor         string
+	}{
+		{"session", auth.NewAuthenticator(verifier, store, auth.WithSessions(sessions)), session, "", http.StatusOK, "alice"},
+		{"header before session", auth.NewAuthenticator(verifier, store, auth.WithSessions(sessions)), session,
+			mintToken(t, "librarian-7", time.Hour, "librarian"), http.StatusOK, "librarian-7"},
+		{"tampered session", auth.NewAuthenticator(verifier, store, auth.WithSessions(sessions)), session + "x", "", http.StatusUnauthorized, ""},
+		{"sessions disabled", auth.NewAuthenticator(verifier, store), session, "", http.StatusUnauthorized, ""},
+	} {
+		actor = ""
+		req := httptest.NewRequest("POST", "/books", nil)
+		req.AddCookie(&http.Cookie{Name: auth.SessionCookie, Value: tt.session})
+		if tt.header != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.header)
+		}
+		w := httptest.NewRecorder()
+		AuthMiddleware(tt.authenticator)(RequireRole(auth.RoleLibrarian)(ok)).ServeHTTP(w, req)
+
+		if w.Code != tt.status || actor != tt.actor {
+			t.Errorf("%s: expected status %d as %q, got %d as %q", tt.name, tt.status, tt.actor, w.Code, actor)
+		}
+	}
+}
+
+func TestAuthMiddleware_SessionCrossSite(t *testing.T) {
+	sessions, err := auth.NewSessions([]byte(testSecret), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := auth.NewVerifier(auth.Config{Keys: []auth.Key{auth.HMACKey([]byte(testSecret))}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator := auth.NewAuthenticator(verifier, database.NewMemoryStore(), auth.WithSessions(sessions))
+	session, _ := sessions.Issue("alice", []string{"librarian"})
+
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	for _, tt := range []struct {
+		name    string
+		method  string
+		headers map[string]string
+		bearer  bool
+		status  int
+	}{
+		{"same origin fetch", "DELETE", map[string]string{"Sec-Fetch-Site": "same-origin", "Origin": "http://example.com"}, false, http.StatusOK},
+		{"cross site fetch", "DELETE", map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.example"}, false, http.StatusForbidden},
+		{"sibling subdomain", "POST", map[string]string{"Sec-Fetch-Site": "same-site"}, false, http.StatusForbidden},
+		{"cross site origin only", "PUT", map[string]string{"Origin": "https://evil.example"}, false, http.StatusForbidden},
+		{"null origin", "PATCH", map[string]string{"Origin": "null"}, false, http.StatusForbidden},
+		{"same origin only", "POST", map[string]string{"Origin": "http://example.com"}, false, http.StatusOK},
+		{"not a browser", "POST", nil, false, http.StatusOK},
+		{"cross site read", "GET", map[string]string{"Sec-Fetch-Site": "cross-site"}, false, http.StatusOK},
+		// a token isn't sent by the browser on its own
+		{"cross site with token", "POST", map[string]string{"Sec-Fetch-Site": "cross-site"}, true, http.StatusOK},
+	} {
+		req := httptest.NewRequest(tt.method, "/books", nil)
+		req.AddCookie(&http.Cookie{Name: auth.SessionCookie, Value: session})
+		for name, value := range tt.headers {
+			req.Header.Set(name, value)
+		}
+		if tt.bearer {
+			req.Header.Set("Authorization", "Bearer "+mintToken(t, "librarian-7", time.Hour, "librarian"))
+		}
+		w := httptest.NewRecorder()
+		AuthMiddleware(authenticator)(RequireRole(auth.RoleLibrarian)(ok)).ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, w.Code)
+		}
+	}
+}
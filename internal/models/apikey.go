@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scopes grant access to parts of the API
+const (
+	ScopeBooksRead  = "books:read"
+	ScopeBooksWrite = "books:write"
+	// ScopeManageAPIKeys is held by staff tokens only, it can't be granted to
+	// an API key
+	ScopeManageAPIKeys = "api_keys:manage"
+)
+
+// APIKeyScopes are the scopes an API key can be granted
+var APIKeyScopes = []string{ScopeBooksRead, ScopeBooksWrite}
+
+// APIKey is the credential of an integration, such as a self-checkout kiosk.
+// Only a salted hash of its secret is stored, the plaintext key is shown once
+// when it's created or rotated.
+type APIKey struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	// Prefix is the public start of the key, telling keys apart
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RotatedAt  *time.Time `json:"rotated_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	// Salt and Hash check the secret of the key, they never leave the server
+	Salt string `json:"-"`
+	Hash string `json:"-"`
+}
+
+// APIKeyRequest is the body of POST /admin/api-keys
+type APIKeyRequest struct {
+	Name   string   `json:"name" validate:"required,max=255"`
+	Scopes []string `json:"scopes" validate:"required,scopes"`
+}
+
+type APIKeyResponse struct {
+	APIKey APIKey `json:"api_key"`
+	// Key is the plaintext key, only set when it was just created or rotated
+	Key string `json:"key,omitempty"`
+}
+
+type APIKeysResponse struct {
+	Data []APIKey `json:"data"`
+}
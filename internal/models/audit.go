@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audit actions, one per kind of change to a book
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+)
+
+// AuditEntry records a single change to a book: who made it, through which
+// request, and the fields it changed
+type AuditEntry struct {
+	ID        int64     `json:"id"`
+	BookID    uuid.UUID `json:"book_id"`
+	Action    string    `json:"action"`
+	Actor     string    `json:"actor"`
+	RequestID string    `json:"request_id,omitempty"`
+	// Changes maps each changed field to its value before and after, null
+	// standing for unset
+	Changes   map[string]FieldChange `json:"changes"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// FieldChange holds the values of a field either side of a change
+type FieldChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditFilter narrows the audit entries returned by a query. Zero values are
+// ignored.
+type AuditFilter struct {
+	BookID string
+	Actor  string
+	// Since is an inclusive lower bound on the time of the change
+	Since time.Time
+}
+
+// AuditQuery describes a page of audit entries, oldest first
+type AuditQuery struct {
+	Filter AuditFilter
+	Limit  int
+	Offset int
+}
+
+type AuditResponse struct {
+	Data  []AuditEntry `json:"data"`
+	Page  int          `json:"page,omitempty"`
+	Limit int          `json:"limit,omitempty"`
+}
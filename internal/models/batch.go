@@ -0,0 +1,48 @@
+package models
+
+// Batch operation kinds
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+)
+
+// Batch modes. An atomic batch applies every operation or none, a partial
+// batch applies the operations that succeed and reports the others.
+const (
+	BatchAtomic  = "atomic"
+	BatchPartial = "partial"
+)
+
+// BatchOperation is one write of a batch. Book holds the new fields of a
+// create or update, ID the book an update or delete applies to and Version,
+// when set, the version the book must still be at.
+type BatchOperation struct {
+	Op      string `json:"op"`
+	ID      string `json:"id,omitempty"`
+	Version int    `json:"version,omitempty"`
+	Book    *Book  `json:"book,omitempty"`
+}
+
+type BatchRequest struct {
+	Mode       string           `json:"mode"`
+	Operations []BatchOperation `json:"operations"`
+}
+
+// BatchResult reports the outcome of the operation at Index with the status
+// code the equivalent single request would have had
+type BatchResult struct {
+	Index  int    `json:"index"`
+	Status int    `json:"status"`
+	Book   *Book  `json:"book,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Errors lists the invalid fields of a 422
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+type BatchResponse struct {
+	Mode string `json:"mode"`
+	// Committed tells whether any change was stored
+	Committed bool          `json:"committed"`
+	Results   []BatchResult `json:"results"`
+}
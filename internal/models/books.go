@@ -1,11 +1,45 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
+)
+
+// Book is a book of the catalog. The validate tags declare the rules writes
+// are checked against, see the validation package. Text limits match the
+// columns of the books table.
 type Book struct {
 	ID            uuid.UUID `json:"id"`
-	Title         string    `json:"title"`
-	Author        string    `json:"author"`
-	PublishedYear int       `json:"published_year,omitempty"`
-	Genre         string    `json:"genre,omitempty"`
+	Title         string    `json:"title" validate:"required,max=255"`
+	Author        string    `json:"author" validate:"required,max=255"`
+	PublishedYear int       `json:"published_year,omitempty" validate:"omitempty,year"`
+	Genre         string    `json:"genre,omitempty" validate:"omitempty,max=20,genre"`
+	// ISBN is the book's ISBN-13, digits only, and unique across the catalog
+	ISBN      string    `json:"isbn,omitempty" validate:"omitempty,isbn"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int       `json:"version"`
+	// DeletedAt is set while the book is in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Genres are the genres a book can be filed under
+var Genres = []string{
+	"Fiction", "Non-Fiction", "Classic", "Sci-Fi", "Fantasy", "Mystery",
+	"Thriller", "Horror", "Romance", "Historical", "Drama", "Poetry",
+	"Biography", "History", "Science", "Philosophy", "Self-Help",
+	"Children", "Young Adult", "Comics", "Reference",
+}
+
+// CanonicalGenre returns the spelling of genre in Genres, matched ignoring
+// case, and whether there is one
+func CanonicalGenre(genre string) (string, bool) {
+	for _, g := range Genres {
+		if strings.EqualFold(g, strings.TrimSpace(genre)) {
+			return g, true
+		}
+	}
+	return "", false
 }
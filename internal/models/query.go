@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// BookFilter narrows the books returned by a list query. Zero values are
+// ignored.
+type BookFilter struct {
+	// Author and Genre match exactly, ignoring case
+	Author string
+	Genre  string
+	// Title matches any book whose title contains it, ignoring case
+	Title string
+	// YearMin and YearMax bound published_year inclusively
+	YearMin int
+	YearMax int
+
+	// CreatedSince and UpdatedSince are inclusive lower bounds, which makes
+	// UpdatedSince usable for "changed since" sync queries
+	CreatedSince  time.Time
+	CreatedBefore time.Time
+	UpdatedSince  time.Time
+	UpdatedBefore time.Time
+
+	// Deleted selects the books in the trash instead of the live ones
+	Deleted bool
+}
+
+// SortField orders results by a whitelisted field, ascending unless Desc is
+// set
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// Cursor is a keyset position: the sort key values of the last book seen,
+// in sort order, and its id. A query with a cursor resumes right after it.
+type Cursor struct {
+	Values []interface{}
+	ID     string
+}
+
+// BookQuery describes a page of books to list. After, when set, is used
+// instead of Offset.
+type BookQuery struct {
+	Filter BookFilter
+	Sort   []SortField
+	Limit  int
+	Offset int
+	After  *Cursor
+}
+
+// BookStats summarizes the books matching a filter. Any write to one of them
+// changes at least one of the fields, which makes the stats a cheap validator
+// for a cached list.
+type BookStats struct {
+	Count int
+	// LastModified is the latest updated_at of the books matching the filter
+	// whether live or trashed, so it moves when a book is deleted or
+	// restored. It's zero when nothing matches. Purged books no longer count,
+	// they left the list a retention period earlier.
+	LastModified time.Time
+	// VersionSum adds up the versions, it catches changes made within the
+	// precision of updated_at
+	VersionSum int64
+}
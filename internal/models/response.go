@@ -1,5 +1,10 @@
 package models
 
+import (
+	"fmt"
+	"strings"
+)
+
 type BookResponse struct {
 	Book Book `json:"book"`
 }
@@ -8,14 +13,75 @@ type BooksResponse struct {
 	Data       []Book `json:"data"`
 	Page       int    `json:"page,omitempty"`
 	Limit      int    `json:"limit,omitempty"`
-	Total      int    `json:"total,omitempty"`
+	Total      int    `json:"total"`
 	TotalPages int    `json:"totalPages,omitempty"`
+	// NextCursor resumes the listing after the last book of this page
+	NextCursor string     `json:"next_cursor,omitempty"`
+	Links      *PageLinks `json:"links,omitempty"`
+}
+
+// PageLinks holds the URLs of the pages around the current one. Links that
+// don't apply, such as prev on the first page, are left empty.
+type PageLinks struct {
+	First string `json:"first,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+	Next  string `json:"next,omitempty"`
+	Last  string `json:"last,omitempty"`
+}
+
+// Header renders the links as an RFC 8288 Link header value
+func (l *PageLinks) Header() string {
+	var parts []string
+	for _, link := range []struct{ rel, url string }{
+		{"first", l.First},
+		{"prev", l.Prev},
+		{"next", l.Next},
+		{"last", l.Last},
+	} {
+		if link.url != "" {
+			parts = append(parts, fmt.Sprintf("<%s>; rel=\"%s\"", link.url, link.rel))
+		}
+	}
+	return strings.Join(parts, ", ")
 }
 
 type MessageResponse struct {
 	Message string `json:"message"`
 }
 
-type ErrorResponse struct {
-	Error string `json:"error"`
+// Problem is the body of every error response, an RFC 9457 problem details
+// document. Code identifies the kind of problem for programs and Errors lists
+// the invalid fields of a request that failed validation.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Code      string       `json:"code"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is a rule a field of a request breaks. Code identifies the rule
+// for programs, Message explains it to people.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// SearchResult is a book matched by a full-text search. Highlights holds, per
+// matched field, an HTML snippet with the matches wrapped in <mark> tags.
+type SearchResult struct {
+	Book       Book              `json:"book"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights,omitempty"`
+}
+
+type SearchResponse struct {
+	Data  []SearchResult `json:"data"`
+	Query string         `json:"query"`
+	Page  int            `json:"page,omitempty"`
+	Limit int            `json:"limit,omitempty"`
 }
@@ -0,0 +1,31 @@
+package models
+
+// ImportResponse reports what an import stored, or with DryRun would have
+// stored, and the rows it left out
+type ImportResponse struct {
+	DryRun bool `json:"dry_run"`
+	// Rows is the number of data rows read
+	Rows     int `json:"rows"`
+	Imported int `json:"imported"`
+	// Books are the books created, in row order
+	Books      []Book            `json:"books,omitempty"`
+	Errors     []ImportError     `json:"errors,omitempty"`
+	Duplicates []ImportDuplicate `json:"duplicates,omitempty"`
+}
+
+// ImportError is a problem with a row, Row being its line in the file
+type ImportError struct {
+	Row   int    `json:"row"`
+	Field string `json:"field,omitempty"`
+	// Code identifies the validation rule the field breaks, if any
+	Code  string `json:"code,omitempty"`
+	Error string `json:"error"`
+}
+
+// ImportDuplicate is a row skipped because it describes a book already in
+// the catalog, or an earlier row of the same file
+type ImportDuplicate struct {
+	Row            int    `json:"row"`
+	BookID         string `json:"book_id,omitempty"`
+	DuplicateOfRow int    `json:"duplicate_of_row,omitempty"`
+}
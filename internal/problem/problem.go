@@ -0,0 +1,116 @@
+// Package problem writes the error responses of the API as RFC 9457 problem
+// details, so handlers, middleware and the router all report failures the
+// same way:
+//
+//	HTTP/1.1 404 Not Found
+//	Content-Type: application/problem+json
+//
+//	{
+//	  "type": "/problems/book_not_found",
+//	  "title": "Book not found",
+//	  "status": 404,
+//	  "detail": "Book not found",
+//	  "instance": "/books/5b0c...",
+//	  "request_id": "4f1d...",
+//	  "code": "book_not_found"
+//	}
+//
+// Programs should branch on code, which never changes for a given type, and
+// show detail, which explains the occurrence, to people.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/requestctx"
+)
+
+// ContentType is the media type of a problem details document
+const ContentType = "application/problem+json"
+
+// Type is a kind of problem: its machine readable code, a title that is the
+// same for every occurrence, and the status it's answered with
+type Type struct {
+	Code   string
+	Title  string
+	Status int
+}
+
+// URI is the type member of the problem, a reference relative to the root of
+// the API
+func (t Type) URI() string {
+	return "/problems/" + t.Code
+}
+
+// The types of problems the API reports
+var (
+	BadRequest           = Type{"bad_request", "Bad request", http.StatusBadRequest}
+	InvalidPayload       = Type{"invalid_payload", "Malformed request body", http.StatusBadRequest}
+	InvalidID            = Type{"invalid_id", "Invalid ID", http.StatusBadRequest}
+	InvalidISBN          = Type{"invalid_isbn", "Invalid ISBN", http.StatusBadRequest}
+	Unauthorized         = Type{"unauthorized", "Unauthorized", http.StatusUnauthorized}
+	LoginFailed          = Type{"login_failed", "Login failed", http.StatusUnauthorized}
+	Forbidden            = Type{"forbidden", "Forbidden", http.StatusForbidden}
+	NotFound             = Type{"not_found", "Not found", http.StatusNotFound}
+	BookNotFound         = Type{"book_not_found", "Book not found", http.StatusNotFound}
+	APIKeyNotFound       = Type{"api_key_not_found", "API key not found", http.StatusNotFound}
+	MethodNotAllowed     = Type{"method_not_allowed", "Method not allowed", http.StatusMethodNotAllowed}
+	DuplicateISBN        = Type{"duplicate_isbn", "Duplicate ISBN", http.StatusConflict}
+	PatchFailed          = Type{"patch_failed", "Patch can't be applied", http.StatusConflict}
+	EditConflict         = Type{"edit_conflict", "Concurrent modification", http.StatusConflict}
+	PreconditionFailed   = Type{"precondition_failed", "Precondition failed", http.StatusPreconditionFailed}
+	UnsupportedMediaType = Type{"unsupported_media_type", "Unsupported media type", http.StatusUnsupportedMediaType}
+	ValidationFailed     = Type{"validation_failed", "Validation failed", http.StatusUnprocessableEntity}
+	PreconditionRequired = Type{"precondition_required", "Precondition required", http.StatusPreconditionRequired}
+	InternalError        = Type{"internal_error", "Internal server error", http.StatusInternalServerError}
+)
+
+// New returns the problem of type t that request r ran into
+func New(r *http.Request, t Type, detail string) models.Problem {
+	return models.Problem{
+		Type:      t.URI(),
+		Title:     t.Title,
+		Status:    t.Status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: requestctx.RequestID(r.Context()),
+		Code:      t.Code,
+	}
+}
+
+// Write answers r with a problem of type t, detail explaining this occurrence
+func Write(w http.ResponseWriter, r *http.Request, t Type, detail string) {
+	Send(w, New(r, t, detail))
+}
+
+// WriteErrors answers r with a problem of type t listing the invalid fields
+// of the request
+func WriteErrors(w http.ResponseWriter, r *http.Request, t Type, detail string, errs []models.FieldError) {
+	p := New(r, t, detail)
+	p.Errors = errs
+	Send(w, p)
+}
+
+// Send writes p as the response, with p.Status as its status
+func Send(w http.ResponseWriter, p models.Problem) {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// NotFoundHandler answers requests for paths no route matches
+func NotFoundHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Write(w, r, NotFound, "No resource at "+r.URL.Path)
+	})
+}
+
+// MethodNotAllowedHandler answers requests for a path whose routes don't
+// accept the request method
+func MethodNotAllowedHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Write(w, r, MethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+	})
+}
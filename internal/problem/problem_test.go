@@ -0,0 +1,92 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/requestctx"
+
+	"github.com/gorilla/mux"
+)
+
+func TestWrite(t *testing.T) {
+	r := httptest.NewRequest("GET", "/books/42?page=2", nil)
+	r = r.WithContext(requestctx.WithRequestID(r.Context(), "req-1"))
+	w := httptest.NewRecorder()
+	Write(w, r, InvalidID, "Invalid book ID format")
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Expected Content-Type %s, got %q", ContentType, ct)
+	}
+	var p models.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	want := models.Problem{
+		Type:      "/problems/invalid_id",
+		Title:     "Invalid ID",
+		Status:    http.StatusBadRequest,
+		Detail:    "Invalid book ID format",
+		Instance:  "/books/42",
+		RequestID: "req-1",
+		Code:      "invalid_id",
+	}
+	if p.Type != want.Type || p.Title != want.Title || p.Status != want.Status || p.Detail != want.Detail ||
+		p.Instance != want.Instance || p.RequestID != want.RequestID || p.Code != want.Code || p.Errors != nil {
+		t.Errorf("Expected %+v, got %+v", want, p)
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteErrors(w, httptest.NewRequest("POST", "/books", nil), ValidationFailed, "Validation failed", []models.FieldError{
+		{Field: "title", Code: "required", Message: "title is required"},
+	})
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", w.Code)
+	}
+	var p models.Problem
+	json.Unmarshal(w.Body.Bytes(), &p)
+	if p.Code != "validation_failed" || len(p.Errors) != 1 || p.Errors[0].Field != "title" {
+		t.Errorf("Expected the invalid field to be listed, got %+v", p)
+	}
+}
+
+func TestRouterHandlers(t *testing.T) {
+	r := mux.NewRouter()
+	r.HandleFunc("/books", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+	r.NotFoundHandler = NotFoundHandler()
+	r.MethodNotAllowedHandler = MethodNotAllowedHandler()
+
+	tests := []struct {
+		method, path string
+		status       int
+		code         string
+	}{
+		{"GET", "/nowhere", http.StatusNotFound, "not_found"},
+		{"DELETE", "/books", http.StatusMethodNotAllowed, "method_not_allowed"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+		if w.Code != tt.status {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.status, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != ContentType {
+			t.Errorf("%s %s: expected Content-Type %s, got %q", tt.method, tt.path, ContentType, ct)
+		}
+		var p models.Problem
+		json.Unmarshal(w.Body.Bytes(), &p)
+		if p.Code != tt.code || p.Status != tt.status || p.Instance != tt.path {
+			t.Errorf("%s %s: unexpected problem %+v", tt.method, tt.path, p)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// Package purge runs the background job that permanently removes books which
+// have been in the trash for longer than a retention window.
+package purge
+
+import (
+	"context"
+	"digicert-library-app/internal/requestctx"
+	"log"
+	"time"
+)
+
+// Actor is recorded in the audit log as the author of purges
+const Actor = "purge-job"
+
+// Store is the part of database.BookStore the purge job needs
+type Store interface {
+	PurgeDeletedBooks(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Once removes the books deleted more than retention before now
+func Once(ctx context.Context, store Store, retention time.Duration, now time.Time) (int64, error) {
+	return store.PurgeDeletedBooks(requestctx.WithActor(ctx, Actor), now.Add(-retention))
+}
+
+// Run purges every interval, starting right away, until ctx is cancelled.
+// Failures are logged and retried on the next tick.
+func Run(ctx context.Context, store Store, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		purged, err := Once(ctx, store, retention, time.Now())
+		if err != nil {
+			log.Printf("Failed to purge trash: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d books deleted more than %s ago", purged, retention)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package purge
+
+import (
+	"context"
+	"database/sql"
+	"digicert-library-app/internal/database"
+	"digicert-library-app/internal/models"
+	"testing"
+	"time"
+)
+
+func TestOnce(t *testing.T) {
+	ctx := context.Background()
+	store := database.NewMemoryStore()
+	kept, _ := store.CreateBook(ctx, models.Book{Title: "Dune", Author: "Frank Herbert"})
+	trashed, _ := store.CreateBook(ctx, models.Book{Title: "Emma", Author: "Jane Austen"})
+	store.DeleteBook(ctx, trashed.ID.String(), 0)
+
+	// still within the retention window
+	if purged, err := Once(ctx, store, time.Hour, time.Now()); err != nil || purged != 0 {
+		t.Fatalf("Expected nothing to be purged yet, got %d (err: %v)", purged, err)
+	}
+	if _, err := store.RestoreBook(ctx, trashed.ID.String()); err != nil {
+		t.Fatalf("Expected the book to still be restorable, got %v", err)
+	}
+	store.DeleteBook(ctx, trashed.ID.String(), 0)
+
+	if purged, err := Once(ctx, store, time.Hour, time.Now().Add(2*time.Hour)); err != nil || purged != 1 {
+		t.Fatalf("Expected one book to be purged, got %d (err: %v)", purged, err)
+	}
+	if _, err := store.RestoreBook(ctx, trashed.ID.String()); err != sql.ErrNoRows {
+		t.Errorf("Expected a purged book to be gone, got %v", err)
+	}
+	if _, err := store.GetBookByID(ctx, kept.ID.String()); err != nil {
+		t.Errorf("Expected live books to be left alone, got %v", err)
+	}
+}
+
+func TestRun_StopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Run(ctx, database.NewMemoryStore(), time.Hour, time.Millisecond)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Run to return once its context is cancelled")
+	}
+}
@@ -0,0 +1,232 @@
+// Package search parses full-text search queries and highlights their matches.
+// Storage backends translate a parsed Query into their own full-text syntax,
+// so phrase and prefix semantics stay the same whichever backend answers.
+package search
+
+import (
+	"errors"
+	"html"
+	"strings"
+	"unicode"
+)
+
+// ErrEmptyQuery is returned when a query contains no searchable words
+var ErrEmptyQuery = errors.New("search query has no searchable words")
+
+// Term is a single word, a quoted phrase of consecutive words, or a word
+// prefix (written with a trailing "*"). Words are lower case.
+type Term struct {
+	Words  []string
+	Prefix bool
+}
+
+// Phrase reports whether the term is a multi-word phrase
+func (t Term) Phrase() bool {
+	return len(t.Words) > 1
+}
+
+// Query is a parsed search. A book matches when every term matches one of
+// its searchable fields.
+type Query struct {
+	Raw   string
+	Terms []Term
+}
+
+// Parse parses queries such as `dune "frank herbert" mess*`
+func Parse(raw string) (Query, error) {
+	q := Query{Raw: raw}
+	rest := raw
+	for rest != "" {
+		rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+		if rest == "" {
+			break
+		}
+
+		var chunk string
+		if rest[0] == '"' {
+			// quoted phrase, an unterminated quote runs to the end
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				chunk, rest = rest[1:], ""
+			} else {
+				chunk, rest = rest[1:end+1], rest[end+2:]
+			}
+			if words := Tokenize(chunk); len(words) > 0 {
+				q.Terms = append(q.Terms, Term{Words: words})
+			}
+			continue
+		}
+
+		end := strings.IndexFunc(rest, unicode.IsSpace)
+		if end < 0 {
+			end = len(rest)
+		}
+		chunk, rest = rest[:end], rest[end:]
+		prefix := strings.HasSuffix(chunk, "*")
+		// punctuation inside a bare word splits it into separate terms
+		words := Tokenize(chunk)
+		for i, word := range words {
+			q.Terms = append(q.Terms, Term{Words: []string{word}, Prefix: prefix && i == len(words)-1})
+		}
+	}
+
+	if len(q.Terms) == 0 {
+		return q, ErrEmptyQuery
+	}
+	return q, nil
+}
+
+// token is a word and its byte offsets in the text it was read from
+type token struct {
+	word       string
+	start, end int
+}
+
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case isWord && start < 0:
+			start = i
+		case !isWord && start >= 0:
+			tokens = append(tokens, token{strings.ToLower(text[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{strings.ToLower(text[start:]), start, len(text)})
+	}
+	return tokens
+}
+
+// Tokenize splits text into lower case words, dropping punctuation
+func Tokenize(text string) []string {
+	tokens := tokenize(text)
+	words := make([]string, len(tokens))
+	for i, t := range tokens {
+		words[i] = t.word
+	}
+	return words
+}
+
+// span is a matched byte range
+type span struct {
+	start, end int
+}
+
+// matchSpans returns the ranges of text matched by term
+func (t Term) matchSpans(tokens []token) []span {
+	var spans []span
+	for i := 0; i+len(t.Words) <= len(tokens); i++ {
+		matched := true
+		for j, word := range t.Words {
+			got := tokens[i+j].word
+			last := j == len(t.Words)-1
+			if !(got == word || (last && t.Prefix && strings.HasPrefix(got, word))) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			spans = append(spans, span{tokens[i].start, tokens[i+len(t.Words)-1].end})
+		}
+	}
+	return spans
+}
+
+// Count returns how many times the term occurs in text
+func (t Term) Count(text string) int {
+	return len(t.matchSpans(tokenize(text)))
+}
+
+// Highlight returns text, HTML escaped, with every match of the query wrapped
+// in <mark> tags. When text is longer than maxRunes (and maxRunes > 0) it is
+// cut to a snippet around the first match, with ellipses marking the cuts.
+// An empty string is returned when nothing matches.
+func (q Query) Highlight(text string, maxRunes int) string {
+	tokens := tokenize(text)
+	var spans []span
+	for _, term := range q.Terms {
+		spans = append(spans, term.matchSpans(tokens)...)
+	}
+	if len(spans) == 0 {
+		return ""
+	}
+	spans = mergeSpans(spans)
+
+	from, to := 0, len(text)
+	if maxRunes > 0 && len([]rune(text)) > maxRunes {
+		from, to = snippetWindow(text, spans[0], maxRunes)
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	pos := from
+	for _, s := range spans {
+		if s.end <= from || s.start >= to {
+			continue
+		}
+		start, end := max(s.start, from), min(s.end, to)
+		b.WriteString(html.EscapeString(text[pos:start]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[start:end]))
+		b.WriteString("</mark>")
+		pos = end
+	}
+	b.WriteString(html.EscapeString(text[pos:to]))
+	if to < len(text) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// mergeSpans sorts spans and merges the overlapping ones
+func mergeSpans(spans []span) []span {
+	for i := 1; i < len(spans); i++ {
+		for j := i; j > 0 && spans[j].start < spans[j-1].start; j-- {
+			spans[j], spans[j-1] = spans[j-1], spans[j]
+		}
+	}
+	merged := spans[:1]
+	for _, s := range spans[1:] {
+		last := &merged[len(merged)-1]
+		if s.start <= last.end {
+			last.end = max(last.end, s.end)
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// snippetWindow picks a window of at most maxRunes runes around first,
+// starting a little before it so the match has some leading context. The
+// window is shrunk to word boundaries so words aren't cut in half.
+func snippetWindow(text string, first span, maxRunes int) (int, int) {
+	runes := []rune(text)
+	// byte offsets to rune indexes
+	matchStart := len([]rune(text[:first.start]))
+	matchEnd := len([]rune(text[:first.end]))
+
+	from := max(matchStart-maxRunes/4, 0)
+	to := min(from+maxRunes, len(runes))
+	from = max(to-maxRunes, 0)
+
+	for from > 0 && from < matchStart && !unicode.IsSpace(runes[from-1]) {
+		from++
+	}
+	for to < len(runes) && to > matchEnd && !unicode.IsSpace(runes[to]) {
+		to--
+	}
+	for from < matchStart && unicode.IsSpace(runes[from]) {
+		from++
+	}
+	for to > matchEnd && unicode.IsSpace(runes[to-1]) {
+		to--
+	}
+	return len(string(runes[:from])), len(string(runes[:to]))
+}
@@ -0,0 +1,65 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	q, err := Parse(`dune  "Frank  Herbert" mess* sci-fi "unterminated phrase`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Term{
+		{Words: []string{"dune"}},
+		{Words: []string{"frank", "herbert"}},
+		{Words: []string{"mess"}, Prefix: true},
+		{Words: []string{"sci"}},
+		{Words: []string{"fi"}},
+		{Words: []string{"unterminated", "phrase"}},
+	}
+	if !reflect.DeepEqual(q.Terms, want) {
+		t.Errorf("Unexpected terms\n got: %+v\nwant: %+v", q.Terms, want)
+	}
+}
+
+func TestParse_Empty(t *testing.T) {
+	for _, raw := range []string{"", "   ", `"" * --`} {
+		if _, err := Parse(raw); err != ErrEmptyQuery {
+			t.Errorf("Parse(%q): expected ErrEmptyQuery, got %v", raw, err)
+		}
+	}
+}
+
+func TestTermCount(t *testing.T) {
+	q, _ := Parse(`"of dune" child*`)
+	if n := q.Terms[0].Count("Children of Dune, of dune"); n != 2 {
+		t.Errorf("Expected phrase to match twice, got %d", n)
+	}
+	if n := q.Terms[0].Count("Dune of"); n != 0 {
+		t.Errorf("Expected words out of order not to match the phrase, got %d", n)
+	}
+	if n := q.Terms[1].Count("Children of Dune"); n != 1 {
+		t.Errorf("Expected prefix to match, got %d", n)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	q, _ := Parse(`dune "of dune" <b>`)
+	if got := q.Highlight("Children of Dune & <b>Dune</b>", 0); got != "Children <mark>of Dune</mark> &amp; &lt;<mark>b</mark>&gt;<mark>Dune</mark>&lt;/<mark>b</mark>&gt;" {
+		t.Errorf("Unexpected highlight %q", got)
+	}
+	if got := q.Highlight("Emma", 0); got != "" {
+		t.Errorf("Expected no highlight without a match, got %q", got)
+	}
+}
+
+func TestHighlight_Snippet(t *testing.T) {
+	q, _ := Parse("needle")
+	text := "aaaa bbbb cccc dddd eeee ffff gggg hhhh needle iiii jjjj kkkk llll mmmm"
+	got := q.Highlight(text, 30)
+	want := "…hhhh <mark>needle</mark> iiii jjjj kkkk…"
+	if got != want {
+		t.Errorf("Unexpected snippet\n got: %q\nwant: %q", got, want)
+	}
+}
@@ -0,0 +1,35 @@
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"digicert-library-app/internal/models"
+)
+
+// scopes accepts lists of the scopes of models.APIKeyScopes
+func scopes(field string, value reflect.Value, _ string) (string, string) {
+	for _, scope := range value.Interface().([]string) {
+		if !slices.Contains(models.APIKeyScopes, scope) {
+			return "not_allowed", fmt.Sprintf("%s must be among %s", field, strings.Join(models.APIKeyScopes, ", "))
+		}
+	}
+	return "", ""
+}
+
+// APIKey checks a request creating an API key, trimming its name and
+// dropping repeated scopes
+func APIKey(req *models.APIKeyRequest) Errors {
+	errs := Struct(req)
+	req.Name = strings.TrimSpace(req.Name)
+	var unique []string
+	for _, scope := range req.Scopes {
+		if !slices.Contains(unique, scope) {
+			unique = append(unique, scope)
+		}
+	}
+	req.Scopes = unique
+	return errs
+}
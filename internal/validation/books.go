@@ -0,0 +1,58 @@
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"digicert-library-app/internal/catalog"
+	"digicert-library-app/internal/models"
+)
+
+// MinYear is the earliest publication year accepted, that of the first
+// printed books
+const MinYear = 1450
+
+// MaxYear is the latest publication year accepted: next year, so forthcoming
+// books can be catalogued
+func MaxYear() int {
+	return time.Now().Year() + 1
+}
+
+func year(field string, value reflect.Value, _ string) (string, string) {
+	if y := value.Int(); y < MinYear || y > int64(MaxYear()) {
+		return "out_of_range", fmt.Sprintf("%s must be between %d and %d", field, MinYear, MaxYear())
+	}
+	return "", ""
+}
+
+// genre accepts the genres of models.Genres, ignoring case
+func genre(field string, value reflect.Value, _ string) (string, string) {
+	if _, ok := models.CanonicalGenre(value.String()); !ok {
+		return "not_allowed", fmt.Sprintf("%s must be one of %s", field, strings.Join(models.Genres, ", "))
+	}
+	return "", ""
+}
+
+// isbn accepts an ISBN-10 or ISBN-13 in any of the forms NormalizeISBN does
+func isbn(field string, value reflect.Value, _ string) (string, string) {
+	if _, err := catalog.NormalizeISBN(value.String()); err != nil {
+		return "invalid_isbn", err.Error()
+	}
+	return "", ""
+}
+
+// Book checks a book sent to a write endpoint and brings its valid fields to
+// the form they're stored in: the genre spelled as in models.Genres and the
+// ISBN as its ISBN-13 digits
+func Book(book *models.Book) Errors {
+	errs := Struct(book)
+	if genre, ok := models.CanonicalGenre(book.Genre); ok {
+		book.Genre = genre
+	}
+	if isbn, err := catalog.NormalizeISBN(book.ISBN); err == nil {
+		book.ISBN = isbn
+	}
+	return errs
+}
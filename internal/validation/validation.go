@@ -0,0 +1,125 @@
+// Package validation checks structs against the rules declared in the
+// validate tags of their fields, reporting every broken rule rather than
+// stopping at the first.
+//
+// A tag lists rules separated by commas, some with a parameter after "=":
+//
+//	Title string `json:"title" validate:"required,max=255"`
+//
+// omitempty skips the remaining rules of a field holding its zero value.
+// Fields are reported under their JSON name.
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"digicert-library-app/internal/models"
+)
+
+// Rule checks a field value against the rule's parameter, returning the code
+// and message of the violation, or an empty code when the value is valid
+type Rule func(field string, value reflect.Value, param string) (code, message string)
+
+// Errors lists the rules a value breaks
+type Errors []models.FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, fieldErr := range e {
+		messages[i] = fieldErr.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// rules maps the names used in tags to their checks
+var rules = map[string]Rule{
+	"required": required,
+	"max":      maxRule,
+	"year":     year,
+	"genre":    genre,
+	"isbn":     isbn,
+	"scopes":   scopes,
+}
+
+// Struct checks v, a struct or a pointer to one, and returns the rules its
+// fields break, in field order, or nil when it's valid. A field stops at its
+// first broken rule. Unknown rule names panic, tags are part of the code.
+func Struct(v interface{}) Errors {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	typ := value.Type()
+
+	var errs Errors
+	for i := 0; i < typ.NumField(); i++ {
+		tag, ok := typ.Field(i).Tag.Lookup("validate")
+		if !ok {
+			continue
+		}
+		field := fieldName(typ.Field(i))
+		for _, spec := range strings.Split(tag, ",") {
+			name, param, _ := strings.Cut(spec, "=")
+			if name == "omitempty" {
+				if value.Field(i).IsZero() {
+					break
+				}
+				continue
+			}
+			rule, ok := rules[name]
+			if !ok {
+				panic(fmt.Sprintf("validation: unknown rule %q on %s.%s", name, typ.Name(), typ.Field(i).Name))
+			}
+			if code, message := rule(field, value.Field(i), param); code != "" {
+				errs = append(errs, models.FieldError{Field: field, Code: code, Message: message})
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// fieldName is the name a field has in JSON documents
+func fieldName(f reflect.StructField) string {
+	if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	return f.Name
+}
+
+// required rejects zero values, blank strings and empty slices
+func required(field string, value reflect.Value, _ string) (string, string) {
+	switch {
+	case value.Kind() == reflect.String && strings.TrimSpace(value.String()) == "",
+		value.Kind() == reflect.Slice && value.Len() == 0,
+		value.IsZero():
+		return "required", field + " is required"
+	}
+	return "", ""
+}
+
+// maxRule limits the length of a string, in characters, or the value of an
+// integer
+func maxRule(field string, value reflect.Value, param string) (string, string) {
+	limit := mustAtoi(param)
+	switch value.Kind() {
+	case reflect.String:
+		if utf8.RuneCountInString(value.String()) > limit {
+			return "too_long", fmt.Sprintf("%s must be at most %d characters", field, limit)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if value.Int() > int64(limit) {
+			return "out_of_range", fmt.Sprintf("%s must be at most %d", field, limit)
+		}
+	}
+	return "", ""
+}
+
+func mustAtoi(param string) int {
+	n, err := strconv.Atoi(param)
+	if err != nil {
+		panic(fmt.Sprintf("validation: %q is not a number", param))
+	}
+	return n
+}
@@ -0,0 +1,92 @@
+package validation
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"digicert-library-app/internal/models"
+)
+
+func TestBook(t *testing.T) {
+	book := models.Book{
+		Title:         strings.Repeat("x", 256),
+		Author:        "  ",
+		PublishedYear: 1200,
+		Genre:         "Gardening",
+		ISBN:          "978-0-441-17271-8",
+	}
+	got := Book(&book)
+	want := Errors{
+		{Field: "title", Code: "too_long", Message: "title must be at most 255 characters"},
+		{Field: "author", Code: "required", Message: "author is required"},
+		{Field: "published_year", Code: "out_of_range", Message: "published_year must be between 1450 and " + strconv.Itoa(MaxYear())},
+		{Field: "genre", Code: "not_allowed", Message: "genre must be one of " + strings.Join(models.Genres, ", ")},
+		{Field: "isbn", Code: "invalid_isbn", Message: "ISBN check digit is wrong"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected errors\n%+v\nwant\n%+v", got, want)
+	}
+
+	// lengths count characters, not bytes
+	valid := models.Book{Title: strings.Repeat("é", 255), Author: "Stanisław Lem", Genre: "sci-fi", ISBN: "0-441-17271-7"}
+	if errs := Book(&valid); errs != nil {
+		t.Fatalf("Expected a valid book, got %v", errs)
+	}
+	if valid.Genre != "Sci-Fi" || valid.ISBN != "9780441172719" {
+		t.Errorf("Expected the genre and ISBN to be normalized, got %q and %q", valid.Genre, valid.ISBN)
+	}
+}
+
+func TestStruct(t *testing.T) {
+	var v struct {
+		Name  string `json:"name,omitempty" validate:"required,max=3"`
+		Count int    `validate:"max=2"`
+		Note  string `validate:"omitempty,max=1"`
+		Other string
+	}
+	v.Name, v.Count = "long", 3
+	errs := Struct(&v)
+	if len(errs) != 2 || errs[0].Field != "name" || errs[1].Field != "Count" || errs[1].Code != "out_of_range" {
+		t.Errorf("Unexpected errors %+v", errs)
+	}
+	if errs.Error() != "name must be at most 3 characters; Count must be at most 2" {
+		t.Errorf("Unexpected message %q", errs.Error())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected an unknown rule to panic")
+		}
+	}()
+	Struct(struct {
+		Name string `validate:"frobnicate"`
+	}{})
+}
+
+func TestAPIKey(t *testing.T) {
+	tests := []struct {
+		req   models.APIKeyRequest
+		codes []string
+	}{
+		{models.APIKeyRequest{Name: "Kiosk 1", Scopes: []string{"books:read"}}, nil},
+		{models.APIKeyRequest{Name: " ", Scopes: []string{}}, []string{"name:required", "scopes:required"}},
+		{models.APIKeyRequest{Name: "ILS bridge", Scopes: []string{"books:read", "api_keys:manage"}}, []string{"scopes:not_allowed"}},
+	}
+	for _, tt := range tests {
+		var codes []string
+		for _, fieldErr := range APIKey(&tt.req) {
+			codes = append(codes, fieldErr.Field+":"+fieldErr.Code)
+		}
+		if !reflect.DeepEqual(codes, tt.codes) {
+			t.Errorf("%+v: expected %v, got %v", tt.req, tt.codes, codes)
+		}
+	}
+
+	req := models.APIKeyRequest{Name: "  Website ", Scopes: []string{"books:read", "books:write", "books:read"}}
+	APIKey(&req)
+	if req.Name != "Website" || !reflect.DeepEqual(req.Scopes, []string{"books:read", "books:write"}) {
+		t.Errorf("Expected the name trimmed and the scopes deduplicated, got %+v", req)
+	}
+}
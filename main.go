@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"digicert-library-app/internal/auth"
 	"digicert-library-app/internal/database"
 	"digicert-library-app/internal/middleware"
 	"embed"
@@ -11,18 +12,26 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/pressly/goose/v3"
 
+	"digicert-library-app/internal/handlers/apikeys"
+	"digicert-library-app/internal/handlers/audit"
 	"digicert-library-app/internal/handlers/books"
+	"digicert-library-app/internal/handlers/login"
+	"digicert-library-app/internal/problem"
+	"digicert-library-app/internal/purge"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/gorilla/mux"
+	"github.com/joho/godotenv"
 )
 
-//go:embed db/migrations/*.sql
+//go:embed db/migrations/*/*.sql
 var embedMigrations embed.FS
 
 func waitForDatabase(db *sql.DB, maxRetries int) error {
@@ -37,15 +46,13 @@ func waitForDatabase(db *sql.DB, maxRetries int) error {
 	return fmt.Errorf("failed to connect to database after %d attempts", maxRetries)
 }
 
-func main() {
-
-	// create a database connection
-	ctx := context.Background()
-	db, err := database.NewDBConnection()
+// setupDatabase connects to the MySQL or Postgres server, waits for it to
+// become reachable and applies the goose migrations
+func setupDatabase(dialect database.Dialect) *database.Database {
+	db, err := database.NewDBConnection(dialect)
 	if err != nil {
 		log.Fatalf("Error in DB connection error: %v", err)
 	}
-	defer db.Conn.Close()
 
 	// Set connection pool settings to prevent connection drops
 	db.Conn.SetMaxOpenConns(25)
@@ -60,7 +67,7 @@ func main() {
 		log.Println("Attempting to reconnect...")
 
 		// Try to reconnect once more
-		db, err = database.NewDBConnection()
+		db, err = database.NewDBConnection(dialect)
 		if err != nil {
 			log.Fatalf("Database reconnection failed: %v", err)
 		}
@@ -70,39 +77,276 @@ func main() {
 		}
 	}
 
+	if err := runMigrations(db); err != nil {
+		log.Fatal("error in setting up migrations ", err)
+	}
+	return db
+}
+
+// setupSQLite opens the SQLite database file and applies the goose migrations
+func setupSQLite(path string) *database.Database {
+	db, err := database.NewSQLiteConnection(path)
+	if err != nil {
+		log.Fatalf("Error in DB connection error: %v", err)
+	}
+
+	if err := runMigrations(db); err != nil {
+		log.Fatal("error in setting up migrations ", err)
+	}
+	return db
+}
+
+// runMigrations applies the embedded migrations matching the database dialect
+func runMigrations(db *database.Database) error {
 	//setting up goose
 	goose.SetBaseFS(embedMigrations)
-	if err := goose.SetDialect("mysql"); err != nil {
-		log.Fatal("error in setting mysql dialect", err)
+	if err := goose.SetDialect(db.Dialect.GooseDialect()); err != nil {
+		return fmt.Errorf("error in setting %s dialect: %w", db.Dialect, err)
 	}
 
-	if err := goose.Up(db.Conn, "db/migrations"); err != nil {
-		log.Fatal("error in setting up migrations", err)
+	return goose.Up(db.Conn, db.Dialect.MigrationsDir())
+}
+
+// durationEnv reads a Go duration such as "720h" from the environment
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
 	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		log.Fatalf("Invalid %s %q, expected a duration such as 720h", name, value)
+	}
+	return d
+}
 
-	// initialize the books handler
-	booksHandler := books.InitBooksHandler(ctx, db)
+// setupAuth builds the token verifier from the JWT_* environment variables.
+// Keys come from an HS256 secret, a PEM public key file and a JWKS file, in
+// any combination.
+func setupAuth() *auth.Verifier {
+	cfg := auth.Config{
+		Issuer:   os.Getenv("JWT_ISSUER"),
+		Audience: os.Getenv("JWT_AUDIENCE"),
+		Leeway:   durationEnv("JWT_LEEWAY", 30*time.Second),
+	}
+	if secret := os.Getenv("JWT_HS256_SECRET"); secret != "" {
+		if len(secret) < 32 {
+			log.Fatal("JWT_HS256_SECRET must be at least 32 bytes long")
+		}
+		cfg.Keys = append(cfg.Keys, auth.HMACKey([]byte(secret)))
+	}
+	if path := os.Getenv("JWT_PUBLIC_KEY_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Error reading JWT_PUBLIC_KEY_FILE: %v", err)
+		}
+		key, err := auth.ParsePublicKeyPEM(data)
+		if err != nil {
+			log.Fatalf("Invalid JWT_PUBLIC_KEY_FILE %s: %v", path, err)
+		}
+		cfg.Keys = append(cfg.Keys, key)
+	}
+	if path := os.Getenv("JWT_JWKS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Error reading JWT_JWKS_FILE: %v", err)
+		}
+		keys, err := auth.ParseJWKS(data)
+		if err != nil {
+			log.Fatalf("Invalid JWT_JWKS_FILE %s: %v", path, err)
+		}
+		cfg.Keys = append(cfg.Keys, keys...)
+	}
+
+	verifier, err := auth.NewVerifier(cfg)
+	if err != nil {
+		log.Fatalf("%v, set JWT_HS256_SECRET, JWT_PUBLIC_KEY_FILE or JWT_JWKS_FILE", err)
+	}
+	return verifier
+}
+
+// setupOIDC configures the OpenID Connect login of staff from the OIDC_* and
+// SESSION_* environment variables. It returns nil when OIDC_ISSUER_URL isn't
+// set, leaving the login disabled.
+func setupOIDC(ctx context.Context) (*auth.OIDC, *auth.Sessions) {
+	issuer := os.Getenv("OIDC_ISSUER_URL")
+	if issuer == "" {
+		return nil, nil
+	}
+	cfg := auth.OIDCConfig{
+		IssuerURL:    issuer,
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		GroupsClaim:  os.Getenv("OIDC_GROUPS_CLAIM"),
+		GroupRoles:   map[string]auth.Role{},
+	}
+	if cfg.ClientID == "" || cfg.RedirectURL == "" {
+		log.Fatal("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required with OIDC_ISSUER_URL")
+	}
+	// a group listed for several roles grants the highest
+	for _, role := range []auth.Role{auth.RolePatron, auth.RoleLibrarian, auth.RoleAdmin} {
+		name := "OIDC_" + strings.ToUpper(string(role)) + "_GROUPS"
+		for _, group := range strings.Split(os.Getenv(name), ",") {
+			if group = strings.TrimSpace(group); group != "" {
+				cfg.GroupRoles[group] = role
+			}
+		}
+	}
+	if len(cfg.GroupRoles) == 0 {
+		log.Fatal("No group grants a role, set OIDC_PATRON_GROUPS, OIDC_LIBRARIAN_GROUPS or OIDC_ADMIN_GROUPS")
+	}
+
+	sessions, err := auth.NewSessions([]byte(os.Getenv("SESSION_SECRET")), durationEnv("SESSION_TTL", 8*time.Hour))
+	if err != nil {
+		log.Fatalf("Invalid SESSION_SECRET or SESSION_TTL: %v", err)
+	}
+	client, err := auth.NewOIDC(ctx, cfg)
+	if err != nil {
+		log.Fatalf("Error connecting to the identity provider: %v", err)
+	}
+	return client, sessions
+}
+
+// newRouter routes the API to handlers over store, behind authenticator. The
+// login routes are only served when loginHandler isn't nil.
+func newRouter(ctx context.Context, store database.Store, authenticator *auth.Authenticator, loginHandler *login.LoginHandler, bookOpts ...books.Option) *mux.Router {
+	booksHandler := books.InitBooksHandler(ctx, store, bookOpts...)
+	auditHandler := audit.InitAuditHandler(ctx, store)
+	apiKeysHandler := apikeys.InitAPIKeysHandler(ctx, store)
 
 	// routing logic
 	r := mux.NewRouter()
-	// Set up CORS middleware
-	r.Use(mux.CORSMethodMiddleware(r))
 
 	// Adding middlewares
 	r.Use(middleware.LoggingMiddleware)
+	r.Use(middleware.RequestIDMiddleware)
 	r.Use(middleware.JsonHeaderMiddleware)
 	r.Use(middleware.LimitBodySizeMiddleware)
-	r.Use(middleware.AuthMiddleware)
 
-	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	// the login routes are the only ones reached without credentials, another
+	// site mustn't be able to log a staff member out
+	if loginHandler != nil {
+		r.HandleFunc("/auth/login", loginHandler.Login).Methods("GET")
+		r.HandleFunc("/auth/callback", loginHandler.Callback).Methods("GET")
+		r.Handle("/auth/logout", middleware.SameOriginMiddleware(http.HandlerFunc(loginHandler.Logout))).Methods("POST")
+	}
+
+	api := r.NewRoute().Subrouter()
+	// Set up CORS middleware
+	api.Use(mux.CORSMethodMiddleware(api))
+	api.Use(middleware.AuthMiddleware(authenticator))
+
+	api.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintln(w, "Welcome to Digicert!")
 	})
 
-	r.HandleFunc("/books", booksHandler.GetBooks).Methods("GET")
-	r.HandleFunc("/books/{id}", booksHandler.GetBookByID).Methods("GET")
-	r.HandleFunc("/books", booksHandler.CreateBook).Methods("POST")
-	r.HandleFunc("/books/{id}", booksHandler.UpdateBook).Methods("PUT")
-	r.HandleFunc("/books/{id}", booksHandler.DeleteBook).Methods("DELETE")
+	// every route declares the role its callers need. Patrons read the
+	// catalog, librarians change it and read its history, admins manage the
+	// API keys.
+	patron := middleware.RequireRole(auth.RolePatron)
+	librarian := middleware.RequireRole(auth.RoleLibrarian)
+	admin := middleware.RequireRole(auth.RoleAdmin)
+
+	api.Handle("/books", patron(booksHandler.GetBooks)).Methods("GET")
+	// registered before /books/{id} so "search", "trash" and "export" aren't
+	// taken for ids
+	api.Handle("/books/search", patron(booksHandler.SearchBooks)).Methods("GET")
+	api.Handle("/books/trash", librarian(booksHandler.GetTrash)).Methods("GET")
+	api.Handle("/books/export", patron(booksHandler.ExportBooks)).Methods("GET")
+	api.Handle("/books/isbn/{isbn}", patron(booksHandler.GetBookByISBN)).Methods("GET")
+	api.Handle("/books/{id}", patron(booksHandler.GetBookByID)).Methods("GET")
+	api.Handle("/books", librarian(booksHandler.CreateBook)).Methods("POST")
+	api.Handle("/books:batch", librarian(booksHandler.BatchBooks)).Methods("POST")
+	api.Handle("/books/import", librarian(booksHandler.ImportBooks)).Methods("POST")
+	api.Handle("/books/{id}", librarian(booksHandler.UpdateBook)).Methods("PUT")
+	api.Handle("/books/{id}", librarian(booksHandler.PatchBook)).Methods("PATCH")
+	api.Handle("/books/{id}", librarian(booksHandler.DeleteBook)).Methods("DELETE")
+	api.Handle("/books/{id}/restore", librarian(booksHandler.RestoreBook)).Methods("POST")
+	api.Handle("/books/{id}/history", librarian(booksHandler.GetBookHistory)).Methods("GET")
+	api.Handle("/books/{id}/marcxml", patron(booksHandler.GetBookMARCXML)).Methods("GET")
+	api.Handle("/audit", librarian(auditHandler.GetAuditLog)).Methods("GET")
+	api.Handle("/admin/api-keys", admin(apiKeysHandler.ListAPIKeys)).Methods("GET")
+	api.Handle("/admin/api-keys", admin(apiKeysHandler.CreateAPIKey)).Methods("POST")
+	api.Handle("/admin/api-keys/{id}/rotate", admin(apiKeysHandler.RotateAPIKey)).Methods("POST")
+	api.Handle("/admin/api-keys/{id}", admin(apiKeysHandler.RevokeAPIKey)).Methods("DELETE")
+
+	// the router doesn't run its middleware when no route matches, these
+	// still need a request id for their problem
+	r.NotFoundHandler = middleware.LoggingMiddleware(middleware.RequestIDMiddleware(problem.NotFoundHandler()))
+	r.MethodNotAllowedHandler = middleware.LoggingMiddleware(middleware.RequestIDMiddleware(problem.MethodNotAllowedHandler()))
+	return r
+}
+
+func main() {
+	_ = godotenv.Load()
+	ctx := context.Background()
+
+	// select the storage backend, MySQL unless configured otherwise
+	var store database.Store
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "mysql":
+		db := setupDatabase(database.MySQL)
+		defer db.Conn.Close()
+		store = db
+	case "postgres":
+		db := setupDatabase(database.Postgres)
+		defer db.Conn.Close()
+		store = db
+	case "sqlite":
+		path := os.Getenv("SQLITE_PATH")
+		if path == "" {
+			path = "library.db"
+		}
+		db := setupSQLite(path)
+		defer db.Conn.Close()
+		store = db
+	case "memory":
+		log.Println("Using in-memory storage backend, data will not be persisted")
+		store = database.NewMemoryStore()
+	default:
+		log.Fatalf("Unknown STORAGE_BACKEND %q, expected mysql, postgres, sqlite or memory", backend)
+	}
+
+	// initialize the books handler
+	var bookOpts []books.Option
+	if secret := os.Getenv("CURSOR_SECRET"); secret != "" {
+		bookOpts = append(bookOpts, books.WithCursorSecret([]byte(secret)))
+	}
+	if require, _ := strconv.ParseBool(os.Getenv("REQUIRE_IF_MATCH")); require {
+		bookOpts = append(bookOpts, books.WithRequireIfMatch(true))
+	}
+	if cacheControl := os.Getenv("CACHE_CONTROL"); cacheControl != "" {
+		bookOpts = append(bookOpts, books.WithCacheControl(cacheControl))
+	}
+	var authOpts []auth.AuthenticatorOption
+	oidcClient, sessions := setupOIDC(ctx)
+	if sessions != nil {
+		authOpts = append(authOpts, auth.WithSessions(sessions))
+	}
+	authenticator := auth.NewAuthenticator(setupAuth(), store, authOpts...)
+	var loginHandler *login.LoginHandler
+	if oidcClient != nil {
+		var loginOpts []login.Option
+		if secure, err := strconv.ParseBool(os.Getenv("SESSION_COOKIE_SECURE")); err == nil {
+			loginOpts = append(loginOpts, login.WithSecureCookies(secure))
+		}
+		loginHandler = login.InitLoginHandler(ctx, oidcClient, sessions, loginOpts...)
+	}
+
+	// permanently remove books that stayed in the trash past the retention
+	// window, a retention of 0 keeps them forever
+	jobsCtx, stopJobs := context.WithCancel(ctx)
+	defer stopJobs()
+	if retention := durationEnv("TRASH_RETENTION", 30*24*time.Hour); retention > 0 {
+		interval := durationEnv("TRASH_PURGE_INTERVAL", time.Hour)
+		if interval <= 0 {
+			log.Fatal("TRASH_PURGE_INTERVAL must be positive")
+		}
+		go purge.Run(jobsCtx, store, retention, interval)
+	}
+
+	r := newRouter(ctx, store, authenticator, loginHandler, bookOpts...)
 
 	srv := &http.Server{Addr: ":8080", Handler: r}
 	go func() {
@@ -115,6 +359,7 @@ func main() {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	<-c
+	stopJobs()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	srv.Shutdown(ctx)
@@ -1,9 +1,31 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"digicert-library-app/internal/auth"
+	"digicert-library-app/internal/database"
+	"digicert-library-app/internal/handlers/login"
+	"digicert-library-app/internal/models"
+	"digicert-library-app/internal/requestctx"
+	"digicert-library-app/internal/search"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math/rand/v2"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 // TestRootHandler checks if the root endpoint returns the welcome message.
@@ -26,3 +48,672 @@ func TestRootHandler(t *testing.T) {
 		t.Errorf("Unexpected body: %s", w.Body.String())
 	}
 }
+
+// TestRouteRoles checks every route refuses callers without a credential with
+// a 401 and callers below its role with a 403, and lets its role through
+func TestRouteRoles(t *testing.T) {
+	const secret = "0123456789abcdef0123456789abcdef"
+	verifier, err := auth.NewVerifier(auth.Config{Keys: []auth.Key{auth.HMACKey([]byte(secret))}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := database.NewMemoryStore()
+	router := newRouter(context.Background(), store, auth.NewAuthenticator(verifier, store), nil)
+	token := func(roles ...string) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+			RegisteredClaims: jwt.RegisteredClaims{Subject: "someone", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+			Roles:            roles,
+		}).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	// the role just below each role, a token without one for patrons
+	below := map[auth.Role]string{
+		auth.RolePatron:    token(),
+		auth.RoleLibrarian: token("patron"),
+		auth.RoleAdmin:     token("librarian"),
+	}
+	holding := map[auth.Role]string{
+		auth.RolePatron:    token("patron"),
+		auth.RoleLibrarian: token("librarian"),
+		auth.RoleAdmin:     token("admin"),
+	}
+
+	const id = "123e4567-e89b-12d3-a456-426614174000"
+	for _, route := range []struct {
+		method, path string
+		role         auth.Role
+	}{
+		{"GET", "/books", auth.RolePatron},
+		{"GET", "/books/search?q=dune", auth.RolePatron},
+		{"GET", "/books/trash", auth.RoleLibrarian},
+		{"GET", "/books/export", auth.RolePatron},
+		{"GET", "/books/isbn/9780441172719", auth.RolePatron},
+		{"GET", "/books/" + id, auth.RolePatron},
+		{"POST", "/books", auth.RoleLibrarian},
+		{"POST", "/books:batch", auth.RoleLibrarian},
+		{"POST", "/books/import", auth.RoleLibrarian},
+		{"PUT", "/books/" + id, auth.RoleLibrarian},
+		{"PATCH", "/books/" + id, auth.RoleLibrarian},
+		{"DELETE", "/books/" + id, auth.RoleLibrarian},
+		{"POST", "/books/" + id + "/restore", auth.RoleLibrarian},
+		{"GET", "/books/" + id + "/history", auth.RoleLibrarian},
+		{"GET", "/books/" + id + "/marcxml", auth.RolePatron},
+		{"GET", "/audit", auth.RoleLibrarian},
+		{"GET", "/admin/api-keys", auth.RoleAdmin},
+		{"POST", "/admin/api-keys", auth.RoleAdmin},
+		{"POST", "/admin/api-keys/" + id + "/rotate", auth.RoleAdmin},
+		{"DELETE", "/admin/api-keys/" + id, auth.RoleAdmin},
+	} {
+		for _, tt := range []struct {
+			credential string
+			check      func(status int) bool
+			want       string
+		}{
+			{"", func(status int) bool { return status == http.StatusUnauthorized }, "401"},
+			{below[route.role], func(status int) bool { return status == http.StatusForbidden }, "403"},
+			{holding[route.role], func(status int) bool {
+				return status != http.StatusUnauthorized && status != http.StatusForbidden
+			}, "neither 401 nor 403"},
+		} {
+			req := httptest.NewRequest(route.method, route.path, nil)
+			if tt.credential != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.credential)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if !tt.check(w.Code) {
+				t.Errorf("%s %s needing %s: expected %s, got %d", route.method, route.path, route.role, tt.want, w.Code)
+			}
+		}
+	}
+}
+
+// TestLogoutCrossSite checks another site can't end a staff session
+func TestLogoutCrossSite(t *testing.T) {
+	const secret = "0123456789abcdef0123456789abcdef"
+	sessions, err := auth.NewSessions([]byte(secret), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := database.NewMemoryStore()
+	verifier, err := auth.NewVerifier(auth.Config{Keys: []auth.Key{auth.HMACKey([]byte(secret))}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loginHandler := login.InitLoginHandler(context.Background(), nil, sessions)
+	router := newRouter(context.Background(), store, auth.NewAuthenticator(verifier, store, auth.WithSessions(sessions)), loginHandler)
+
+	for _, tt := range []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{"same origin", map[string]string{"Sec-Fetch-Site": "same-origin", "Origin": "http://example.com"}, http.StatusNoContent},
+		{"cross site form", map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.example"}, http.StatusForbidden},
+		{"cross site origin only", map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"not a browser", nil, http.StatusNoContent},
+	} {
+		req := httptest.NewRequest("POST", "/auth/logout", nil)
+		for name, value := range tt.headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, w.Code)
+		}
+		if deleted := w.Header().Get("Set-Cookie") != ""; deleted != (tt.status == http.StatusNoContent) {
+			t.Errorf("%s: expected the cookie to be deleted only on success, got %q", tt.name, w.Header().Get("Set-Cookie"))
+		}
+	}
+}
+
+// forEachDatabase runs fn against a migrated SQLite database and against a
+// throwaway schema of a Postgres server, see postgresDSN
+func forEachDatabase(t *testing.T, fn func(t *testing.T, db *database.Database)) {
+	t.Run("sqlite", func(t *testing.T) {
+		fn(t, openSQLite(t))
+	})
+	t.Run("postgres", func(t *testing.T) {
+		fn(t, openPostgres(t))
+	})
+}
+
+func openSQLite(t *testing.T) *database.Database {
+	db, err := database.NewSQLiteConnection(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open sqlite database: %v", err)
+	}
+	t.Cleanup(func() { db.Conn.Close() })
+	if err := runMigrations(db); err != nil {
+		t.Fatalf("failed to run migrations: %v", err)
+	}
+	return db
+}
+
+// embedded is the Postgres server the tests start when POSTGRES_TEST_DSN
+// isn't set, stopped by TestMain
+var embedded struct {
+	once   sync.Once
+	server *embeddedpostgres.EmbeddedPostgres
+	dsn    string
+	err    error
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if embedded.server != nil {
+		embedded.server.Stop()
+	}
+	os.Exit(code)
+}
+
+// postgresDSN returns POSTGRES_TEST_DSN, or else the DSN of an embedded
+// Postgres started once for the whole run. Its binaries are downloaded on
+// the first run and cached in ~/.embedded-postgres-go.
+func postgresDSN() (string, error) {
+	if dsn := os.Getenv("POSTGRES_TEST_DSN"); dsn != "" {
+		return dsn, nil
+	}
+	embedded.once.Do(func() {
+		// a port nothing listens on right now
+		l, err := net.Listen("tcp", "localhost:0")
+		if err != nil {
+			embedded.err = err
+			return
+		}
+		port := uint32(l.Addr().(*net.TCPAddr).Port)
+		l.Close()
+		dir, err := os.MkdirTemp("", "library-postgres")
+		if err != nil {
+			embedded.err = err
+			return
+		}
+
+		var logs bytes.Buffer
+		cfg := embeddedpostgres.DefaultConfig().Port(port).Database("library").RuntimePath(dir).Logger(&logs)
+		server := embeddedpostgres.NewDatabase(cfg)
+		if err := server.Start(); err != nil {
+			embedded.err = fmt.Errorf("%w\n%s", err, logs.String())
+			return
+		}
+		embedded.server = server
+		embedded.dsn = cfg.GetConnectionURL() + "?sslmode=disable"
+	})
+	return embedded.dsn, embedded.err
+}
+
+// openPostgres migrates a schema of its own, dropped when the test ends, so
+// tests don't see each other's books. It only skips when no server could be
+// started outside CI, typically because the binaries can't be downloaded.
+func openPostgres(t *testing.T) *database.Database {
+	dsn, err := postgresDSN()
+	if err != nil {
+		if os.Getenv("CI") != "" {
+			t.Fatalf("failed to start an embedded postgres: %v", err)
+		}
+		t.Skipf("no postgres to test against, set POSTGRES_TEST_DSN: %v", err)
+	}
+	admin, err := sql.Open(database.Postgres.DriverName(), dsn)
+	if err != nil {
+		t.Fatalf("failed to open postgres database: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("library_test_%d", rand.Int64())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("failed to drop schema %s: %v", schema, err)
+		}
+	})
+
+	conn, err := sql.Open(database.Postgres.DriverName(), withSearchPath(dsn, schema))
+	if err != nil {
+		t.Fatalf("failed to open postgres database: %v", err)
+	}
+	// registered after the schema cleanup, so it runs first
+	t.Cleanup(func() { conn.Close() })
+	db := &database.Database{Conn: conn, Dialect: database.Postgres}
+	if err := runMigrations(db); err != nil {
+		t.Fatalf("failed to run migrations: %v", err)
+	}
+	return db
+}
+
+// withSearchPath adds search_path to a URL or key=value DSN
+func withSearchPath(dsn, schema string) string {
+	u, err := url.Parse(dsn)
+	if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+		return dsn + " search_path=" + schema
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// TestMigrations applies the embedded migrations and runs the store through
+// a create/read/update/delete cycle.
+func TestMigrations(t *testing.T) {
+	forEachDatabase(t, testMigrations)
+}
+
+func testMigrations(t *testing.T, db *database.Database) {
+	ctx := context.Background()
+	created, err := db.CreateBook(ctx, models.Book{Title: "Dune", Author: "Frank Herbert", PublishedYear: 1965, Genre: "Sci-Fi"})
+	if err != nil {
+		t.Fatalf("failed to create book: %v", err)
+	}
+	books, err := db.GetBooks(ctx, models.BookQuery{Limit: 10})
+	if err != nil || len(books) != 1 {
+		t.Fatalf("Expected 1 book, got %d (err: %v)", len(books), err)
+	}
+	id := created.ID.String()
+	if books[0].ID != created.ID {
+		t.Errorf("Expected listed book %s to match created book %s", books[0].ID, id)
+	}
+	if created.CreatedAt.IsZero() || created.UpdatedAt.IsZero() {
+		t.Errorf("Expected server-set timestamps on the created book, got %+v", created)
+	}
+
+	since := created.CreatedAt.Add(-time.Second)
+	changed, err := db.GetBooks(ctx, models.BookQuery{Limit: 10, Filter: models.BookFilter{UpdatedSince: since}, Sort: []models.SortField{{Field: "updated_at", Desc: true}}})
+	if err != nil || len(changed) != 1 {
+		t.Errorf("Expected the book to be changed since %v, got %d (err: %v)", since, len(changed), err)
+	}
+	filtered, err := db.GetBooks(ctx, models.BookQuery{
+		Limit:  10,
+		Filter: models.BookFilter{Author: "frank herbert", Genre: "SCI-FI", Title: "un", YearMin: 1960, YearMax: 1965},
+		Sort:   []models.SortField{{Field: "title"}, {Field: "published_year", Desc: true}},
+	})
+	if err != nil || len(filtered) != 1 {
+		t.Errorf("Expected the book to match the field filters, got %d (err: %v)", len(filtered), err)
+	}
+	stats, err := db.BookStats(ctx, models.BookFilter{})
+	if err != nil || stats.Count != 1 || stats.VersionSum != 1 || !stats.LastModified.Equal(created.UpdatedAt) {
+		t.Errorf("Expected stats for the one book, got %+v (err: %v)", stats, err)
+	}
+	later, _ := db.GetBooks(ctx, models.BookQuery{Limit: 10, Filter: models.BookFilter{UpdatedSince: created.UpdatedAt.Add(time.Hour)}})
+	if len(later) != 0 {
+		t.Errorf("Expected no books changed in the future, got %d", len(later))
+	}
+
+	if _, err := db.UpdateBook(ctx, id, models.Book{Title: "Dune Messiah", Author: "Frank Herbert"}, 0); err != nil {
+		t.Fatalf("failed to update book: %v", err)
+	}
+	book, err := db.GetBookByID(ctx, id)
+	if err != nil || book.Title != "Dune Messiah" {
+		t.Errorf("Expected updated title, got %q (err: %v)", book.Title, err)
+	}
+	patched, err := db.PatchBook(ctx, id, map[string]interface{}{"published_year": 1969, "genre": "Sci-Fi"}, 2)
+	if err != nil || patched.Title != "Dune Messiah" || patched.PublishedYear != 1969 || patched.Genre != "Sci-Fi" {
+		t.Errorf("Expected only year and genre to change, got %+v (err: %v)", patched, err)
+	}
+	if created.Version != 1 || patched.Version != 3 {
+		t.Errorf("Expected versions 1 and 3, got %d and %d", created.Version, patched.Version)
+	}
+	if _, err := db.DeleteBook(ctx, id, 2); err != database.ErrVersionMismatch {
+		t.Errorf("Expected ErrVersionMismatch deleting a stale version, got %v", err)
+	}
+
+	if _, err := db.DeleteBook(ctx, id, 3); err != nil {
+		t.Fatalf("failed to delete book: %v", err)
+	}
+	if _, err := db.GetBookByID(ctx, id); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows after delete, got %v", err)
+	}
+}
+
+// TestMigrationsMatchAcrossDialects makes sure every dialect ships the same
+// migration versions so the schemas don't drift apart.
+func TestMigrationsMatchAcrossDialects(t *testing.T) {
+	versions := func(dialect database.Dialect) []string {
+		entries, err := fs.ReadDir(embedMigrations, dialect.MigrationsDir())
+		if err != nil {
+			t.Fatalf("failed to read %s migrations: %v", dialect, err)
+		}
+		names := make([]string, len(entries))
+		for i, entry := range entries {
+			names[i] = entry.Name()
+		}
+		return names
+	}
+
+	want := versions(database.MySQL)
+	for _, dialect := range []database.Dialect{database.Postgres, database.SQLite} {
+		got := versions(dialect)
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s migrations %v don't match mysql migrations %v", dialect, got, want)
+		}
+	}
+}
+
+// TestKeysetPagination walks the catalog with keyset cursors on a sort with
+// many ties to check the generated cursor conditions.
+func TestKeysetPagination(t *testing.T) {
+	forEachDatabase(t, testKeysetPagination)
+}
+
+func testKeysetPagination(t *testing.T, db *database.Database) {
+	ctx := context.Background()
+	for i := 0; i < 12; i++ {
+		book := models.Book{Title: "Book", Author: "Author", PublishedYear: 2000 + i%3}
+		if i%2 == 0 {
+			// NULL genres must sort like empty strings
+			book.Genre = "Drama"
+		}
+		if _, err := db.CreateBook(ctx, book); err != nil {
+			t.Fatalf("failed to create book: %v", err)
+		}
+	}
+
+	sortFields := []models.SortField{{Field: "published_year", Desc: true}, {Field: "genre"}, {Field: "created_at"}}
+	all, err := db.GetBooks(ctx, models.BookQuery{Sort: sortFields, Limit: 100})
+	if err != nil {
+		t.Fatalf("failed to list books: %v", err)
+	}
+
+	var walked []models.Book
+	var after *models.Cursor
+	for {
+		page, err := db.GetBooks(ctx, models.BookQuery{Sort: sortFields, Limit: 5, After: after})
+		if err != nil {
+			t.Fatalf("failed to list books after cursor: %v", err)
+		}
+		walked = append(walked, page...)
+		if len(page) < 5 {
+			break
+		}
+		cursor := database.CursorFor(page[len(page)-1], sortFields)
+		after = &cursor
+	}
+
+	if len(walked) != len(all) {
+		t.Fatalf("Expected %d books from the cursor walk, got %d", len(all), len(walked))
+	}
+	for i := range all {
+		if walked[i].ID != all[i].ID {
+			t.Errorf("Position %d: expected %s, got %s", i, all[i].ID, walked[i].ID)
+		}
+	}
+}
+
+// TestFullTextSearch checks the search index stays in sync with books: the
+// FTS5 table kept by triggers on SQLite, the GIN expression index on Postgres.
+func TestFullTextSearch(t *testing.T) {
+	forEachDatabase(t, testFullTextSearch)
+}
+
+func testFullTextSearch(t *testing.T, db *database.Database) {
+	ctx := context.Background()
+	dune, _ := db.CreateBook(ctx, models.Book{Title: "Dune", Author: "Frank Herbert", Genre: "Sci-Fi"})
+	db.CreateBook(ctx, models.Book{Title: "Children of Dune", Author: "Frank Herbert", Genre: "Sci-Fi"})
+	db.CreateBook(ctx, models.Book{Title: "Emma", Author: "Jane Austen", Genre: "Romance"})
+
+	searchTitles := func(raw string) []string {
+		q, err := search.Parse(raw)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", raw, err)
+		}
+		results, err := db.SearchBooks(ctx, q, 10, 0)
+		if err != nil {
+			t.Fatalf("search %q failed: %v", raw, err)
+		}
+		var titles []string
+		for _, result := range results {
+			titles = append(titles, result.Book.Title)
+		}
+		return titles
+	}
+
+	if got := searchTitles("dune"); len(got) != 2 || got[0] != "Dune" {
+		t.Errorf("Expected both Dune books with the exact title first, got %v", got)
+	}
+	if got := searchTitles(`"of dune" herb*`); len(got) != 1 || got[0] != "Children of Dune" {
+		t.Errorf("Expected a phrase and prefix match, got %v", got)
+	}
+
+	db.UpdateBook(ctx, dune.ID.String(), models.Book{Title: "Arrakis", Author: "Frank Herbert", Genre: "Sci-Fi"}, 0)
+	if got := searchTitles("arrakis"); len(got) != 1 {
+		t.Errorf("Expected the updated title to be indexed, got %v", got)
+	}
+	db.DeleteBook(ctx, dune.ID.String(), 0)
+	if got := searchTitles("arrakis"); len(got) != 0 {
+		t.Errorf("Expected the deleted book to leave the index, got %v", got)
+	}
+}
+
+// TestSoftDelete checks deleted books move to the trash, can be restored,
+// and are only removed for good by a purge
+func TestSoftDelete(t *testing.T) {
+	forEachDatabase(t, testSoftDelete)
+}
+
+func testSoftDelete(t *testing.T, db *database.Database) {
+	ctx := context.Background()
+	dune, _ := db.CreateBook(ctx, models.Book{Title: "Dune", Author: "Frank Herbert"})
+	db.CreateBook(ctx, models.Book{Title: "Emma", Author: "Jane Austen"})
+	id := dune.ID.String()
+
+	if _, err := db.DeleteBook(ctx, id, 0); err != nil {
+		t.Fatalf("failed to delete book: %v", err)
+	}
+	if _, err := db.DeleteBook(ctx, id, 0); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows deleting a book twice, got %v", err)
+	}
+	if _, err := db.UpdateBook(ctx, id, models.Book{Title: "Dune", Author: "Frank Herbert"}, 0); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows updating a deleted book, got %v", err)
+	}
+	if n, _ := db.CountBooks(ctx, models.BookFilter{}); n != 1 {
+		t.Errorf("Expected 1 live book, got %d", n)
+	}
+	// the deleted book still dates the list it left
+	stats, err := db.BookStats(ctx, models.BookFilter{})
+	trashStats, _ := db.BookStats(ctx, models.BookFilter{Deleted: true})
+	if err != nil || stats.Count != 1 || trashStats.Count != 1 || !stats.LastModified.Equal(trashStats.LastModified) {
+		t.Errorf("Expected both lists to share the latest update, got %+v and %+v (err: %v)", stats, trashStats, err)
+	}
+	trash, err := db.GetBooks(ctx, models.BookQuery{Limit: 10, Filter: models.BookFilter{Deleted: true}})
+	if err != nil || len(trash) != 1 || trash[0].DeletedAt == nil {
+		t.Fatalf("Expected the book in the trash with deleted_at set, got %+v (err: %v)", trash, err)
+	}
+
+	restored, err := db.RestoreBook(ctx, id)
+	if err != nil || restored.DeletedAt != nil || restored.Version != 3 {
+		t.Errorf("Expected the restored book at version 3, got %+v (err: %v)", restored, err)
+	}
+
+	db.DeleteBook(ctx, id, 0)
+	if purged, err := db.PurgeDeletedBooks(ctx, time.Now().Add(-time.Hour)); err != nil || purged != 0 {
+		t.Errorf("Expected a recent deletion to be kept, purged %d (err: %v)", purged, err)
+	}
+	if purged, err := db.PurgeDeletedBooks(ctx, time.Now().Add(time.Hour)); err != nil || purged != 1 {
+		t.Errorf("Expected the deleted book to be purged, purged %d (err: %v)", purged, err)
+	}
+	if _, err := db.RestoreBook(ctx, id); err != sql.ErrNoRows {
+		t.Errorf("Expected a purged book to be gone, got %v", err)
+	}
+}
+
+// TestAuditLog checks every change to a book is recorded with its actor,
+// request id and changed fields, and that the history survives a purge
+func TestAuditLog(t *testing.T) {
+	forEachDatabase(t, testAuditLog)
+}
+
+func testAuditLog(t *testing.T, db *database.Database) {
+	ctx := requestctx.WithRequestID(requestctx.WithActor(context.Background(), "librarian"), "req-1")
+	dune, err := db.CreateBook(ctx, models.Book{Title: "Dune", Author: "Frank Herbert", PublishedYear: 1965})
+	if err != nil {
+		t.Fatalf("failed to create book: %v", err)
+	}
+	id := dune.ID.String()
+	if _, err := db.PatchBook(ctx, id, map[string]interface{}{"published_year": 1966}, 0); err != nil {
+		t.Fatalf("failed to patch book: %v", err)
+	}
+	// a failed write leaves no trace
+	if _, err := db.PatchBook(ctx, id, map[string]interface{}{"title": "Dune Messiah"}, 1); err != database.ErrVersionMismatch {
+		t.Fatalf("Expected ErrVersionMismatch, got %v", err)
+	}
+	db.DeleteBook(ctx, id, 0)
+	db.PurgeDeletedBooks(requestctx.WithActor(context.Background(), "purge-job"), time.Now().Add(time.Hour))
+
+	history, err := db.GetAuditLog(ctx, models.AuditQuery{Filter: models.AuditFilter{BookID: id}, Limit: 10})
+	if err != nil {
+		t.Fatalf("failed to read the history: %v", err)
+	}
+	var actions []string
+	for _, entry := range history {
+		actions = append(actions, entry.Action+"/"+entry.Actor)
+	}
+	if got, want := strings.Join(actions, ","), "create/librarian,update/librarian,delete/librarian,purge/purge-job"; got != want {
+		t.Fatalf("Expected history %s, got %s", want, got)
+	}
+	update := history[1]
+	if update.RequestID != "req-1" || len(update.Changes) != 1 || update.CreatedAt.IsZero() {
+		t.Errorf("Unexpected update entry %+v", update)
+	}
+	if change := update.Changes["published_year"]; change.Before != json.Number("1965") || change.After != json.Number("1966") {
+		t.Errorf("Expected the year change to be recorded, got %+v", change)
+	}
+
+	byActor, err := db.GetAuditLog(ctx, models.AuditQuery{
+		Filter: models.AuditFilter{Actor: "purge-job", Since: time.Now().Add(-time.Hour)},
+		Limit:  10,
+	})
+	if err != nil || len(byActor) != 1 {
+		t.Errorf("Expected the purge alone for purge-job, got %+v (err: %v)", byActor, err)
+	}
+}
+
+// TestBatch checks batches against a real transaction: an atomic batch
+// leaves nothing behind when an operation fails, a partial one keeps the
+// operations that succeeded
+func TestBatch(t *testing.T) {
+	forEachDatabase(t, testBatch)
+}
+
+func testBatch(t *testing.T, db *database.Database) {
+	ctx := context.Background()
+	dune, _ := db.CreateBook(ctx, models.Book{Title: "Dune", Author: "Frank Herbert"})
+	ops := []models.BatchOperation{
+		{Op: models.BatchCreate, Book: &models.Book{Title: "Emma", Author: "Jane Austen"}},
+		{Op: models.BatchUpdate, ID: dune.ID.String(), Book: &models.Book{Title: "Dune", Author: "Frank Herbert", PublishedYear: 1965}},
+		{Op: models.BatchDelete, ID: "123e4567-e89b-12d3-a456-426614174999"},
+	}
+
+	results, err := db.ApplyBatch(ctx, ops, true)
+	if err != nil || results[2].Err != sql.ErrNoRows || results[0].Err != database.ErrBatchAborted {
+		t.Fatalf("Expected the atomic batch to abort, got %+v (err: %v)", results, err)
+	}
+	if n, _ := db.CountBooks(ctx, models.BookFilter{}); n != 1 {
+		t.Errorf("Expected the create to be rolled back, got %d books", n)
+	}
+	if history, _ := db.GetAuditLog(ctx, models.AuditQuery{Limit: 10}); len(history) != 1 {
+		t.Errorf("Expected only the first create to be audited, got %+v", history)
+	}
+
+	results, err = db.ApplyBatch(ctx, ops, false)
+	if err != nil || results[0].Err != nil || results[1].Err != nil || results[2].Err != sql.ErrNoRows {
+		t.Fatalf("Expected the partial batch to keep the first two operations, got %+v (err: %v)", results, err)
+	}
+	if results[1].Book.PublishedYear != 1965 || results[1].Book.Version != 2 {
+		t.Errorf("Expected the updated book in the results, got %+v", results[1].Book)
+	}
+	if n, _ := db.CountBooks(ctx, models.BookFilter{}); n != 2 {
+		t.Errorf("Expected 2 books, got %d", n)
+	}
+}
+
+func TestISBN(t *testing.T) {
+	forEachDatabase(t, testISBN)
+}
+
+func testISBN(t *testing.T, db *database.Database) {
+	ctx := context.Background()
+	dune, err := db.CreateBook(ctx, models.Book{Title: "Dune", Author: "Frank Herbert", ISBN: "9780441172719"})
+	if err != nil || dune.ISBN != "9780441172719" {
+		t.Fatalf("Expected the ISBN to be stored, got %+v (err: %v)", dune, err)
+	}
+	// books without an ISBN don't clash with each other
+	for _, title := range []string{"Emma", "Beloved"} {
+		if _, err := db.CreateBook(ctx, models.Book{Title: title, Author: "Someone"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if _, err := db.CreateBook(ctx, models.Book{Title: "Dune", Author: "Frank Herbert", ISBN: "9780441172719"}); err != database.ErrDuplicateISBN {
+		t.Errorf("Expected ErrDuplicateISBN, got %v", err)
+	}
+
+	found, err := db.GetBookByISBN(ctx, "9780441172719")
+	if err != nil || found.ID != dune.ID {
+		t.Errorf("Expected to find Dune by its ISBN, got %+v (err: %v)", found, err)
+	}
+	patched, err := db.PatchBook(ctx, dune.ID.String(), map[string]interface{}{"isbn": ""}, 0)
+	if err != nil || patched.ISBN != "" {
+		t.Errorf("Expected the ISBN to be cleared, got %+v (err: %v)", patched, err)
+	}
+	if _, err := db.GetBookByISBN(ctx, "9780441172719"); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows after clearing the ISBN, got %v", err)
+	}
+
+	dupes, err := db.FindDuplicates(ctx, []models.Book{{Title: "emma ", Author: "SOMEONE"}, {Title: "Beloved", Author: "Toni Morrison"}})
+	if err != nil || len(dupes) != 1 || dupes[0].Title != "Emma" {
+		t.Errorf("Expected Emma alone as a duplicate, got %+v (err: %v)", dupes, err)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	forEachDatabase(t, testAPIKeys)
+}
+
+func testAPIKeys(t *testing.T, db *database.Database) {
+	ctx := context.Background()
+	key, err := db.CreateAPIKey(ctx, models.APIKey{
+		Name: "Kiosk", Scopes: []string{"books:read", "books:write"}, CreatedBy: "admin",
+		Prefix: "0011223344556677", Salt: "salt", Hash: "hash",
+	})
+	if err != nil || key.Name != "Kiosk" || len(key.Scopes) != 2 || key.CreatedAt.IsZero() || key.LastUsedAt != nil {
+		t.Fatalf("Expected the key to be stored, got %+v (err: %v)", key, err)
+	}
+
+	if err := db.TouchAPIKey(ctx, key.ID.String()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	found, err := db.GetAPIKeyByPrefix(ctx, "0011223344556677")
+	if err != nil || found.ID != key.ID || found.Hash != "hash" || found.LastUsedAt == nil {
+		t.Errorf("Expected to find the used key by its prefix, got %+v (err: %v)", found, err)
+	}
+
+	rotated, err := db.RotateAPIKey(ctx, key.ID.String(), "8899aabbccddeeff", "salt2", "hash2")
+	if err != nil || rotated.Prefix != "8899aabbccddeeff" || rotated.Hash != "hash2" || rotated.RotatedAt == nil {
+		t.Errorf("Expected the key to be rotated, got %+v (err: %v)", rotated, err)
+	}
+	if _, err := db.GetAPIKeyByPrefix(ctx, "0011223344556677"); err != sql.ErrNoRows {
+		t.Errorf("Expected the old prefix to be gone, got %v", err)
+	}
+
+	revoked, err := db.RevokeAPIKey(ctx, key.ID.String())
+	if err != nil || revoked.RevokedAt == nil {
+		t.Errorf("Expected the key to be revoked, got %+v (err: %v)", revoked, err)
+	}
+	if _, err := db.RevokeAPIKey(ctx, key.ID.String()); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows revoking twice, got %v", err)
+	}
+	if _, err := db.RotateAPIKey(ctx, key.ID.String(), "ffeeddccbbaa9988", "salt3", "hash3"); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows rotating a revoked key, got %v", err)
+	}
+
+	keys, err := db.ListAPIKeys(ctx)
+	if err != nil || len(keys) != 1 || keys[0].RevokedAt == nil {
+		t.Errorf("Expected the revoked key to stay listed, got %+v (err: %v)", keys, err)
+	}
+}